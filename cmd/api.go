@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rancher/webhook-service/model"
+)
+
+//Client talks to the receivers API of a running webhook service
+type Client struct {
+	//URL is where the service listens, such as http://localhost:8085
+	URL       string
+	ProjectID string
+	//AccessKey and SecretKey are the Rancher API key the management API is called with
+	AccessKey  string
+	SecretKey  string
+	HTTPClient *http.Client
+}
+
+//APIError is an error response of the webhook service
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+//IsNotFound tells if err is a 404 from the webhook service
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+//List returns all receivers of the project matching the filters, following pagination
+func (c *Client) List(filters url.Values) ([]model.Webhook, error) {
+	query := url.Values{}
+	for k, v := range filters {
+		query[k] = v
+	}
+	next := c.endpoint("/receivers", query)
+
+	receivers := []model.Webhook{}
+	for next != "" {
+		collection := model.WebhookCollection{}
+		if err := c.do("GET", next, nil, &collection); err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, collection.Data...)
+		next = ""
+		if collection.Pagination != nil && collection.Pagination.Next != "" {
+			next = collection.Pagination.Next
+		}
+	}
+	return receivers, nil
+}
+
+//Get returns a receiver by id
+func (c *Client) Get(id string) (*model.Webhook, error) {
+	receiver := &model.Webhook{}
+	if err := c.do("GET", c.endpoint("/receivers/"+url.PathEscape(id), nil), nil, receiver); err != nil {
+		return nil, err
+	}
+	return receiver, nil
+}
+
+//Find returns a receiver by id, or by name when there's no receiver with that id
+func (c *Client) Find(idOrName string) (*model.Webhook, error) {
+	receiver, err := c.Get(idOrName)
+	if err == nil || !IsNotFound(err) {
+		return receiver, err
+	}
+	receivers, listErr := c.List(url.Values{"name_prefix": {idOrName}})
+	if listErr != nil {
+		return nil, listErr
+	}
+	for _, r := range receivers {
+		if r.Name == idOrName {
+			return &r, nil
+		}
+	}
+	return nil, err
+}
+
+//Create creates a receiver from its definition, the JSON body of the create API
+func (c *Client) Create(definition map[string]interface{}) (*model.Webhook, error) {
+	body, err := json.Marshal(definition)
+	if err != nil {
+		return nil, err
+	}
+	receiver := &model.Webhook{}
+	if err := c.do("POST", c.endpoint("/receivers", nil), body, receiver); err != nil {
+		return nil, err
+	}
+	return receiver, nil
+}
+
+//Delete deletes a receiver by id
+func (c *Client) Delete(id string) error {
+	return c.do("DELETE", c.endpoint("/receivers/"+url.PathEscape(id), nil), nil, nil)
+}
+
+//History returns the latest executions of a receiver, newest first
+func (c *Client) History(id string) ([]model.Execution, error) {
+	collection := model.ExecutionCollection{}
+	if err := c.do("GET", c.endpoint("/receivers/"+url.PathEscape(id)+"/history", nil), nil, &collection); err != nil {
+		return nil, err
+	}
+	return collection.Data, nil
+}
+
+//Export returns the project's receivers as a YAML or JSON document the import action accepts
+func (c *Client) Export(format string) ([]byte, error) {
+	return c.send("GET", c.endpoint("/receivers", url.Values{"export": {format}}), nil)
+}
+
+//Import makes the project's receivers match a document, the JSON body of the import action. An
+//import that stops partway returns the changes it applied and the failed one along with the error.
+func (c *Client) Import(document map[string]interface{}) (*model.ReceiverImportResult, error) {
+	body, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.ReceiverImportResult{}
+	if err := c.do("POST", c.endpoint("/receivers", url.Values{"action": {"import"}}), body, result); err != nil {
+		apiErr, ok := err.(*APIError)
+		if !ok || json.Unmarshal([]byte(apiErr.Message), result) != nil || len(result.Changes) == 0 {
+			return nil, err
+		}
+		apiErr.Message = result.Changes[len(result.Changes)-1].Message
+		return result, apiErr
+	}
+	return result, nil
+}
+
+//Trigger calls a receiver's URL with payload and returns the response status and body. A status
+//other than 200 is returned as is, not as an error, since the caller wants to see it.
+func (c *Client) Trigger(receiver *model.Webhook, payload []byte, contentType string) (int, string, error) {
+	if receiver.URL == "" {
+		return 0, "", fmt.Errorf("Receiver %s has no URL", receiver.Id)
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	request, err := http.NewRequest("POST", receiver.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	request.Header.Set("Content-Type", contentType)
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return response.StatusCode, strings.TrimSpace(string(body)), nil
+}
+
+func (c *Client) endpoint(path string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("projectId", c.ProjectID)
+	return strings.TrimSuffix(c.URL, "/") + "/v1-webhooks" + path + "?" + query.Encode()
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func (c *Client) do(method string, endpoint string, body []byte, result interface{}) error {
+	data, err := c.send(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("Unexpected response from %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+//send makes an API request and returns the response body, or an *APIError for an error response
+func (c *Client) send(method string, endpoint string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	if c.AccessKey != "" {
+		request.SetBasicAuth(c.AccessKey, c.SecretKey)
+	}
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(data))}
+		serverErr := model.ServerAPIError{}
+		if json.Unmarshal(data, &serverErr) == nil && serverErr.Message != "" {
+			apiErr.Message = serverErr.Message
+		}
+		return nil, apiErr
+	}
+	return data, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+//KeysCommand creates the RSA keys receiver tokens are signed with
+func KeysCommand() cli.Command {
+	return cli.Command{
+		Name:  "keys",
+		Usage: "Manage the RSA keys receiver tokens are signed with",
+		Subcommands: []cli.Command{
+			{
+				Name:   "generate",
+				Usage:  "Generate an RSA key pair for --rsa-private-key-file and --rsa-public-key-file",
+				Action: generateKeys,
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: "bits", Usage: "Size of the key", Value: 2048},
+					cli.StringFlag{Name: "private-key-file", Usage: "File the PEM private key is written to, printed when not set"},
+					cli.StringFlag{Name: "public-key-file", Usage: "File the PEM public key is written to, printed when not set"},
+					cli.BoolFlag{Name: "force", Usage: "Overwrite existing key files"},
+				},
+			},
+		},
+	}
+}
+
+//GenerateKeys creates an RSA key pair, the private key PEM encoded as PKCS#1 and the public key as
+//PKIX, the encodings LoadKeySet reads
+func GenerateKeys(bits int) ([]byte, []byte, error) {
+	if bits < 2048 {
+		return nil, nil, fmt.Errorf("Keys must have at least 2048 bits, got %d", bits)
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+	return privatePEM, publicPEM, nil
+}
+
+func generateKeys(c *cli.Context) error {
+	privatePEM, publicPEM, err := GenerateKeys(c.Int("bits"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, key := range []struct {
+		file string
+		data []byte
+		mode os.FileMode
+	}{
+		{c.String("private-key-file"), privatePEM, 0600},
+		{c.String("public-key-file"), publicPEM, 0644},
+	} {
+		if key.file == "" {
+			stdout.Write(key.data)
+			continue
+		}
+		if err := writeKeyFile(key.file, key.data, key.mode, c.Bool("force")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Fprintf(stdout, "Wrote %s\n", key.file)
+	}
+	return nil
+}
+
+func writeKeyFile(file string, data []byte, mode os.FileMode, force bool) error {
+	if _, err := os.Stat(file); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", file)
+	}
+	return ioutil.WriteFile(file, data, mode)
+}
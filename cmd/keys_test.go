@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/rancher/webhook-service/service"
+)
+
+func TestGenerateKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	privateFile := filepath.Join(dir, "private.pem")
+	publicFile := filepath.Join(dir, "public.pem")
+
+	args := []string{"keys", "generate", "--private-key-file", privateFile, "--public-key-file", publicFile}
+	if _, err := run(args...); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := service.LoadKeySetFrom(&service.KeySource{PrivateKeyFile: privateFile, PublicKeyFile: publicFile})
+	if err != nil {
+		t.Fatalf("Generated keys can't be loaded: %v", err)
+	}
+	token, err := keys.Sign(jwt.MapClaims{"projectId": "1a5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Parse(token); err != nil {
+		t.Fatalf("Token signed with generated keys doesn't verify: %v", err)
+	}
+
+	if _, err := run(args...); err == nil {
+		t.Fatal("Expected existing key files not to be overwritten")
+	}
+	if _, err := run(append(args, "--force")...); err != nil {
+		t.Fatal(err)
+	}
+}
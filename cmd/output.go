@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rancher/webhook-service/yaml"
+)
+
+//stdout is where commands print their results, replaced in tests
+var stdout io.Writer = os.Stdout
+
+//outputFormats are the values of --output
+var outputFormats = []string{"table", "json", "yaml"}
+
+func validateOutput(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid output %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+//printResult prints value as JSON or YAML, or as a table of headers and rows otherwise
+func printResult(format string, value interface{}, headers []string, rows [][]string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(data)
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
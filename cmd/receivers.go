@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/yaml"
+	"github.com/urfave/cli"
+)
+
+//ReceiversCommand manages the receivers of a running webhook service through its API
+func ReceiversCommand() cli.Command {
+	return cli.Command{
+		Name:  "receivers",
+		Usage: "Manage the receivers of a running webhook service",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "url",
+				Usage:  "URL of the webhook service",
+				Value:  "http://localhost:8085",
+				EnvVar: "WEBHOOK_URL",
+			},
+			cli.StringFlag{
+				Name:   "project-id",
+				Usage:  "Project whose receivers are managed",
+				EnvVar: "PROJECT_ID",
+			},
+			cli.StringFlag{
+				Name:   "access-key",
+				Usage:  "Rancher API access key the receivers API is called with",
+				EnvVar: "RANCHER_ACCESS_KEY",
+			},
+			cli.StringFlag{
+				Name:   "secret-key",
+				Usage:  "Rancher API secret key the receivers API is called with",
+				EnvVar: "RANCHER_SECRET_KEY",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: table, json or yaml",
+				Value: "table",
+			},
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List receivers",
+				Action: withClient(listReceivers),
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "driver", Usage: "Only list receivers of this driver"},
+					cli.StringFlag{Name: "name-prefix", Usage: "Only list receivers whose name starts with this"},
+					cli.StringFlag{Name: "state", Usage: "Only list receivers in this state"},
+					cli.StringFlag{Name: "sort", Usage: "Sort by name, driver, state or created"},
+					cli.StringFlag{Name: "order", Usage: "Sort order: asc or desc"},
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "Show a receiver",
+				ArgsUsage: "ID|NAME",
+				Action:    withClient(getReceiver),
+			},
+			{
+				Name:   "create",
+				Usage:  "Create a receiver from flags, a YAML or JSON file, or both with flags taking precedence",
+				Action: withClient(createReceiver),
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "file, f", Usage: "YAML or JSON receiver definition, - for stdin"},
+					cli.StringFlag{Name: "name", Usage: "Name of the receiver"},
+					cli.StringFlag{Name: "driver", Usage: "Driver: scaleService, scaleHost or serviceUpgrade"},
+					cli.StringSliceFlag{Name: "config", Usage: "Driver config field as key=value, such as serviceId=1s1. May be repeated"},
+					cli.StringSliceFlag{Name: "allowed-cidr", Usage: "Network the receiver URL may be called from. May be repeated"},
+					cli.StringFlag{Name: "condition", Usage: "Expression the call's body must satisfy for the driver to run"},
+					cli.BoolFlag{Name: "use-token", Usage: "Give the receiver an expiring token URL"},
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete receivers",
+				ArgsUsage: "ID|NAME...",
+				Action:    withClient(deleteReceivers),
+			},
+			{
+				Name:      "trigger",
+				Usage:     "Call a receiver's URL",
+				ArgsUsage: "ID|NAME",
+				Action:    withClient(triggerReceiver),
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "payload-file, d", Usage: "File with the body to send, - for stdin. {} is sent when not set"},
+					cli.StringFlag{Name: "content-type", Usage: "Content-Type of the body", Value: "application/json"},
+				},
+			},
+			{
+				Name:   "export",
+				Usage:  "Print the receivers as a document import accepts, in YAML unless --output is json",
+				Action: withClient(exportReceivers),
+			},
+			{
+				Name:   "import",
+				Usage:  "Create, update and optionally delete receivers to match a YAML or JSON document",
+				Action: withClient(importReceivers),
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "file, f", Usage: "YAML or JSON document with a list of receivers, - for stdin"},
+					cli.BoolFlag{Name: "prune", Usage: "Delete the receivers the document doesn't list"},
+					cli.BoolFlag{Name: "dry-run", Usage: "Only show the changes the import would make"},
+				},
+			},
+			{
+				Name:      "history",
+				Usage:     "Show the latest calls to a receiver's URL",
+				ArgsUsage: "ID|NAME",
+				Action:    withClient(receiverHistory),
+			},
+		},
+	}
+}
+
+//withClient builds the API client from the receivers command's flags, and turns errors into
+//exit errors that cli prints
+func withClient(action func(*cli.Context, *Client, string) error) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		output := c.GlobalString("output")
+		if err := validateOutput(output); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		if c.GlobalString("project-id") == "" {
+			return cli.NewExitError("--project-id or PROJECT_ID must be set", 1)
+		}
+		client := &Client{
+			URL:       c.GlobalString("url"),
+			ProjectID: c.GlobalString("project-id"),
+			AccessKey: c.GlobalString("access-key"),
+			SecretKey: c.GlobalString("secret-key"),
+		}
+		if err := action(c, client, output); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+}
+
+func oneArg(c *cli.Context) (string, error) {
+	if c.NArg() != 1 {
+		return "", fmt.Errorf("Expected one receiver ID or name, got %d arguments", c.NArg())
+	}
+	return c.Args().First(), nil
+}
+
+func listReceivers(c *cli.Context, client *Client, output string) error {
+	filters := url.Values{}
+	for flag, param := range map[string]string{"driver": "driver", "name-prefix": "name_prefix", "state": "state",
+		"sort": "sort", "order": "order"} {
+		if value := c.String(flag); value != "" {
+			filters.Set(param, value)
+		}
+	}
+	receivers, err := client.List(filters)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, r := range receivers {
+		rows = append(rows, []string{r.Id, r.Name, r.Driver, r.State, r.URL})
+	}
+	return printResult(output, receivers, []string{"ID", "NAME", "DRIVER", "STATE", "URL"}, rows)
+}
+
+func getReceiver(c *cli.Context, client *Client, output string) error {
+	id, err := oneArg(c)
+	if err != nil {
+		return err
+	}
+	receiver, err := client.Find(id)
+	if err != nil {
+		return err
+	}
+	return printReceiver(output, receiver)
+}
+
+func printReceiver(output string, receiver *model.Webhook) error {
+	config, err := json.Marshal(driverConfig(receiver))
+	if err != nil {
+		return err
+	}
+	rows := [][]string{
+		{"ID", receiver.Id},
+		{"NAME", receiver.Name},
+		{"DRIVER", receiver.Driver},
+		{"STATE", receiver.State},
+		{"URL", receiver.URL},
+		{"CONFIG", string(config)},
+	}
+	if len(receiver.AllowedCIDRs) > 0 {
+		rows = append(rows, []string{"ALLOWED CIDRS", strings.Join(receiver.AllowedCIDRs, ",")})
+	}
+	if receiver.Condition != "" {
+		rows = append(rows, []string{"CONDITION", receiver.Condition})
+	}
+	if receiver.Message != "" {
+		rows = append(rows, []string{"MESSAGE", receiver.Message})
+	}
+	return printResult(output, receiver, []string{"FIELD", "VALUE"}, rows)
+}
+
+//driverConfig returns the config of the receiver's own driver
+func driverConfig(receiver *model.Webhook) interface{} {
+	switch receiver.Driver {
+	case "scaleService":
+		return receiver.ScaleServiceConfig
+	case "scaleHost":
+		return receiver.ScaleHostConfig
+	case "serviceUpgrade":
+		return receiver.ServiceUpgradeConfig
+	}
+	return nil
+}
+
+func createReceiver(c *cli.Context, client *Client, output string) error {
+	definition := map[string]interface{}{}
+	if file := c.String("file"); file != "" {
+		data, err := readInput(file)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, &definition); err != nil {
+			return fmt.Errorf("Invalid receiver definition in %s: %v", file, err)
+		}
+	}
+
+	for _, flag := range []string{"name", "driver", "condition"} {
+		if value := c.String(flag); value != "" {
+			definition[flag] = value
+		}
+	}
+	if cidrs := c.StringSlice("allowed-cidr"); len(cidrs) > 0 {
+		definition["allowedCIDRs"] = cidrs
+	}
+	if c.Bool("use-token") {
+		definition["useToken"] = true
+	}
+
+	if fields := c.StringSlice("config"); len(fields) > 0 {
+		driver, _ := definition["driver"].(string)
+		if driver == "" {
+			return fmt.Errorf("A driver is required to set --config")
+		}
+		configKey := driver + "Config"
+		config, ok := definition[configKey].(map[string]interface{})
+		if !ok {
+			config = map[string]interface{}{}
+		}
+		for _, field := range fields {
+			key, value, err := parseConfigField(field)
+			if err != nil {
+				return err
+			}
+			config[key] = value
+		}
+		definition[configKey] = config
+	}
+
+	receiver, err := client.Create(definition)
+	if err != nil {
+		return err
+	}
+	return printReceiver(output, receiver)
+}
+
+//parseConfigField splits key=value, reading the value as YAML so numbers, bools and flow
+//collections like [a, b] or {app: web} keep their type
+func parseConfigField(field string) (string, interface{}, error) {
+	parts := strings.SplitN(field, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("Invalid config %q, expected key=value", field)
+	}
+	value, err := yaml.Parse([]byte(parts[1]))
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid value of config %s: %v", parts[0], err)
+	}
+	if _, ok := value.(map[string]interface{}); ok && !strings.HasPrefix(strings.TrimSpace(parts[1]), "{") {
+		//a value like a: b is a string, not a mapping
+		value = parts[1]
+	}
+	return parts[0], value, nil
+}
+
+func deleteReceivers(c *cli.Context, client *Client, output string) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("Expected at least one receiver ID or name")
+	}
+	for _, id := range c.Args() {
+		receiver, err := client.Find(id)
+		if err != nil {
+			return fmt.Errorf("Cannot delete %s: %v", id, err)
+		}
+		if err := client.Delete(receiver.Id); err != nil {
+			return fmt.Errorf("Cannot delete %s: %v", id, err)
+		}
+		fmt.Fprintln(stdout, receiver.Id)
+	}
+	return nil
+}
+
+func triggerReceiver(c *cli.Context, client *Client, output string) error {
+	id, err := oneArg(c)
+	if err != nil {
+		return err
+	}
+	payload := []byte("{}")
+	if file := c.String("payload-file"); file != "" {
+		if payload, err = readInput(file); err != nil {
+			return err
+		}
+	}
+
+	receiver, err := client.Find(id)
+	if err != nil {
+		return err
+	}
+	status, body, err := client.Trigger(receiver, payload, c.String("content-type"))
+	if err != nil {
+		return err
+	}
+	result := map[string]interface{}{"status": status, "body": body}
+	if err := printResult(output, result, []string{"STATUS", "BODY"}, [][]string{{strconv.Itoa(status), body}}); err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("Receiver %s returned %d", receiver.Id, status)
+	}
+	return nil
+}
+
+func exportReceivers(c *cli.Context, client *Client, output string) error {
+	format := "yaml"
+	if output == "json" {
+		format = "json"
+	}
+	document, err := client.Export(format)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(document)
+	return err
+}
+
+func importReceivers(c *cli.Context, client *Client, output string) error {
+	file := c.String("file")
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	data, err := readInput(file)
+	if err != nil {
+		return err
+	}
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("Invalid receivers document in %s: %v", file, err)
+	}
+	if c.Bool("prune") {
+		document["prune"] = true
+	}
+	if c.Bool("dry-run") {
+		document["dryRun"] = true
+	}
+
+	result, err := client.Import(document)
+	if result == nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, change := range result.Changes {
+		rows = append(rows, []string{change.Name, change.Action, change.ID, strings.Join(change.Fields, ",")})
+	}
+	if printErr := printResult(output, result, []string{"NAME", "ACTION", "ID", "FIELDS"}, rows); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func receiverHistory(c *cli.Context, client *Client, output string) error {
+	id, err := oneArg(c)
+	if err != nil {
+		return err
+	}
+	receiver, err := client.Find(id)
+	if err != nil {
+		return err
+	}
+	executions, err := client.History(receiver.Id)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, e := range executions {
+		message := e.Message
+		for _, host := range e.Hosts {
+			message = strings.TrimSpace(fmt.Sprintf("%s %s:%s", message, host.HostID, host.State))
+		}
+		for _, service := range e.Services {
+			message = strings.TrimSpace(fmt.Sprintf("%s %s:%s", message, service.ServiceID, service.State))
+		}
+		rows = append(rows, []string{e.Id, e.Time, e.SourceIP, strconv.Itoa(e.Code), message})
+	}
+	return printResult(output, executions, []string{"ID", "TIME", "SOURCE", "CODE", "MESSAGE"}, rows)
+}
+
+//readInput reads a file, or stdin for -
+func readInput(file string) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/service"
+	"github.com/rancher/webhook-service/store"
+	"github.com/rancher/webhook-service/testutils"
+	"github.com/urfave/cli"
+)
+
+//run runs the CLI with args and returns what it printed
+func run(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	stdout = out
+	cli.OsExiter = func(int) {}
+	cli.ErrWriter = ioutil.Discard
+	defer func() {
+		stdout = os.Stdout
+		cli.OsExiter = os.Exit
+		cli.ErrWriter = os.Stderr
+	}()
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{ReceiversCommand(), KeysCommand()}
+	app.Writer = ioutil.Discard
+	err := app.Run(append([]string{"webhook-service"}, args...))
+	return out.String(), err
+}
+
+func TestReceiversCommand(t *testing.T) {
+	drivers.RegisterDrivers()
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	serviceID := cattle.Add("1a5", "service", map[string]interface{}{
+		"kind":         "service",
+		"scale":        1,
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:nginx"},
+	})
+
+	privatePEM, publicPEM, err := GenerateKeys(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(service.NewRouter(&service.RouteHandler{
+		ClientFactory: cattle,
+		Store:         store.NewMemoryStore(),
+		Keys:          service.NewKeySet(privateKey, publicKey),
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "receivers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	definition := filepath.Join(dir, "receiver.yaml")
+	err = ioutil.WriteFile(definition, []byte("# scales the web service\nname: scale-web\ndriver: scaleService\n"+
+		"scaleServiceConfig:\n  serviceId: "+serviceID+"\n  action: up\n  amount: 1\n  min: 1\n  max: 3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection := []string{"receivers", "--url", server.URL, "--project-id", "1a5"}
+	out, err := run(append(connection, "create", "-f", definition, "--config", "amount=2")...)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !strings.Contains(out, "scale-web") || !strings.Contains(out, `"amount":2`) {
+		t.Fatalf("Unexpected create output\n%s", out)
+	}
+
+	out, err = run(append(connection, "list")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "scale-web") {
+		t.Fatalf("Unexpected list output\n%s", out)
+	}
+
+	out, err = run(append(connection, "-o", "json", "get", "scale-web")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(out), &receiver); err != nil {
+		t.Fatalf("get -o json didn't print JSON: %v\n%s", err, out)
+	}
+	id, _ := receiver["id"].(string)
+
+	if out, err = run(append(connection, "trigger", id)...); err != nil {
+		t.Fatalf("trigger failed: %v\n%s", err, out)
+	}
+	if scale := cattle.Get("service", serviceID)["scale"]; scale != float64(3) {
+		t.Fatalf("Expected trigger to scale the service to 3, got %v", scale)
+	}
+	if _, err = run(append(connection, "trigger", id)...); err == nil {
+		t.Fatal("Expected trigger to fail when scaling above max")
+	}
+
+	out, err = run(append(connection, "-o", "yaml", "history", "scale-web")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "code: 200") || !strings.Contains(out, "code: 400") {
+		t.Fatalf("Unexpected history\n%s", out)
+	}
+
+	out, err = run(append(connection, "export")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "name: scale-web") || !strings.Contains(out, "amount: 2") {
+		t.Fatalf("Unexpected export\n%s", out)
+	}
+	exported := filepath.Join(dir, "receivers.yaml")
+	edited := strings.Replace(out, "amount: 2", "amount: 1", 1)
+	if err := ioutil.WriteFile(exported, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(append(connection, "import", "-f", exported)...)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if strings.Join(strings.Fields(out), " ") != "NAME ACTION ID FIELDS scale-web update "+id+" scaleServiceConfig" {
+		t.Fatalf("Unexpected import output\n%s", out)
+	}
+	if got, err := run(append(connection, "-o", "json", "get", id)...); err != nil || !strings.Contains(got, `"amount": 1`) {
+		t.Fatalf("Import didn't update the receiver: %v\n%s", err, got)
+	}
+
+	if _, err = run(append(connection, "delete", "scale-web")...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = run(append(connection, "get", id)...); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Expected the receiver to be gone, got %v", err)
+	}
+
+	if _, err = run("receivers", "--url", server.URL, "list"); err == nil {
+		t.Fatal("Expected list without a project to fail")
+	}
+	if _, err = run(append(connection, "create", "--name", "x", "--config", "amount")...); err == nil {
+		t.Fatal("Expected a config without a value to fail")
+	}
+}
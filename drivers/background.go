@@ -0,0 +1,34 @@
+package drivers
+
+import (
+	"sync"
+	"time"
+)
+
+var backgroundWork sync.WaitGroup
+
+//goBackground runs fn in a goroutine that is tracked so shutdown can wait for it
+func goBackground(fn func()) {
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		fn()
+	}()
+}
+
+//WaitForBackgroundWork blocks until all driver work started in the background has finished
+//or the timeout expires. It returns false if the timeout expired first.
+func WaitForBackgroundWork(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		backgroundWork.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
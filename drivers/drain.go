@@ -0,0 +1,181 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+//Host progress states reported while scaling down
+const (
+	HostDeactivated = "deactivated"
+	HostDraining    = "draining"
+	HostDeleted     = "deleted"
+	HostFailed      = "failed"
+	HostReactivated = "reactivated"
+)
+
+const defaultDrainTimeout = 5 * time.Minute
+
+//drainPollInterval is how often a draining host is checked for remaining containers
+var drainPollInterval = 5 * time.Second
+
+//drainHosts deletes the hosts picked for a scale down. With force each host is evacuated and
+//deleted at once. Otherwise every host is deactivated first, so nothing is scheduled onto a host
+//that is about to go, and then each one is drained in the background: evacuated, waited on until
+//no non-system containers remain and only then deleted. A host that doesn't drain within the
+//timeout is left inactive and reported as failed. When a host can't be deactivated, the scale down
+//stops and the hosts deactivated before it are activated again.
+func drainHosts(victims []client.Host, config *model.ScaleHost, apiClient *client.RancherClient, group *hostGroup,
+	progress HostProgressFunc) (int, error) {
+	if config.Force {
+		for _, host := range victims {
+			log.Infof("Deleting host %s", host.Id)
+			code, err := deleteHost(host.Id, apiClient)
+			if err != nil {
+				log.Errorf("Cannot delete host: %v", err)
+				progress(hostProgress(host, HostFailed, err.Error()))
+				return code, fmt.Errorf("Cannot delete host")
+			}
+			progress(hostProgress(host, HostDeleted, "Deleted without draining"))
+		}
+		return http.StatusOK, nil
+	}
+
+	timeout := defaultDrainTimeout
+	if config.DrainTimeoutSeconds > 0 {
+		timeout = time.Duration(config.DrainTimeoutSeconds) * time.Second
+	}
+
+	deactivated := []client.Host{}
+	for _, host := range victims {
+		if host.State != "inactive" {
+			log.Infof("Deactivating host %s before draining it", host.Id)
+			if _, err := apiClient.Host.ActionDeactivate(&host); err != nil {
+				log.Errorf("Cannot deactivate host %s: %v", host.Id, err)
+				progress(hostProgress(host, HostFailed, fmt.Sprintf("Cannot deactivate host: %v", err)))
+				reactivateHosts(deactivated, apiClient, group, progress)
+				return http.StatusInternalServerError, fmt.Errorf("Cannot deactivate host %s", host.Id)
+			}
+		}
+		group.draining[host.Id] = true
+		deactivated = append(deactivated, host)
+		progress(hostProgress(host, HostDeactivated, ""))
+	}
+
+	for _, host := range deactivated {
+		host := host
+		group.hold()
+		goBackground(func() {
+			err := drainHost(host, apiClient, timeout, progress)
+			if err != nil {
+				log.Errorf("Draining host %s failed: %v", host.Id, err)
+				progress(hostProgress(host, HostFailed, err.Error()))
+			} else {
+				progress(hostProgress(host, HostDeleted, ""))
+			}
+
+			group.Lock()
+			delete(group.draining, host.Id)
+			group.unlock()
+		})
+	}
+	return http.StatusOK, nil
+}
+
+//reactivateHosts undoes the deactivation of hosts a failed scale down won't drain, so they rejoin
+//the group. Hosts that were already inactive are left as they were.
+func reactivateHosts(hosts []client.Host, apiClient *client.RancherClient, group *hostGroup, progress HostProgressFunc) {
+	for _, host := range hosts {
+		delete(group.draining, host.Id)
+		if host.State == "inactive" {
+			continue
+		}
+		log.Infof("Activating host %s again, the scale down stopped", host.Id)
+		current, err := apiClient.Host.ById(host.Id)
+		if err == nil && current == nil {
+			err = fmt.Errorf("host not found")
+		}
+		if err == nil {
+			_, err = apiClient.Host.ActionActivate(current)
+		}
+		if err != nil {
+			log.Errorf("Cannot activate host %s: %v", host.Id, err)
+			progress(hostProgress(host, HostFailed, fmt.Sprintf("Scale down stopped, cannot activate host again: %v", err)))
+			continue
+		}
+		progress(hostProgress(host, HostReactivated, "Scale down stopped"))
+	}
+}
+
+//drainHost evacuates a deactivated host, waits for its containers to be gone and deletes it
+func drainHost(host client.Host, apiClient *client.RancherClient, timeout time.Duration, progress HostProgressFunc) error {
+	log.Infof("Evacuating host %s", host.Id)
+	if _, err := apiClient.Host.ActionEvacuate(&host); err != nil {
+		return fmt.Errorf("Cannot evacuate host: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining, err := remainingContainers(host.Id, apiClient)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			break
+		}
+		progress(hostProgress(host, HostDraining, fmt.Sprintf("%d containers left", remaining)))
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d containers still on the host after %v, it is left inactive", remaining, timeout)
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	log.Infof("Host %s drained, deleting it", host.Id)
+	if _, err := deleteHost(host.Id, apiClient); err != nil {
+		return err
+	}
+	return nil
+}
+
+//remainingContainers counts the containers on a host that aren't Rancher's own system containers
+func remainingContainers(hostID string, apiClient *client.RancherClient) (int, error) {
+	containers, err := apiClient.Container.List(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"hostId":       hostID,
+			"removed_null": true,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Cannot list containers of host: %v", err)
+	}
+
+	remaining := 0
+	for _, container := range containers.Data {
+		if container.HostId != hostID || container.System || container.Removed != "" {
+			continue
+		}
+		if _, ok := container.Labels["io.rancher.container.system"]; ok {
+			continue
+		}
+		switch container.State {
+		case "removing", "removed", "purging", "purged":
+			continue
+		}
+		remaining++
+	}
+	return remaining, nil
+}
+
+func hostProgress(host client.Host, state string, message string) model.HostProgress {
+	return model.HostProgress{
+		HostID:   host.Id,
+		Hostname: shortHostname(host),
+		State:    state,
+		Message:  message,
+	}
+}
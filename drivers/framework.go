@@ -18,6 +18,27 @@ type WebhookDriver interface {
 	CustomizeSchema(schema *v1client.Schema) *v1client.Schema
 }
 
+//HostProgressFunc receives the state of a host a driver works on. It may be called after Execute
+//returned, while the driver carries on in the background.
+type HostProgressFunc func(progress model.HostProgress)
+
+//ProgressDriver is implemented by drivers that report per-host progress of an execution
+type ProgressDriver interface {
+	ExecuteWithProgress(config interface{}, apiClient *client.RancherClient, requestBody interface{}, progress HostProgressFunc) (int, error)
+}
+
+//ServiceResultDriver is implemented by drivers that report the outcome of an execution per service
+type ServiceResultDriver interface {
+	ExecuteWithResults(config interface{}, apiClient *client.RancherClient, requestBody interface{}) ([]model.ServiceResult, int, error)
+}
+
+//TargetResolver is implemented by drivers whose config may name its target indirectly, such as by
+//stack and service name. ResolveTarget returns the config with the target it currently resolves to
+//filled in, and warnings about the reference, such as a selector matching several services.
+type TargetResolver interface {
+	ResolveTarget(config interface{}, apiClient *client.RancherClient) (interface{}, []string, error)
+}
+
 //RegisterDrivers creates object of type driver for every request
 func RegisterDrivers() {
 	Drivers = map[string]WebhookDriver{}
@@ -0,0 +1,142 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+//hostIdentityFields are host fields that are read only, or identify the original host, and so are
+//never copied to a clone
+var hostIdentityFields = []string{
+	"id", "uuid", "name", "hostname", "description", "created", "createdTS", "removed", "removeTime",
+	"state", "transitioning", "transitioningMessage", "transitioningProgress", "agentState", "agentId",
+	"agentIpAddress", "accountId", "physicalHostId", "computeTotal", "info", "instanceIds",
+	"publicEndpoints", "links", "actions", "baseType", "kind", "data",
+}
+
+//HostCloner creates hosts as copies of an existing host through the Rancher API, including the
+//machine driver config that client.Host doesn't carry
+type HostCloner struct {
+	Client *client.RancherClient
+}
+
+//CloneOptions are what sets a clone apart from the host it was copied from
+type CloneOptions struct {
+	Hostname string
+	//Labels are added to the copied labels, replacing labels with the same key
+	Labels map[string]string
+	//DriverConfig sets fields of the machine driver config, such as an amazonec2 instanceType
+	DriverConfig map[string]string
+}
+
+//Template reads a host and strips everything a clone shouldn't copy
+func (c *HostCloner) Template(hostID string) (map[string]interface{}, error) {
+	if c.Client == nil || c.Client.RancherBaseClient == nil {
+		return nil, fmt.Errorf("No Rancher client to clone host %s with", hostID)
+	}
+	raw := map[string]interface{}{}
+	if err := c.Client.ById("host", hostID, &raw); err != nil {
+		return nil, fmt.Errorf("Cannot get host %s to clone: %v", hostID, err)
+	}
+	if raw["id"] == nil {
+		return nil, fmt.Errorf("Host %s to clone does not exist", hostID)
+	}
+	return c.sanitize(raw), nil
+}
+
+//sanitize removes identity and read only fields, and any field the host schema doesn't allow
+//setting on create
+func (c *HostCloner) sanitize(raw map[string]interface{}) map[string]interface{} {
+	template := map[string]interface{}{}
+	for k, v := range raw {
+		template[k] = v
+	}
+	for _, field := range hostIdentityFields {
+		delete(template, field)
+	}
+
+	schema, ok := c.Client.GetTypes()["host"]
+	if !ok || len(schema.ResourceFields) == 0 {
+		return template
+	}
+	for k := range template {
+		if k == "type" {
+			continue
+		}
+		if field, ok := schema.ResourceFields[k]; !ok || !field.Create {
+			delete(template, k)
+		}
+	}
+	return template
+}
+
+//Clone creates a host from a template returned by Template and returns the new host's id
+func (c *HostCloner) Clone(template map[string]interface{}, opts CloneOptions) (string, error) {
+	if opts.Hostname == "" {
+		return "", fmt.Errorf("Hostname not provided for clone")
+	}
+
+	host := map[string]interface{}{}
+	for k, v := range template {
+		host[k] = v
+	}
+	host["name"] = ""
+	host["hostname"] = opts.Hostname
+
+	if len(opts.Labels) > 0 {
+		labels := map[string]interface{}{}
+		if existing, ok := host["labels"].(map[string]interface{}); ok {
+			for k, v := range existing {
+				labels[k] = v
+			}
+		}
+		for k, v := range opts.Labels {
+			labels[k] = v
+		}
+		host["labels"] = labels
+	}
+
+	if len(opts.DriverConfig) > 0 {
+		key, driverConfig, err := machineDriverConfig(host)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range opts.DriverConfig {
+			driverConfig[k] = v
+		}
+		host[key] = driverConfig
+	}
+
+	created := &client.Host{}
+	if err := c.Client.Create("host", host, created); err != nil {
+		return "", fmt.Errorf("Cannot create host %s: %v", opts.Hostname, err)
+	}
+	return created.Id, nil
+}
+
+//machineDriverConfig returns a copy of the driver config of a raw host, which is kept under the
+//driver's name followed by Config, for example amazonec2Config
+func machineDriverConfig(host map[string]interface{}) (string, map[string]interface{}, error) {
+	driver, _ := host["driver"].(string)
+	key := driver + "Config"
+	if driver == "" {
+		for k, v := range host {
+			if _, ok := v.(map[string]interface{}); ok && strings.HasSuffix(k, "Config") {
+				key = k
+				break
+			}
+		}
+	}
+
+	existing, ok := host[key].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("Host has no machine driver config to override")
+	}
+	driverConfig := map[string]interface{}{}
+	for k, v := range existing {
+		driverConfig[k] = v
+	}
+	return key, driverConfig, nil
+}
@@ -0,0 +1,89 @@
+package drivers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestHostCloner(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	hostID := server.Add("1a5", "host", map[string]interface{}{
+		"uuid":             "abc",
+		"name":             "web1",
+		"hostname":         "web1.example.com",
+		"agentState":       "active",
+		"computeTotal":     1000,
+		"driver":           "amazonec2",
+		"engineInstallUrl": "https://get.docker.com",
+		"labels":           map[string]interface{}{"role": "web", "zone": "a"},
+		"amazonec2Config":  map[string]interface{}{"instanceType": "t2.micro", "region": "us-west-2"},
+	})
+
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloner := &HostCloner{Client: apiClient}
+
+	template, err := cloner.Template(hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"id", "uuid", "hostname", "state", "agentState", "computeTotal", "accountId"} {
+		if _, ok := template[field]; ok {
+			t.Errorf("Field %s was copied to the clone template", field)
+		}
+	}
+
+	id, err := cloner.Clone(template, CloneOptions{
+		Hostname:     "web2",
+		Labels:       map[string]string{"zone": "b", "scaled": "true"},
+		DriverConfig: map[string]string{"instanceType": "m4.large"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := server.Get("host", id)
+	if body == nil {
+		t.Fatalf("Clone %s was not created", id)
+	}
+	if body["hostname"] != "web2" || body["name"] != "" {
+		t.Errorf("Unexpected name of clone %v %v", body["name"], body["hostname"])
+	}
+	expectedLabels := map[string]interface{}{"role": "web", "zone": "b", "scaled": "true"}
+	if !reflect.DeepEqual(body["labels"], expectedLabels) {
+		t.Errorf("Unexpected labels of clone %v", body["labels"])
+	}
+	expectedConfig := map[string]interface{}{"instanceType": "m4.large", "region": "us-west-2"}
+	if !reflect.DeepEqual(body["amazonec2Config"], expectedConfig) {
+		t.Errorf("Unexpected driver config of clone %v", body["amazonec2Config"])
+	}
+	if body["engineInstallUrl"] != "https://get.docker.com" {
+		t.Errorf("Creatable field engineInstallUrl was not copied")
+	}
+	if body["state"] != "provisioning" || body["id"] == hostID {
+		t.Errorf("Unexpected clone %v in state %v", body["id"], body["state"])
+	}
+
+	//The template is left as it was for the next clone
+	if labels := template["labels"].(map[string]interface{}); labels["zone"] != "a" {
+		t.Errorf("Clone changed the template's labels %v", labels)
+	}
+
+	if _, err := cloner.Template("1h404"); err == nil {
+		t.Error("Expected an error cloning a host that doesn't exist")
+	}
+	if _, err := cloner.Clone(template, CloneOptions{}); err == nil {
+		t.Error("Expected an error cloning without a hostname")
+	}
+	noDriver := map[string]interface{}{"type": "host", "labels": map[string]interface{}{}}
+	if _, err := cloner.Clone(noDriver, CloneOptions{Hostname: "web3", DriverConfig: map[string]string{"a": "b"}}); err == nil {
+		t.Error("Expected an error overriding the driver config of a host without one")
+	}
+	if _, err := (&HostCloner{}).Template(hostID); err == nil {
+		t.Error("Expected an error cloning without a client")
+	}
+}
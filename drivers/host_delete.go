@@ -0,0 +1,221 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+//deleteOptions are the strategies for picking the hosts removed by a scale down
+var deleteOptions = []string{"mostRecent", "leastRecent", "fewestContainers", "labelPriority"}
+
+//deletePolicy decides which hosts a scale down removes
+type deletePolicy struct {
+	//option is one of deleteOptions
+	option string
+	//priority is the label of hosts removed first with labelPriority
+	priority hostLabel
+	//protected is the label of hosts that are never removed
+	protected hostLabel
+	//containers counts the non-system containers of each host for fewestContainers
+	containers map[string]int
+}
+
+//hostLabel matches hosts carrying a label, with a given value if one is set
+type hostLabel struct {
+	key   string
+	value string
+}
+
+//parseHostLabel reads a label given as key or key=value
+func parseHostLabel(label string) (hostLabel, error) {
+	if label == "" {
+		return hostLabel{}, nil
+	}
+	parts := strings.SplitN(label, "=", 2)
+	result := hostLabel{key: strings.TrimSpace(parts[0])}
+	if len(parts) == 2 {
+		result.value = strings.TrimSpace(parts[1])
+	}
+	if result.key == "" {
+		return hostLabel{}, fmt.Errorf("Invalid label %q, expected key or key=value", label)
+	}
+	return result, nil
+}
+
+func (l hostLabel) matches(host client.Host) bool {
+	if l.key == "" {
+		return false
+	}
+	for k, v := range host.Labels {
+		if !strings.EqualFold(k, l.key) {
+			continue
+		}
+		if l.value == "" {
+			return true
+		}
+		value, ok := v.(string)
+		return ok && strings.EqualFold(value, l.value)
+	}
+	return false
+}
+
+//validateDeleteOptions checks the scale down settings of a config
+func validateDeleteOptions(config model.ScaleHost) (int, error) {
+	if config.Action == "up" {
+		if config.DeleteOption != "" {
+			return http.StatusBadRequest, fmt.Errorf("Delete option not to be provided while scaling up")
+		}
+		if config.DeletePriorityLabel != "" || config.ProtectedLabel != "" {
+			return http.StatusBadRequest, fmt.Errorf("deletePriorityLabel and protectedLabel not to be provided while scaling up")
+		}
+		return http.StatusOK, nil
+	}
+
+	valid := false
+	for _, option := range deleteOptions {
+		valid = valid || config.DeleteOption == option
+	}
+	if !valid {
+		return http.StatusBadRequest, fmt.Errorf("Invalid delete option/Delete option missing %v", config.DeleteOption)
+	}
+
+	if config.DeleteOption == "labelPriority" && config.DeletePriorityLabel == "" {
+		return http.StatusBadRequest, fmt.Errorf("deletePriorityLabel is required with delete option labelPriority")
+	}
+	if config.DeleteOption != "labelPriority" && config.DeletePriorityLabel != "" {
+		return http.StatusBadRequest, fmt.Errorf("deletePriorityLabel can only be provided with delete option labelPriority")
+	}
+	for _, label := range []string{config.DeletePriorityLabel, config.ProtectedLabel} {
+		if _, err := parseHostLabel(label); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+//newDeletePolicy builds the policy of a config, counting containers when the option needs them
+func newDeletePolicy(config *model.ScaleHost, hosts []client.Host, apiClient *client.RancherClient) (deletePolicy, error) {
+	policy := deletePolicy{option: config.DeleteOption}
+	var err error
+	if policy.priority, err = parseHostLabel(config.DeletePriorityLabel); err != nil {
+		return policy, err
+	}
+	if policy.protected, err = parseHostLabel(config.ProtectedLabel); err != nil {
+		return policy, err
+	}
+
+	if policy.option == "fewestContainers" {
+		policy.containers = map[string]int{}
+		for _, host := range hosts {
+			if policy.protected.matches(host) {
+				continue
+			}
+			count, err := remainingContainers(host.Id, apiClient)
+			if err != nil {
+				return policy, err
+			}
+			policy.containers[host.Id] = count
+		}
+	}
+	return policy, nil
+}
+
+//hostsToDelete picks the hosts to remove when scaling a group down by amount. Hosts with the
+//protected label are never picked. Unhealthy hosts go first, then with labelPriority the hosts
+//with the priority label, and then by the delete option. When templates are configured, weights is
+//set and the choice is made within the template most populated for its weight. Hosts are in the order
+//they were listed, most recently created first.
+func hostsToDelete(hosts []client.Host, amount int64, policy deletePolicy, weights map[string]int64) ([]client.Host, error) {
+	now := time.Now()
+	victims := []client.Host{}
+	prioritized := []client.Host{}
+	remaining := []client.Host{}
+	for _, host := range hosts {
+		switch {
+		case policy.protected.matches(host):
+			log.Debugf("Not deleting host %s, it is protected", host.Id)
+		case classifyHost(host, now) == hostUnhealthy:
+			if int64(len(victims)) >= amount {
+				return nil, fmt.Errorf("Cannot scale down exceed amount")
+			}
+			log.Infof("Deleting host %s with priority because of bad state: %s", host.Id, host.State)
+			victims = append(victims, host)
+		case policy.option == "labelPriority" && policy.priority.matches(host):
+			prioritized = append(prioritized, host)
+		default:
+			remaining = append(remaining, host)
+		}
+	}
+
+	if int64(len(victims)+len(prioritized)+len(remaining)) < amount {
+		return nil, fmt.Errorf("Cannot scale down by %d, only %d hosts are not protected", amount,
+			len(victims)+len(prioritized)+len(remaining))
+	}
+
+	for _, candidates := range []*[]client.Host{&prioritized, &remaining} {
+		for int64(len(victims)) < amount && len(*candidates) > 0 {
+			inZone := func(client.Host) bool { return true }
+			if len(weights) > 0 {
+				zone := mostPopulatedTemplate(*candidates, weights)
+				inZone = func(host client.Host) bool { return host.HostTemplateId == zone }
+			}
+			index := policy.pick(*candidates, inZone)
+			victims = append(victims, (*candidates)[index])
+			*candidates = append((*candidates)[:index], (*candidates)[index+1:]...)
+		}
+	}
+	return victims, nil
+}
+
+//pick returns the index of the host to remove next among the candidates in the zone
+func (p deletePolicy) pick(candidates []client.Host, inZone func(client.Host) bool) int {
+	index := -1
+	for i, host := range candidates {
+		if !inZone(host) {
+			continue
+		}
+		switch {
+		case index == -1:
+			index = i
+		case p.option == "leastRecent":
+			index = i
+		case p.option == "fewestContainers" && p.containers[host.Id] < p.containers[candidates[index].Id]:
+			index = i
+		}
+	}
+	return index
+}
+
+//mostPopulatedTemplate returns the template with the most hosts for its weight, the larger count
+//winning ties. Hosts outside any template, as with a hostSelector, share one zone.
+func mostPopulatedTemplate(hosts []client.Host, weights map[string]int64) string {
+	counts := map[string]int64{}
+	order := []string{}
+	for _, host := range hosts {
+		if _, ok := counts[host.HostTemplateId]; !ok {
+			order = append(order, host.HostTemplateId)
+		}
+		counts[host.HostTemplateId]++
+	}
+
+	weight := func(id string) int64 {
+		if w := weights[id]; w > 0 {
+			return w
+		}
+		return 1
+	}
+	best := order[0]
+	for _, id := range order[1:] {
+		lhs, rhs := counts[id]*weight(best), counts[best]*weight(id)
+		if lhs > rhs || (lhs == rhs && counts[id] > counts[best]) {
+			best = id
+		}
+	}
+	return best
+}
@@ -0,0 +1,112 @@
+package drivers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+func TestHostsToDelete(t *testing.T) {
+	host := func(id, template, state string, labels ...string) client.Host {
+		h := client.Host{HostTemplateId: template, State: state, Labels: map[string]interface{}{}}
+		h.Id = id
+		for _, label := range labels {
+			h.Labels[label] = "true"
+		}
+		return h
+	}
+	// most recently created first
+	hosts := []client.Host{
+		host("a1", "a", "active"),
+		host("b1", "b", "active", "drain-first"),
+		host("a2", "a", "disconnected"),
+		host("b2", "b", "active", "protected"),
+		host("a3", "a", "active", "drain-first"),
+		host("b3", "b", "active"),
+		host("a4", "a", "active", "protected"),
+	}
+	containers := map[string]int{"a1": 4, "b1": 2, "a3": 1, "b3": 1}
+	priority := hostLabel{key: "drain-first", value: "true"}
+	protected := hostLabel{key: "protected"}
+
+	tests := []struct {
+		amount   int64
+		policy   deletePolicy
+		weights  map[string]int64
+		expected []string
+	}{
+		{1, deletePolicy{option: "mostRecent"}, nil, []string{"a2"}},
+		{2, deletePolicy{option: "mostRecent"}, nil, []string{"a2", "a1"}},
+		{3, deletePolicy{option: "mostRecent"}, nil, []string{"a2", "a1", "b1"}},
+		{3, deletePolicy{option: "leastRecent"}, nil, []string{"a2", "a4", "b3"}},
+		{2, deletePolicy{option: "leastRecent"}, map[string]int64{"a": 3, "b": 1}, []string{"a2", "b3"}},
+		{3, deletePolicy{option: "leastRecent", protected: protected}, nil, []string{"a2", "b3", "a3"}},
+		{3, deletePolicy{option: "fewestContainers", protected: protected, containers: containers}, nil, []string{"a2", "a3", "b3"}},
+		{4, deletePolicy{option: "fewestContainers", protected: protected, containers: containers}, nil, []string{"a2", "a3", "b3", "b1"}},
+		{3, deletePolicy{option: "labelPriority", priority: priority, protected: protected}, nil, []string{"a2", "b1", "a3"}},
+		{4, deletePolicy{option: "labelPriority", priority: priority, protected: protected}, nil, []string{"a2", "b1", "a3", "a1"}},
+	}
+	for _, test := range tests {
+		victims, err := hostsToDelete(hosts, test.amount, test.policy, test.weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, victim := range victims {
+			ids = append(ids, victim.Id)
+		}
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("Deleting %d with %+v and weights %v picked %v, expected %v", test.amount, test.policy,
+				test.weights, ids, test.expected)
+		}
+	}
+
+	if _, err := hostsToDelete(hosts, 6, deletePolicy{option: "mostRecent", protected: protected}, nil); err == nil {
+		t.Fatal("Expected protected hosts to be left out")
+	}
+
+	// without templates the default order is newest first whatever template the hosts came from
+	mixed := []client.Host{host("b1", "b", "active"), host("a1", "a", "active"), host("a2", "a", "active"), host("a3", "a", "active")}
+	victims, err := hostsToDelete(mixed, 2, deletePolicy{option: "mostRecent"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(victims) != 2 || victims[0].Id != "b1" || victims[1].Id != "a1" {
+		t.Fatalf("Expected b1 and a1 to be deleted newest first, got %v", victims)
+	}
+
+	unhealthy := []client.Host{host("a1", "a", "inactive"), host("a2", "a", "reconnecting")}
+	if _, err := hostsToDelete(unhealthy, 1, deletePolicy{option: "mostRecent"}, nil); err == nil {
+		t.Fatal("Expected more unhealthy hosts than amount to be rejected")
+	}
+	unhealthy[1].Labels = map[string]interface{}{"protected": "yes"}
+	if _, err := hostsToDelete(unhealthy, 1, deletePolicy{option: "mostRecent", protected: protected}, nil); err != nil {
+		t.Fatalf("Expected protected unhealthy host to be left alone, got %v", err)
+	}
+}
+
+func TestValidateDeleteOptions(t *testing.T) {
+	tests := []struct {
+		config model.ScaleHost
+		valid  bool
+	}{
+		{model.ScaleHost{Action: "up"}, true},
+		{model.ScaleHost{Action: "up", DeleteOption: "mostRecent"}, false},
+		{model.ScaleHost{Action: "up", ProtectedLabel: "keep"}, false},
+		{model.ScaleHost{Action: "down", DeleteOption: "fewestContainers", ProtectedLabel: "keep=true"}, true},
+		{model.ScaleHost{Action: "down", DeleteOption: "labelPriority", DeletePriorityLabel: "spot=true"}, true},
+		{model.ScaleHost{Action: "down", DeleteOption: "labelPriority"}, false},
+		{model.ScaleHost{Action: "down", DeleteOption: "mostRecent", DeletePriorityLabel: "spot"}, false},
+		{model.ScaleHost{Action: "down", DeleteOption: "mostRecent", ProtectedLabel: "=true"}, false},
+		{model.ScaleHost{Action: "down", DeleteOption: "random"}, false},
+		{model.ScaleHost{Action: "down"}, false},
+	}
+	for _, test := range tests {
+		_, err := validateDeleteOptions(test.config)
+		if (err == nil) != test.valid {
+			t.Errorf("validateDeleteOptions(%+v) returned %v", test.config, err)
+		}
+	}
+}
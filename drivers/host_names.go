@@ -0,0 +1,224 @@
+package drivers
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+//maxNameAttempts bounds how many names in use are skipped before giving up on a new host
+const maxNameAttempts = 1000
+
+var validHostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+//hostnameData is what a hostnameTemplate is rendered with
+type hostnameData struct {
+	//Zone is the host template's name, lowercased with anything other than letters and digits
+	//replaced by '-'. It is empty for groups chosen by hostSelector.
+	Zone string
+	//Template is the host template's id
+	Template string
+	//Index is the position of the new host in its template's sequence, starting at 1
+	Index int64
+}
+
+//hostNamer produces the names of new hosts for a group of hosts, such as the hosts of one template.
+//Names already used by any host are skipped.
+type hostNamer struct {
+	//hostnameTemplate and data name hosts when a hostnameTemplate is configured
+	hostnameTemplate *template.Template
+	data             hostnameData
+
+	//prefix, suffix and hasBase continue the name sequence of a base host otherwise
+	prefix  string
+	suffix  string
+	hasBase bool
+
+	used map[string]bool
+}
+
+//newHostNamer takes the least recently created host with a driver as the base host, or defaultBase
+//when there is none. Names are the base host's name without its domain and trailing digits,
+//followed by a number one past the largest used by a host with the same prefix.
+func newHostNamer(hosts []client.Host, defaultBase string, used map[string]bool) *hostNamer {
+	baseHostIndex := -1
+	for i, host := range hosts {
+		if host.Driver != "" {
+			baseHostIndex = i
+		}
+	}
+
+	baseHostName := defaultBase
+	if baseHostIndex != -1 {
+		baseHostName = shortHostname(hosts[baseHostIndex])
+	}
+	basePrefix := strings.TrimSuffix(baseHostName, re.FindString(baseHostName))
+
+	// Only hosts named exactly prefix and digits continue the sequence, so web1 doesn't pick up
+	// webserver7. The largest suffix wins, keeping its zero padding.
+	suffix := ""
+	largest := int64(-1)
+	for _, host := range hosts {
+		name := shortHostname(host)
+		if !strings.HasPrefix(name, basePrefix) {
+			continue
+		}
+		currSuffix := name[len(basePrefix):]
+		if currSuffix == "" || re.FindString(currSuffix) != currSuffix {
+			continue
+		}
+		number, err := strconv.ParseInt(currSuffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if number > largest {
+			largest, suffix = number, currSuffix
+		}
+	}
+
+	return &hostNamer{prefix: basePrefix, suffix: suffix, hasBase: baseHostIndex != -1, used: used}
+}
+
+//newTemplateHostNamer names hosts with a hostnameTemplate, counting on from the existing hosts
+func newTemplateHostNamer(hostnameTemplate string, data hostnameData, existing int64, used map[string]bool) (*hostNamer, error) {
+	tmpl, err := parseHostnameTemplate(hostnameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	data.Index = existing
+	return &hostNamer{hostnameTemplate: tmpl, data: data, used: used}, nil
+}
+
+//next returns the next name not already in use
+func (n *hostNamer) next() (string, error) {
+	name := ""
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		var err error
+		if n.hostnameTemplate != nil {
+			n.data.Index++
+			name, err = renderHostname(n.hostnameTemplate, n.data)
+		} else {
+			name, err = n.nextInSequence()
+		}
+		if err != nil {
+			return "", err
+		}
+		if !n.used[strings.ToLower(name)] {
+			if n.used != nil {
+				n.used[strings.ToLower(name)] = true
+			}
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find a hostname that is not in use, last tried %s", name)
+}
+
+//nextInSequence increments the suffix by 1 if it exists, otherwise the first clone of a base host
+//gets '2' and the first host of an empty group gets '1'
+func (n *hostNamer) nextInSequence() (string, error) {
+	var currNameSuffix string
+	if n.suffix != "" {
+		prevNumber, err := strconv.ParseInt(n.suffix, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("Error converting %s to int in scaleHost driver: %v", n.suffix, err)
+		}
+		currNameSuffix = leftPad(strconv.FormatInt(prevNumber+1, 10), "0", len(n.suffix))
+	} else if !n.hasBase {
+		currNameSuffix = "1"
+	} else {
+		currNameSuffix = "2"
+	}
+	n.suffix = currNameSuffix
+	return n.prefix + currNameSuffix, nil
+}
+
+func parseHostnameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("hostname").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hostnameTemplate: %v", err)
+	}
+	return tmpl, nil
+}
+
+func renderHostname(tmpl *template.Template, data hostnameData) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("Invalid hostnameTemplate: %v", err)
+	}
+	name := buf.String()
+	if !validHostname.MatchString(name) {
+		return "", fmt.Errorf("Invalid hostnameTemplate, %q is not a valid hostname", name)
+	}
+	return name, nil
+}
+
+//validateHostnameTemplate checks that a hostnameTemplate parses and renders a valid hostname
+func validateHostnameTemplate(text string) error {
+	tmpl, err := parseHostnameTemplate(text)
+	if err != nil {
+		return err
+	}
+	_, err = renderHostname(tmpl, hostnameData{Zone: "zone", Template: "1ht1", Index: 1})
+	return err
+}
+
+//usedHostnames collects the names, without domain, of all hosts that haven't been removed
+func usedHostnames(hosts []client.Host) map[string]bool {
+	used := map[string]bool{}
+	for _, host := range hosts {
+		if host.Removed != "" {
+			continue
+		}
+		for _, name := range []string{host.Name, host.Hostname} {
+			if name != "" {
+				used[strings.ToLower(strings.Split(name, ".")[0])] = true
+			}
+		}
+	}
+	return used
+}
+
+//shortHostname is the host's name, or its hostname if it has none, without domain.
+//Name has precedence over hostname.
+func shortHostname(host client.Host) string {
+	name := host.Name
+	if name == "" {
+		name = host.Hostname
+	}
+	return strings.Split(name, ".")[0]
+}
+
+//templateZone is the name of a template usable in hostnames
+func templateZone(t scaleTemplate) string {
+	name := ""
+	if t.template != nil {
+		name = t.template.Name
+	}
+	if name == "" {
+		name = t.id
+	}
+
+	zone := []rune{}
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			zone = append(zone, c)
+		} else if len(zone) > 0 && zone[len(zone)-1] != '-' {
+			zone = append(zone, '-')
+		}
+	}
+	return strings.TrimRight(string(zone), "-")
+}
+
+//templateHostPrefix is the name used for the first host of a template in a group of several
+//templates, so each template starts its own sequence
+func templateHostPrefix(t scaleTemplate) string {
+	if zone := templateZone(t); zone != "" {
+		return zone + "-"
+	}
+	return "scaledhost-"
+}
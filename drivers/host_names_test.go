@@ -0,0 +1,105 @@
+package drivers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+func TestHostNamer(t *testing.T) {
+	host := func(hostname string) client.Host {
+		return client.Host{Hostname: hostname, Driver: "amazonec2"}
+	}
+	custom := func(hostname string) client.Host {
+		return client.Host{Hostname: hostname}
+	}
+
+	// hosts are listed most recently created first, the last host with a driver is the base host
+	tests := []struct {
+		name        string
+		hosts       []client.Host
+		defaultBase string
+		used        []string
+		expected    []string
+	}{
+		{"empty group", nil, "scaledhost", nil, []string{"scaledhost1", "scaledhost2"}},
+		{"base without suffix", []client.Host{host("web")}, "", nil, []string{"web2", "web3"}},
+		{"domain is dropped", []client.Host{host("web3.example.com"), host("web2.example.com")}, "", nil, []string{"web4"}},
+		{"zero padding is kept", []client.Host{host("web-009"), host("web-001")}, "", nil, []string{"web-010", "web-011"}},
+		{"padding grows", []client.Host{host("web9")}, "", nil, []string{"web10"}},
+		{"digits in prefix", []client.Host{host("web1-05"), host("web1-04")}, "", nil, []string{"web1-06"}},
+		{"name wins over hostname", []client.Host{{Name: "db7", Hostname: "ip-10-0-0-1", Driver: "amazonec2"}}, "", nil, []string{"db8"}},
+		{"other sequences are ignored", []client.Host{host("webserver7"), host("web-db9"), host("web2")}, "", nil, []string{"web3"}},
+		{"largest suffix wins", []client.Host{host("web3"), host("web12"), host("web1")}, "", nil, []string{"web13"}},
+		{"custom hosts are not a base", []client.Host{custom("node5"), host("web1")}, "", nil, []string{"web2"}},
+		{"names in use are skipped", []client.Host{host("web1")}, "", []string{"web2", "WEB3"}, []string{"web4", "web5"}},
+		{"suffix not repeating trailing characters", []client.Host{host("app-1")}, "", nil, []string{"app-2"}},
+	}
+	for _, test := range tests {
+		// hosts outside the group still hold their names
+		all := append([]client.Host{}, test.hosts...)
+		for _, name := range test.used {
+			all = append(all, custom(name))
+		}
+		namer := newHostNamer(test.hosts, test.defaultBase, usedHostnames(all))
+		names := []string{}
+		for range test.expected {
+			name, err := namer.next()
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			names = append(names, name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, names, test.expected)
+		}
+	}
+}
+
+func TestHostnameTemplate(t *testing.T) {
+	used := map[string]bool{"web-us-east-1-003": true}
+	namer, err := newTemplateHostNamer(`web-{{.Zone}}-{{.Index | printf "%03d"}}`,
+		hostnameData{Zone: "us-east-1", Template: "1ht1"}, 1, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for i := 0; i < 3; i++ {
+		name, err := namer.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	expected := []string{"web-us-east-1-002", "web-us-east-1-004", "web-us-east-1-005"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Got %v, expected %v", names, expected)
+	}
+
+	namer, err = newTemplateHostNamer(`static`, hostnameData{}, 0, map[string]bool{"static": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := namer.next(); err == nil {
+		t.Fatal("Expected a template without an index to run out of names")
+	}
+
+	for _, text := range []string{`{{.Index`, `{{.Missing}}`, `web_{{.Index}}`, `-{{.Index}}`, ``} {
+		if err := validateHostnameTemplate(text); err == nil {
+			t.Errorf("Expected hostnameTemplate %q to be rejected", text)
+		}
+	}
+	if err := validateHostnameTemplate(`{{.Zone}}-{{.Index}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := templateHostPrefix(scaleTemplate{id: "1ht2", template: &client.HostTemplate{Name: "AWS us-east-1"}})
+	if prefix != "aws-us-east-1-" {
+		t.Fatalf("Unexpected prefix %q", prefix)
+	}
+	namer = newHostNamer(nil, prefix, nil)
+	if name, _ := namer.next(); name != "aws-us-east-1-1" {
+		t.Fatalf("Unexpected first name %q", name)
+	}
+}
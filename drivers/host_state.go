@@ -0,0 +1,211 @@
+package drivers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+//Hosts in a scaling group are handled according to their state:
+//
+//	provisioning  requested, registering, provisioning, creating, bootstrapping, activating.
+//	              While any host of the group is provisioning, or was created by an earlier execution
+//	              and isn't listed yet, the group is not scaled again and Execute returns 409.
+//	unhealthy     inactive, deactivating, reconnecting, disconnected. Counted towards min and max,
+//	              and deleted first when scaling down.
+//	ignored       error, erroring, removing, removed, purging, purged, or anything with removed set.
+//	              Not counted and never deleted.
+//	active        any other state. Counted towards min and max.
+//
+//A host that has been provisioning for longer than hostProvisioningTimeout is treated as stuck and
+//ignored, so a single failed create can't block a group forever.
+type hostClass int
+
+const (
+	hostActive hostClass = iota
+	hostUnhealthy
+	hostProvisioning
+	hostIgnored
+)
+
+const (
+	hostProvisioningTimeout = 30 * time.Minute
+	//hostListGrace is how long a host created by an earlier execution may be missing from the host list
+	hostListGrace = 2 * time.Minute
+)
+
+func classifyHost(host client.Host, now time.Time) hostClass {
+	if host.Removed != "" {
+		return hostIgnored
+	}
+	switch host.State {
+	case "requested", "registering", "provisioning", "creating", "bootstrapping", "activating":
+		if created, err := time.Parse(time.RFC3339, host.Created); err == nil && now.Sub(created) > hostProvisioningTimeout {
+			return hostIgnored
+		}
+		return hostProvisioning
+	case "inactive", "deactivating", "reconnecting", "disconnected":
+		return hostUnhealthy
+	case "error", "erroring", "removing", "removed", "purging", "purged":
+		return hostIgnored
+	}
+	return hostActive
+}
+
+//hostGroup serializes executions against one scaling group and remembers the hosts this process
+//created for it until they show up in the host list with a settled state, as well as the hosts it
+//is draining, which are no longer counted as part of the group. A group is forgotten once nothing
+//holds it and it has no hosts pending or draining, so deleted receivers don't leave groups behind.
+type hostGroup struct {
+	sync.Mutex
+	key string
+	//users counts the executions and background drains holding the group, guarded by hostGroups
+	users    int
+	pending  map[string]time.Time
+	draining map[string]bool
+}
+
+var hostGroups = struct {
+	sync.Mutex
+	groups map[string]*hostGroup
+}{groups: map[string]*hostGroup{}}
+
+//lockHostGroup returns the locked group for key, the caller must release it with unlock
+func lockHostGroup(key string) *hostGroup {
+	hostGroups.Lock()
+	sweepHostGroups(time.Now())
+	group, ok := hostGroups.groups[key]
+	if !ok {
+		group = &hostGroup{key: key, pending: map[string]time.Time{}, draining: map[string]bool{}}
+		hostGroups.groups[key] = group
+	}
+	group.users++
+	hostGroups.Unlock()
+
+	group.Lock()
+	return group
+}
+
+//unlock unlocks a group locked by lockHostGroup and releases it
+func (g *hostGroup) unlock() {
+	g.Unlock()
+	g.release()
+}
+
+//hold keeps the group from being forgotten while work started under its lock goes on in the
+//background, which must call release when done
+func (g *hostGroup) hold() {
+	hostGroups.Lock()
+	defer hostGroups.Unlock()
+	g.users++
+}
+
+//release drops a hold on the group and forgets the group once nothing holds it and it's idle
+func (g *hostGroup) release() {
+	hostGroups.Lock()
+	defer hostGroups.Unlock()
+	g.users--
+	if g.users == 0 && g.idle(time.Now()) && hostGroups.groups[g.key] == g {
+		delete(hostGroups.groups, g.key)
+	}
+}
+
+//idle reports whether the group has nothing worth remembering. Hosts pending for longer than
+//hostProvisioningTimeout would be ignored anyway. It may only be called with hostGroups locked on a
+//group nothing holds.
+func (g *hostGroup) idle(now time.Time) bool {
+	if len(g.draining) != 0 {
+		return false
+	}
+	for _, created := range g.pending {
+		if now.Sub(created) <= hostProvisioningTimeout {
+			return false
+		}
+	}
+	return true
+}
+
+//sweepHostGroups forgets the groups that became idle since they were released, such as groups
+//whose created hosts were never seen again. hostGroups must be locked.
+func sweepHostGroups(now time.Time) {
+	for key, group := range hostGroups.groups {
+		if group.users == 0 && group.idle(now) {
+			delete(hostGroups.groups, key)
+		}
+	}
+}
+
+//hostGroupKey identifies a scaling group. The client's URL is included because it is scoped to a
+//project, and host selectors are only unique within one.
+func hostGroupKey(apiClient *client.RancherClient, config *model.ScaleHost) string {
+	project := ""
+	if apiClient.RancherBaseClient != nil && apiClient.GetOpts() != nil {
+		project = apiClient.GetOpts().Url
+	}
+	if templates := configuredTemplates(*config); len(templates) > 0 {
+		ids := []string{}
+		for _, t := range templates {
+			ids = append(ids, t.HostTemplateID)
+		}
+		sort.Strings(ids)
+		return project + "|hostTemplates:" + strings.Join(ids, ",")
+	}
+	selector := []string{}
+	for k, v := range config.HostSelector {
+		selector = append(selector, strings.ToLower(k)+"="+strings.ToLower(v))
+	}
+	sort.Strings(selector)
+	return project + "|hostSelector:" + strings.Join(selector, ",")
+}
+
+//created records a host created by the current execution
+func (g *hostGroup) created(hostID string) {
+	if hostID != "" {
+		g.pending[hostID] = time.Now()
+	}
+}
+
+//members applies the state policy to the hosts matching the group, which must be in the order they
+//were listed in. It returns the hosts to scale with and an error if creations are still in flight.
+func (g *hostGroup) members(matching []client.Host) ([]client.Host, error) {
+	now := time.Now()
+	listed := map[string]bool{}
+	members := []client.Host{}
+	provisioning := 0
+	for _, host := range matching {
+		listed[host.Id] = true
+		if g.draining[host.Id] {
+			continue
+		}
+		switch classifyHost(host, now) {
+		case hostProvisioning:
+			provisioning++
+		case hostIgnored:
+			delete(g.pending, host.Id)
+		default:
+			delete(g.pending, host.Id)
+			members = append(members, host)
+		}
+	}
+
+	for id, created := range g.pending {
+		if listed[id] {
+			continue
+		}
+		if now.Sub(created) > hostListGrace {
+			delete(g.pending, id)
+			continue
+		}
+		provisioning++
+	}
+
+	if provisioning > 0 {
+		return nil, fmt.Errorf("%d hosts from an earlier scale are still provisioning, try again once they are active", provisioning)
+	}
+	return members, nil
+}
@@ -0,0 +1,98 @@
+package drivers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+func TestHostGroupMembers(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * hostProvisioningTimeout).Format(time.RFC3339)
+	hosts := func(states ...string) []client.Host {
+		result := []client.Host{}
+		for i, state := range states {
+			host := client.Host{State: state, Created: now.Format(time.RFC3339)}
+			host.Id = string('a' + rune(i))
+			result = append(result, host)
+		}
+		return result
+	}
+
+	group := &hostGroup{pending: map[string]time.Time{}, draining: map[string]bool{}}
+	members, err := group.members(hosts("active", "error", "inactive", "removing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].Id != "a" || members[1].Id != "c" {
+		t.Fatalf("Unexpected members %#v", members)
+	}
+
+	if _, err := group.members(hosts("active", "provisioning")); err == nil {
+		t.Fatal("Expected a provisioning host to block scaling")
+	}
+
+	stuck := hosts("active", "provisioning")
+	stuck[1].Created = old
+	if members, err := group.members(stuck); err != nil || len(members) != 1 {
+		t.Fatalf("Expected a stuck host to be ignored, got %v, %v", members, err)
+	}
+
+	group.created("new")
+	if _, err := group.members(hosts("active")); err == nil {
+		t.Fatal("Expected a created host that isn't listed yet to block scaling")
+	}
+	if _, err := group.members(append(hosts("active"), client.Host{Resource: client.Resource{Id: "new"}, State: "active"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(group.pending) != 0 {
+		t.Fatalf("Expected active host to be forgotten, pending %v", group.pending)
+	}
+
+	group.pending["lost"] = now.Add(-2 * hostListGrace)
+	if _, err := group.members(hosts("active")); err != nil || len(group.pending) != 0 {
+		t.Fatalf("Expected a host missing past the grace period to be forgotten, got %v", err)
+	}
+}
+
+func TestHostGroupsAreForgotten(t *testing.T) {
+	known := func(key string) bool {
+		hostGroups.Lock()
+		defer hostGroups.Unlock()
+		_, ok := hostGroups.groups[key]
+		return ok
+	}
+
+	group := lockHostGroup("test|idle")
+	group.unlock()
+	if known("test|idle") {
+		t.Fatal("Expected an idle group to be forgotten")
+	}
+
+	group = lockHostGroup("test|draining")
+	group.draining["h1"] = true
+	group.hold()
+	group.unlock()
+	if !known("test|draining") {
+		t.Fatal("Expected a group with a draining host to be kept")
+	}
+	group.Lock()
+	delete(group.draining, "h1")
+	group.unlock()
+	if known("test|draining") {
+		t.Fatal("Expected the group to be forgotten once its drain finished")
+	}
+
+	group = lockHostGroup("test|pending")
+	group.created("h2")
+	group.unlock()
+	if !known("test|pending") {
+		t.Fatal("Expected a group with a pending host to be kept")
+	}
+	group.pending["h2"] = time.Now().Add(-2 * hostProvisioningTimeout)
+	lockHostGroup("test|other").unlock()
+	if known("test|pending") {
+		t.Fatal("Expected a group whose pending host timed out to be swept")
+	}
+}
@@ -0,0 +1,89 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+//scaleTemplate is one host template of a scaling group, usually one per zone or instance type
+type scaleTemplate struct {
+	id       string
+	weight   int64
+	template *client.HostTemplate
+}
+
+//configuredTemplates returns the templates of a config, either its hostTemplates or the single
+//hostTemplateId with weight 1. A weight of 0 means it was left out and is taken as 1.
+func configuredTemplates(config model.ScaleHost) []model.HostTemplateWeight {
+	if len(config.HostTemplates) == 0 {
+		if config.HostTemplateID == "" {
+			return nil
+		}
+		return []model.HostTemplateWeight{{HostTemplateID: config.HostTemplateID, Weight: 1}}
+	}
+	templates := []model.HostTemplateWeight{}
+	for _, t := range config.HostTemplates {
+		if t.Weight == 0 {
+			t.Weight = 1
+		}
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+//validateHostTemplates checks the template list of a config without looking the templates up
+func validateHostTemplates(config model.ScaleHost) (int, error) {
+	if config.HostTemplateID != "" && len(config.HostTemplates) > 0 {
+		return http.StatusBadRequest, fmt.Errorf("Only one of hostTemplateId and hostTemplates can be provided")
+	}
+
+	seen := map[string]bool{}
+	for _, t := range config.HostTemplates {
+		if t.HostTemplateID == "" {
+			return http.StatusBadRequest, fmt.Errorf("hostTemplateId is not provided for an entry of hostTemplates")
+		}
+		if seen[t.HostTemplateID] {
+			return http.StatusBadRequest, fmt.Errorf("hostTemplate %s is listed more than once", t.HostTemplateID)
+		}
+		seen[t.HostTemplateID] = true
+		if t.Weight < 0 {
+			return http.StatusBadRequest, fmt.Errorf("Invalid weight %v for hostTemplate %s", t.Weight, t.HostTemplateID)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+//getScaleTemplates looks up the configured templates, failing if any of them no longer exists
+func getScaleTemplates(config model.ScaleHost, apiClient *client.RancherClient) ([]scaleTemplate, int, error) {
+	templates := []scaleTemplate{}
+	for _, t := range configuredTemplates(config) {
+		hostTemplate, err := apiClient.HostTemplate.ById(t.HostTemplateID)
+		if err != nil {
+			log.Errorf("Cannot get hostTemplate resource: %v", err)
+			return nil, http.StatusBadRequest, fmt.Errorf("Cannot get hostTemplate resource")
+		}
+
+		if hostTemplate == nil || hostTemplate.Removed != "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("hostTemplate %s does not exist", t.HostTemplateID)
+		}
+		templates = append(templates, scaleTemplate{id: t.HostTemplateID, weight: t.Weight, template: hostTemplate})
+	}
+	return templates, http.StatusOK, nil
+}
+
+//pickTemplate returns the template furthest below its weighted share of counts, earlier templates
+//winning ties
+func pickTemplate(templates []scaleTemplate, counts map[string]int64) scaleTemplate {
+	best := templates[0]
+	for _, t := range templates[1:] {
+		//counts[t]/t.weight < counts[best]/best.weight without dividing
+		if counts[t.id]*best.weight < counts[best.id]*t.weight {
+			best = t
+		}
+	}
+	return best
+}
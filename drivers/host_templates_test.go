@@ -0,0 +1,36 @@
+package drivers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+)
+
+func TestPickTemplate(t *testing.T) {
+	templates := []scaleTemplate{{id: "a", weight: 2}, {id: "b", weight: 1}, {id: "c", weight: 1}}
+	counts := map[string]int64{"b": 1}
+	picked := []string{}
+	for i := 0; i < 7; i++ {
+		t := pickTemplate(templates, counts)
+		counts[t.id]++
+		picked = append(picked, t.id)
+	}
+	expected := []string{"a", "c", "a", "a", "b", "c", "a"}
+	if !reflect.DeepEqual(picked, expected) {
+		t.Fatalf("Picked %v, expected %v", picked, expected)
+	}
+}
+
+func TestValidateHostTemplates(t *testing.T) {
+	for _, config := range []model.ScaleHost{
+		{HostTemplateID: "a", HostTemplates: []model.HostTemplateWeight{{HostTemplateID: "b"}}},
+		{HostTemplates: []model.HostTemplateWeight{{HostTemplateID: "a"}, {HostTemplateID: "a"}}},
+		{HostTemplates: []model.HostTemplateWeight{{HostTemplateID: "a", Weight: -1}}},
+		{HostTemplates: []model.HostTemplateWeight{{Weight: 1}}},
+	} {
+		if _, err := validateHostTemplates(config); err == nil {
+			t.Errorf("Expected %#v to be rejected", config)
+		}
+	}
+}
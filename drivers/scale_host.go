@@ -1,23 +1,16 @@
 package drivers
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
-	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	v1client "github.com/rancher/go-rancher/client"
 	"github.com/rancher/go-rancher/v2"
-	rConfig "github.com/rancher/webhook-service/config"
 	"github.com/rancher/webhook-service/model"
 )
 
@@ -33,30 +26,53 @@ func (s *ScaleHostDriver) ValidatePayload(conf interface{}, apiClient *client.Ra
 		return http.StatusInternalServerError, fmt.Errorf("Can't process config")
 	}
 
-	if config.Action == "" {
-		return http.StatusBadRequest, fmt.Errorf("Scale action not provided")
+	if code, err := validateScaleHostConfig(config); err != nil {
+		return code, err
 	}
 
-	if config.Action != "up" && config.Action != "down" {
-		return http.StatusBadRequest, fmt.Errorf("Invalid action %v", config.Action)
+	if len(configuredTemplates(config)) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("hostTemplateId is not provided")
 	}
 
-	if config.Amount <= 0 {
-		return http.StatusBadRequest, fmt.Errorf("Invalid amount: %v", config.Amount)
+	_, code, err := getScaleTemplates(config, apiClient)
+	return code, err
+}
+
+//validateScaleHostConfig checks the config on its own, at creation and again in Execute once
+//request overrides are merged in. Requiring a host template is left to ValidatePayload so receivers
+//created with a hostSelector keep working.
+func validateScaleHostConfig(config model.ScaleHost) (int, error) {
+	if code, err := validateHostTemplates(config); err != nil {
+		return code, err
 	}
 
-	if config.HostTemplateID == "" {
-		return http.StatusBadRequest, fmt.Errorf("hostTemplateId is not provided")
+	if config.Action == "down" && (len(config.CloneLabels) > 0 || len(config.CloneDriverConfig) > 0) {
+		return http.StatusBadRequest, fmt.Errorf("cloneLabels and cloneDriverConfig not to be provided while scaling down")
+	}
+	if len(config.CloneDriverConfig) > 0 && len(configuredTemplates(config)) > 0 {
+		return http.StatusBadRequest, fmt.Errorf("cloneDriverConfig can't be used with host templates")
 	}
 
-	hostTemplate, err := apiClient.HostTemplate.ById(config.HostTemplateID)
-	if err != nil {
-		log.Errorf("Cannot get hostTemplate resource: %v", err)
-		return http.StatusBadRequest, fmt.Errorf("Cannot get hostTemplate resource")
+	if config.DrainTimeoutSeconds < 0 {
+		return http.StatusBadRequest, fmt.Errorf("Invalid drainTimeoutSeconds: %v", config.DrainTimeoutSeconds)
+	}
+
+	if config.HostnameTemplate != "" {
+		if err := validateHostnameTemplate(config.HostnameTemplate); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	if config.Action == "" {
+		return http.StatusBadRequest, fmt.Errorf("Scale action not provided")
+	}
+
+	if config.Action != "up" && config.Action != "down" {
+		return http.StatusBadRequest, fmt.Errorf("Invalid action %v", config.Action)
 	}
 
-	if hostTemplate == nil || hostTemplate.Removed != "" {
-		return http.StatusBadRequest, fmt.Errorf("hostTemplate does not exist")
+	if config.Amount <= 0 {
+		return http.StatusBadRequest, fmt.Errorf("Invalid amount: %v", config.Amount)
 	}
 
 	if config.Min <= 0 {
@@ -71,23 +87,21 @@ func (s *ScaleHostDriver) ValidatePayload(conf interface{}, apiClient *client.Ra
 		return http.StatusBadRequest, fmt.Errorf("Max must be greater than min")
 	}
 
-	if config.Action == "up" {
-		if config.DeleteOption != "" {
-			return http.StatusBadRequest, fmt.Errorf("Delete option not to be provided while scaling up")
-		}
-	}
-
-	if config.Action == "down" {
-		if config.DeleteOption != "mostRecent" && config.DeleteOption != "leastRecent" {
-			return http.StatusBadRequest, fmt.Errorf("Invalid delete option/Delete option missing %v", config.DeleteOption)
-		}
+	if code, err := validateDeleteOptions(config); err != nil {
+		return code, err
 	}
 
 	return http.StatusOK, nil
 }
 
 func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherClient, reqBody interface{}) (int, error) {
-	var currNameSuffix, baseHostName, currCloneName, suffix, key, value string
+	return s.ExecuteWithProgress(conf, apiClient, reqBody, nil)
+}
+
+//ExecuteWithProgress scales the group, reporting on each host deleted when scaling down
+func (s *ScaleHostDriver) ExecuteWithProgress(conf interface{}, apiClient *client.RancherClient, reqBody interface{},
+	progress HostProgressFunc) (int, error) {
+	var key, value string
 	var count, newHostScale, baseHostIndex int64
 
 	config := &model.ScaleHost{}
@@ -96,19 +110,25 @@ func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherCli
 		return http.StatusInternalServerError, errors.Wrap(err, "Couldn't unmarshal config")
 	}
 
+	if progress == nil {
+		progress = func(model.HostProgress) {}
+	}
+
+	if code, err := validateScaleHostConfig(*config); err != nil {
+		return code, err
+	}
+
 	action := config.Action
 	amount := config.Amount
 	max := config.Max
 
-	if config.HostTemplateID != "" { // logic for scale host with hostTemplateId
-		hostTemplate, err := apiClient.HostTemplate.ById(config.HostTemplateID)
-		if err != nil {
-			log.Errorf("Cannot get hostTemplate resource: %v", err)
-			return http.StatusBadRequest, fmt.Errorf("Cannot get hostTemplate resource")
-		}
+	group := lockHostGroup(hostGroupKey(apiClient, config))
+	defer group.unlock()
 
-		if hostTemplate == nil || hostTemplate.Removed != "" {
-			return http.StatusBadRequest, fmt.Errorf("hostTemplate does not exist")
+	if templates := configuredTemplates(*config); len(templates) > 0 { // logic for scale host with host templates
+		scaleTemplates, code, err := getScaleTemplates(*config, apiClient)
+		if err != nil {
+			return code, err
 		}
 
 		filters := make(map[string]interface{})
@@ -117,98 +137,91 @@ func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherCli
 		hostCollection, err := apiClient.Host.List(&client.ListOpts{
 			Filters: filters,
 		})
+		if err != nil {
+			return http.StatusInternalServerError, errors.Wrap(err, "Error listing hosts")
+		}
 
-		hostScalingGroup := []client.Host{}
-		baseHostIndex = -1
-		for _, host := range hostCollection.Data {
-			if host.HostTemplateId == config.HostTemplateID {
-				hostScalingGroup = append(hostScalingGroup, host)
-				if host.Driver != "" {
-					baseHostIndex = int64(len(hostScalingGroup)) - 1
-				}
-			}
+		weights := map[string]int64{}
+		for _, t := range scaleTemplates {
+			weights[t.id] = t.weight
 		}
 
-		if baseHostIndex == -1 {
-			baseHostName = "scaledhost"
-		} else {
-			host := hostScalingGroup[baseHostIndex]
-			if host.Name != "" {
-				baseHostName = host.Name
-			} else {
-				baseHostName = host.Hostname
+		matching := []client.Host{}
+		for _, host := range hostCollection.Data {
+			if _, ok := weights[host.HostTemplateId]; ok {
+				matching = append(matching, host)
 			}
-			baseHostName = strings.Split(baseHostName, ".")[0]
 		}
 
-		count = 0
-
-		if action == "up" {
-			baseSuffix := re.FindString(baseHostName)
-			basePrefix := strings.TrimRight(baseHostName, baseSuffix)
+		hostScalingGroup, err := group.members(matching)
+		if err != nil {
+			return http.StatusConflict, err
+		}
 
-			newHostScale = amount + int64(len(hostScalingGroup))
-			if newHostScale > max {
-				return http.StatusBadRequest, fmt.Errorf("Cannot scale above provided max scale value")
-			}
+		if action == "down" {
+			return scaleDown(hostScalingGroup, config, apiClient, weights, group, progress)
+		}
 
-			// Get the most recently created host with same prefix as base host, this will have largest suffix
-			suffix = ""
-			for _, currentHost := range hostScalingGroup {
-				if currentHost.Name != "" {
-					currCloneName = currentHost.Name
-				} else {
-					currCloneName = currentHost.Hostname
-				}
+		newHostScale = amount + int64(len(hostScalingGroup))
+		if newHostScale > max {
+			return http.StatusBadRequest, fmt.Errorf("Cannot scale above provided max scale value")
+		}
 
-				if !strings.Contains(currCloneName, basePrefix) {
-					continue
+		// Each template continues its own name sequence
+		used := usedHostnames(hostCollection.Data)
+		counts := map[string]int64{}
+		namers := map[string]*hostNamer{}
+		for _, t := range scaleTemplates {
+			templateHosts := []client.Host{}
+			for _, host := range hostScalingGroup {
+				if host.HostTemplateId == t.id {
+					templateHosts = append(templateHosts, host)
 				}
-
-				currCloneName = strings.Split(currCloneName, ".")[0]
-				suffix = re.FindString(currCloneName)
-				break
 			}
-
-			// if suffix exists, increment by 1, else append '2' to next clone
-			for count < amount {
-				if suffix != "" {
-					prevNumber, err := strconv.Atoi(suffix)
-					if err != nil {
-						return http.StatusInternalServerError, fmt.Errorf("Error converting %s to int in scaleHost driver: %v", suffix, err)
-					}
-					currNumber := prevNumber + 1
-					currNameSuffix = leftPad(strconv.Itoa(currNumber), "0", len(suffix))
-				} else if baseHostIndex == -1 {
-					currNameSuffix = "1" //since there is not host with the specified hostTemplateId exsited before
-				} else {
-					currNameSuffix = "2"
+			counts[t.id] = int64(len(templateHosts))
+			if config.HostnameTemplate != "" {
+				data := hostnameData{Zone: templateZone(t), Template: t.id}
+				namers[t.id], err = newTemplateHostNamer(config.HostnameTemplate, data, counts[t.id], used)
+				if err != nil {
+					return http.StatusBadRequest, err
 				}
+				continue
+			}
+			defaultBase := "scaledhost"
+			if len(scaleTemplates) > 1 {
+				defaultBase = templateHostPrefix(t)
+			}
+			namers[t.id] = newHostNamer(templateHosts, defaultBase, used)
+		}
 
-				hst := client.Host{}
-				name := basePrefix + currNameSuffix
-				hst.Name = ""
-				hst.Hostname = name
-				hst.HostTemplateId = hostTemplate.Id
-				log.Infof("Creating host with hostname: %s", name)
+		for count = 0; count < amount; count++ {
+			t := pickTemplate(scaleTemplates, counts)
+			name, err := namers[t.id].next()
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
 
-				_, err := apiClient.Host.Create(&hst)
-				if err != nil {
-					log.Errorf("Cannot create host: %v", err)
-					return http.StatusInternalServerError, fmt.Errorf("Cannot create host")
+			hst := client.Host{}
+			hst.Name = ""
+			hst.Hostname = name
+			hst.HostTemplateId = t.id
+			if len(config.CloneLabels) > 0 {
+				hst.Labels = map[string]interface{}{}
+				for k, v := range config.CloneLabels {
+					hst.Labels[k] = v
 				}
+			}
+			log.Infof("Creating host with hostname: %s from hostTemplate %s", name, t.id)
 
-				suffix = currNameSuffix
-				count++
+			created, err := apiClient.Host.Create(&hst)
+			if err != nil {
+				log.Errorf("Cannot create host: %v", err)
+				return http.StatusInternalServerError, fmt.Errorf("Cannot create host")
 			}
-		} else if action == "down" {
-			return scaleDown(hostScalingGroup, config, apiClient)
+			group.created(created.Id)
+			counts[t.id]++
 		}
 	} else { // logic for scale host with labels
-		httpClient := &http.Client{
-			Timeout: time.Second * 10,
-		}
-
 		hostSelector := make(map[string]string)
 		if config.HostSelector != nil {
 			for key, value = range config.HostSelector {
@@ -216,27 +229,20 @@ func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherCli
 			}
 		}
 
-		cattleConfig := rConfig.GetConfig()
-		cattleURL := cattleConfig.CattleURL
-		u, err := url.Parse(cattleURL)
-		if err != nil {
-			panic(err)
-		}
-		cattleURL = strings.Split(cattleURL, u.Path)[0] + "/v2-beta"
-
 		filters := make(map[string]interface{})
 		filters["sort"] = "created"
 		filters["order"] = "desc"
 		hostCollection, err := apiClient.Host.List(&client.ListOpts{
 			Filters: filters,
 		})
+		if err != nil {
+			return http.StatusInternalServerError, errors.Wrap(err, "Error listing hosts")
+		}
 		if len(hostCollection.Data) == 0 {
 			return http.StatusBadRequest, fmt.Errorf("No hosts for scaling found")
 		}
 
-		hostScalingGroup := []client.Host{}
-		hostSelectorPresent := false
-		baseHostIndex = -1
+		matching := []client.Host{}
 		for _, host := range hostCollection.Data {
 			labels := host.Labels
 			labelFound := false
@@ -255,22 +261,25 @@ func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherCli
 				continue
 			}
 
-			if host.State == "error" {
-				continue
-			}
-
-			hostSelectorPresent = true
-			hostScalingGroup = append(hostScalingGroup, host)
+			matching = append(matching, host)
+		}
 
-			if host.Driver != "" {
-				baseHostIndex = int64(len(hostScalingGroup)) - 1
-			}
+		hostScalingGroup, err := group.members(matching)
+		if err != nil {
+			return http.StatusConflict, err
 		}
 
-		if hostSelectorPresent == false {
+		if len(hostScalingGroup) == 0 {
 			return http.StatusBadRequest, fmt.Errorf("No host with label %v exists", hostSelector)
 		}
 
+		baseHostIndex = -1
+		for i, host := range hostScalingGroup {
+			if host.Driver != "" {
+				baseHostIndex = int64(i)
+			}
+		}
+
 		if baseHostIndex == -1 && action == "up" {
 			return http.StatusBadRequest, fmt.Errorf("Cannot use custom hosts for scaling up")
 		}
@@ -283,87 +292,60 @@ func (s *ScaleHostDriver) Execute(conf interface{}, apiClient *client.RancherCli
 			// Remove largest number suffix from end, scaleHost12 becomes scaleHost
 			// Name has precedence over hostname. If name is set, empty this field for the clones
 			host := hostScalingGroup[baseHostIndex]
-			if host.Name != "" {
-				baseHostName = host.Name
-			} else {
-				baseHostName = host.Hostname
+			used := usedHostnames(hostCollection.Data)
+			namer := newHostNamer(hostScalingGroup, "", used)
+			if config.HostnameTemplate != "" {
+				namer, err = newTemplateHostNamer(config.HostnameTemplate, hostnameData{}, int64(len(hostScalingGroup)), used)
+				if err != nil {
+					return http.StatusBadRequest, err
+				}
 			}
-			baseHostName = strings.Split(baseHostName, ".")[0]
-			baseSuffix := re.FindString(baseHostName)
-			basePrefix := strings.TrimRight(baseHostName, baseSuffix)
 
-			// Use raw call to get host so as to get additional driver config
-			getURL := cattleURL + "/projects/" + host.AccountId + "/hosts/" + host.Id
+			// Copy the base host including its machine driver config
 			log.Infof("Getting config for host %s as base host for cloning", host.Id)
-
-			hostRaw, err := getHosts(getURL, httpClient, cattleConfig.CattleAccessKey, cattleConfig.CattleSecretKey)
+			cloner := &HostCloner{Client: apiClient}
+			hostTemplate, err := cloner.Template(host.Id)
 			if err != nil {
 				return http.StatusInternalServerError, err
 			}
 
-			hostCreateURL := cattleURL + "/projects/" + host.AccountId + "/hosts"
 			newHostScale = amount + int64(len(hostScalingGroup))
 			if newHostScale > max {
 				return http.StatusBadRequest, fmt.Errorf("Cannot scale above provided max scale value")
 			}
 
-			// Get the most recently created host with same prefix as base host, this will have largest suffix
-			suffix = ""
-			for _, currentHost := range hostScalingGroup {
-				if currentHost.Name != "" {
-					currCloneName = currentHost.Name
-				} else {
-					currCloneName = currentHost.Hostname
-				}
-
-				if !strings.Contains(currCloneName, basePrefix) {
-					continue
-				}
-
-				currCloneName = strings.Split(currCloneName, ".")[0]
-				suffix = re.FindString(currCloneName)
-				break
-			}
-
-			// if suffix exists, increment by 1, else append '2' to next clone
 			for count < amount {
-				if suffix != "" {
-					prevNumber, err := strconv.Atoi(suffix)
-					if err != nil {
-						return http.StatusInternalServerError, fmt.Errorf("Error converting %s to int in scaleHost driver: %v", suffix, err)
-					}
-					currNumber := prevNumber + 1
-					currNameSuffix = leftPad(strconv.Itoa(currNumber), "0", len(suffix))
-				} else {
-					currNameSuffix = "2"
+				name, err := namer.next()
+				if err != nil {
+					return http.StatusInternalServerError, err
 				}
 
-				name := basePrefix + currNameSuffix
-				hostRaw["name"] = ""
-				hostRaw["hostname"] = name
-
 				log.Infof("Creating host with hostname: %s", name)
-				code, err := createHost(hostRaw, hostCreateURL, httpClient, cattleConfig.CattleAccessKey, cattleConfig.CattleSecretKey)
+				hostID, err := cloner.Clone(hostTemplate, CloneOptions{
+					Hostname:     name,
+					Labels:       config.CloneLabels,
+					DriverConfig: config.CloneDriverConfig,
+				})
 				if err != nil {
 					log.Errorf("Cannot create host: %v", err)
-					return code, fmt.Errorf("Cannot create host")
+					return http.StatusInternalServerError, fmt.Errorf("Cannot create host")
 				}
-
-				suffix = currNameSuffix
+				group.created(hostID)
 				count++
 			}
 		} else if action == "down" {
-			return scaleDown(hostScalingGroup, config, apiClient)
+			return scaleDown(hostScalingGroup, config, apiClient, nil, group, progress)
 		}
 	}
 
 	return http.StatusOK, nil
 }
 
-func scaleDown(hostScalingGroup []client.Host, config *model.ScaleHost, apiClient *client.RancherClient) (int, error) {
+//scaleDown removes amount hosts of the group, weights are those of the group's templates if any
+func scaleDown(hostScalingGroup []client.Host, config *model.ScaleHost, apiClient *client.RancherClient, weights map[string]int64,
+	group *hostGroup, progress HostProgressFunc) (int, error) {
 	amount := config.Amount
 	min := config.Min
-	deleteOption := config.DeleteOption
 
 	var newHostScale int64
 	newHostScale = int64(len(hostScalingGroup)) - amount
@@ -371,66 +353,18 @@ func scaleDown(hostScalingGroup []client.Host, config *model.ScaleHost, apiClien
 		return http.StatusBadRequest, fmt.Errorf("Cannot scale below provided min scale value")
 	}
 
-	badHosts := make(map[string]bool)
-	deleteCount := int64(0)
-	for _, host := range hostScalingGroup {
-		state := host.State
-		if state == "inactive" || state == "deactivating" || state == "reconnecting" || state == "disconnected" {
-			if deleteCount >= amount {
-				return http.StatusBadRequest, fmt.Errorf("Cannot scale down exceed amount")
-			}
-			badHosts[host.Id] = true
-			log.Infof("Deleting host %s with priority because of bad state: %s", host.Id, host.State)
-			code, err := deleteHost(host.Id, apiClient)
-			if err != nil {
-				log.Errorf("Cannot delete host: %v", err)
-				return code, fmt.Errorf("Cannot delete host")
-			}
-			deleteCount++
-		}
+	policy, err := newDeletePolicy(config, hostScalingGroup, apiClient)
+	if err != nil {
+		return http.StatusInternalServerError, err
 	}
 
-	count := int64(0)
-	delIndex := count
-	amount -= deleteCount
-	if deleteOption == "mostRecent" {
-		log.Infof("Deleting most recently created hosts")
-		for count < amount {
-			host := hostScalingGroup[delIndex]
-			if badHosts[host.Id] {
-				delIndex++
-				continue
-			}
-			log.Infof("Deleting host %s", host.Id)
-			code, err := deleteHost(host.Id, apiClient)
-			if err != nil {
-				log.Errorf("Cannot delete host: %v", err)
-				return code, fmt.Errorf("Cannot delete host")
-			}
-			delIndex++
-			count++
-		}
-	} else if deleteOption == "leastRecent" {
-		log.Infof("Deleting least recently created hosts")
-		index := int64(0)
-		for count < amount {
-			index = (int64(len(hostScalingGroup)) - delIndex) - 1
-			host := hostScalingGroup[index]
-			if badHosts[host.Id] {
-				delIndex++
-				continue
-			}
-			log.Infof("Deleting host %s", host.Id)
-			code, err := deleteHost(host.Id, apiClient)
-			if err != nil {
-				log.Errorf("Cannot delete host: %v", err)
-				return code, fmt.Errorf("Cannot delete host")
-			}
-			delIndex++
-			count++
-		}
+	victims, err := hostsToDelete(hostScalingGroup, amount, policy, weights)
+	if err != nil {
+		return http.StatusBadRequest, err
 	}
-	return http.StatusOK, nil
+
+	log.Infof("Deleting %d hosts, %s first", amount, config.DeleteOption)
+	return drainHosts(victims, config, apiClient, group, progress)
 }
 
 func (s *ScaleHostDriver) ConvertToConfigAndSetOnWebhook(conf interface{}, webhook *model.Webhook) error {
@@ -457,7 +391,6 @@ func (s *ScaleHostDriver) GetDriverConfigResource() interface{} {
 
 func (s *ScaleHostDriver) CustomizeSchema(schema *v1client.Schema) *v1client.Schema {
 	scaleOptions := []string{"up", "down"}
-	deleteOptions := []string{"mostRecent", "leastRecent"}
 	minValue := int64(1)
 
 	action := schema.ResourceFields["action"]
@@ -475,6 +408,10 @@ func (s *ScaleHostDriver) CustomizeSchema(schema *v1client.Schema) *v1client.Sch
 	max.Min = &minValue
 	schema.ResourceFields["max"] = max
 
+	hostTemplates := schema.ResourceFields["hostTemplates"]
+	hostTemplates.Type = "array[hostTemplateWeight]"
+	schema.ResourceFields["hostTemplates"] = hostTemplates
+
 	deleteOption := schema.ResourceFields["deleteOption"]
 	deleteOption.Type = "enum"
 	deleteOption.Options = deleteOptions
@@ -483,65 +420,6 @@ func (s *ScaleHostDriver) CustomizeSchema(schema *v1client.Schema) *v1client.Sch
 	return schema
 }
 
-func getHosts(hostURL string, httpClient *http.Client, accessKey string, secretKey string) (map[string]interface{}, error) {
-	hostsResp := make(map[string]interface{})
-	request, err := http.NewRequest("GET", hostURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error creating request to get host: %v", err)
-	}
-
-	request.SetBasicAuth(accessKey, secretKey)
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Error %s in http.Get of host", resp.Status)
-	}
-
-	respBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = json.Unmarshal(respBytes, &hostsResp)
-	if err != nil {
-		return nil, err
-	}
-
-	return hostsResp, nil
-}
-
-func createHost(host map[string]interface{}, hostCreateURL string, httpClient *http.Client, accessKey string, secretKey string) (int, error) {
-	hostJSON, err := json.Marshal(host)
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("Error in JSON marshal of host: %v", err)
-	}
-
-	request, err := http.NewRequest("POST", hostCreateURL, bytes.NewBuffer(hostJSON))
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("Error creating request to create host: %v", err)
-	}
-
-	request.SetBasicAuth(accessKey, secretKey)
-	request.Header.Set("Content-Type", "application/json")
-	resp, err := httpClient.Do(request)
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("Error creating host: %v", err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return resp.StatusCode, fmt.Errorf("Error %s in http.Post while creating host", resp.Status)
-	}
-
-	return http.StatusOK, nil
-}
-
 func deleteHost(hostID string, apiClient *client.RancherClient) (int, error) {
 	_, err := apiClient.ExternalHostEvent.Create(&client.ExternalHostEvent{
 		EventType:  "host.evacuate",
@@ -0,0 +1,144 @@
+package drivers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestScaleHostEndToEnd(t *testing.T) {
+	defer func(interval time.Duration) { drainPollInterval = interval }(drainPollInterval)
+	drainPollInterval = time.Millisecond
+
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	server.TransitionReads = 2
+	templateID := server.Add("1a5", "hostTemplate", map[string]interface{}{"name": "us-west"})
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &ScaleHostDriver{}
+	up := model.ScaleHost{HostTemplateID: templateID, Action: "up", Amount: 2, Min: 1, Max: 5}
+	if code, err := driver.Execute(up, apiClient, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	hosts := server.List("host")
+	if len(hosts) != 2 || hosts[0]["hostname"] != "scaledhost1" || hosts[1]["hostname"] != "scaledhost2" {
+		t.Fatalf("Unexpected hosts after scaling up %v", hosts)
+	}
+	for _, host := range hosts {
+		if host["hostTemplateId"] != templateID || host["state"] != "provisioning" {
+			t.Fatalf("Unexpected host %v", host)
+		}
+	}
+
+	//Hosts still provisioning hold off the next scale until Cattle reports them active
+	up.Amount = 1
+	if code, _ := driver.Execute(up, apiClient, nil); code != http.StatusConflict {
+		t.Fatalf("Expected 409 while hosts are provisioning, got %d", code)
+	}
+	server.TransitionReads = 1
+	if code, err := driver.Execute(up, apiClient, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	hosts = server.List("host")
+	if len(hosts) != 3 || hosts[2]["hostname"] != "scaledhost3" {
+		t.Fatalf("Unexpected hosts after scaling up again %v", hosts)
+	}
+
+	server.Fail("host", "create", http.StatusInternalServerError)
+	if code, _ := driver.Execute(up, apiClient, nil); code != http.StatusInternalServerError {
+		t.Fatalf("Expected a failed create to return 500, got %d", code)
+	}
+	server.Recover()
+
+	//Scaling down drains the most recent host of its containers before deleting it
+	victim := hosts[2]["id"].(string)
+	server.Add("1a5", "container", map[string]interface{}{"hostId": victim, "kind": "container"})
+	lock := sync.Mutex{}
+	states := []string{}
+	down := model.ScaleHost{HostTemplateID: templateID, Action: "down", Amount: 1, Min: 1, Max: 5, DeleteOption: "mostRecent"}
+	code, err := driver.ExecuteWithProgress(down, apiClient, nil, func(p model.HostProgress) {
+		lock.Lock()
+		defer lock.Unlock()
+		if p.HostID != victim {
+			t.Errorf("Progress reported for host %s, expected %s", p.HostID, victim)
+		}
+		states = append(states, p.State)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	if !WaitForBackgroundWork(10 * time.Second) {
+		t.Fatal("Drain didn't finish")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(states) != 2 || states[0] != HostDeactivated || states[1] != HostDeleted {
+		t.Fatalf("Unexpected progress %v", states)
+	}
+	if container := server.List("container")[0]; container["state"] != "removed" {
+		t.Fatalf("Expected the host's container to be evacuated, got %v", container["state"])
+	}
+	if host := server.Get("host", victim); host["state"] != "removing" && host["state"] != "removed" {
+		t.Fatalf("Expected host %s to be deleted, got %v", victim, host["state"])
+	}
+	for _, host := range server.List("host")[:2] {
+		if host["state"] != "active" {
+			t.Fatalf("Expected host %v to be kept, got %v", host["id"], host["state"])
+		}
+	}
+}
+
+func TestScaleHostDownReactivatesHostsWhenDeactivationFails(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	templateID := server.Add("1a5", "hostTemplate", map[string]interface{}{"name": "us-west"})
+	ids := []string{}
+	for _, hostname := range []string{"scaledhost1", "scaledhost2", "scaledhost3"} {
+		ids = append(ids, server.Add("1a5", "host", map[string]interface{}{"hostname": hostname, "hostTemplateId": templateID}))
+	}
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The most recent host is deactivated, then deactivating the next one fails
+	server.FailResourceAction("host", ids[1], "deactivate", http.StatusInternalServerError)
+	progress := map[string][]string{}
+	down := model.ScaleHost{HostTemplateID: templateID, Action: "down", Amount: 2, Min: 1, Max: 5, DeleteOption: "mostRecent"}
+	code, err := (&ScaleHostDriver{}).ExecuteWithProgress(down, apiClient, nil, func(p model.HostProgress) {
+		progress[p.HostID] = append(progress[p.HostID], p.State)
+	})
+	if err == nil || code != http.StatusInternalServerError {
+		t.Fatalf("Expected the failed deactivation to fail the scale down, got %d %v", code, err)
+	}
+	if !WaitForBackgroundWork(10 * time.Second) {
+		t.Fatal("Background work didn't finish")
+	}
+
+	if states := progress[ids[2]]; len(states) != 2 || states[0] != HostDeactivated || states[1] != HostReactivated {
+		t.Fatalf("Expected the deactivated host to be activated again, got %v", progress)
+	}
+	if states := progress[ids[1]]; len(states) != 1 || states[0] != HostFailed {
+		t.Fatalf("Expected the host that couldn't be deactivated to be reported as failed, got %v", progress)
+	}
+	for _, host := range server.List("host") {
+		if host["state"] != "active" && host["state"] != "activating" {
+			t.Fatalf("Expected host %v to be active, got %v", host["id"], host["state"])
+		}
+	}
+	hostGroups.Lock()
+	_, kept := hostGroups.groups[hostGroupKey(apiClient, &down)]
+	hostGroups.Unlock()
+	if kept {
+		t.Fatal("Expected the group to be forgotten, no host is left draining")
+	}
+}
@@ -3,6 +3,8 @@ package drivers
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
@@ -14,12 +16,80 @@ import (
 type ScaleServiceDriver struct {
 }
 
+//scaleTarget is a service an execution scales, with the amount and bounds of the target it was
+//found by
+type scaleTarget struct {
+	service  *client.Service
+	amount   int64
+	min      int64
+	max      int64
+	newScale int64
+}
+
 func (s *ScaleServiceDriver) ValidatePayload(conf interface{}, apiClient *client.RancherClient) (int, error) {
 	config, ok := conf.(model.ScaleService)
 	if !ok {
 		return http.StatusInternalServerError, fmt.Errorf("Can't process config")
 	}
 
+	if code, err := validateScaleServiceConfig(config); err != nil {
+		return code, err
+	}
+
+	if config.ResolvedServiceID != "" || len(config.ResolvedServiceIDs) != 0 {
+		return http.StatusBadRequest, fmt.Errorf("Resolved service IDs are set by the webhook service and can't be provided")
+	}
+
+	targets, missing, err := findScaleTargets(config, apiClient)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if len(missing) != 0 {
+		return http.StatusBadRequest, fmt.Errorf("Invalid service %v", strings.Join(missing, ", "))
+	}
+
+	if err := checkDistinctTargets(targets); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	//a selector matching several services without allMatching is accepted with a warning,
+	//executing fails until it matches one
+	for _, target := range targets {
+		if code, err := checkScalableService(*target.service); err != nil {
+			return code, err
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+//checkScalableService rejects the services a receiver can't scale
+func checkScalableService(service client.Service) (int, error) {
+	if service.Kind != "service" && service.Kind != "loadBalancerService" {
+		return http.StatusBadRequest, fmt.Errorf("Can only create webhooks for Services. The supplied service is of type %v", service.Kind)
+	}
+
+	if service.LaunchConfig == nil {
+		return http.StatusOK, nil
+	}
+
+	if val, ok := service.LaunchConfig.Labels["io.rancher.scheduler.global"]; ok {
+		if val == "true" {
+			return http.StatusBadRequest, fmt.Errorf("Cannot create webhook for global service %s", service.Id)
+		}
+	}
+
+	if service.LaunchConfig.ImageUuid == "docker:rancher/none" {
+		return http.StatusBadRequest, fmt.Errorf("Cannot create webhook for service with no image %s", service.Id)
+	}
+
+	return http.StatusOK, nil
+}
+
+//validateScaleServiceConfig checks the config on its own, at creation and again in Execute once
+//request overrides are merged in
+func validateScaleServiceConfig(config model.ScaleService) (int, error) {
 	if config.ScaleAction == "" {
 		return http.StatusBadRequest, fmt.Errorf("Scale action not provided")
 	}
@@ -28,97 +98,366 @@ func (s *ScaleServiceDriver) ValidatePayload(conf interface{}, apiClient *client
 		return http.StatusBadRequest, fmt.Errorf("Invalid action %v", config.ScaleAction)
 	}
 
-	if config.ScaleChange <= 0 {
-		return http.StatusBadRequest, fmt.Errorf("Invalid amount: %v", config.ScaleChange)
+	references := 0
+	if config.ServiceID != "" {
+		references++
+	}
+	if config.StackName != "" || config.ServiceName != "" {
+		references++
+	}
+	if len(config.ServiceSelector) != 0 {
+		references++
+	}
+	if len(config.Targets) != 0 {
+		references++
+	}
+
+	if references == 0 {
+		return http.StatusBadRequest, fmt.Errorf("ServiceId not provided. Provide serviceId, stackName and serviceName, serviceSelector or targets")
+	}
+
+	if references > 1 {
+		return http.StatusBadRequest, fmt.Errorf("Only one of serviceId, stackName and serviceName, serviceSelector or targets can be provided")
+	}
+
+	if config.AllMatching && len(config.ServiceSelector) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("allMatching can only be set with serviceSelector")
 	}
 
-	if config.ServiceID == "" {
-		return http.StatusBadRequest, fmt.Errorf("ServiceId not provided")
+	if len(config.ServiceSelector) != 0 {
+		return validateScaleBounds(config.ScaleChange, config.Min, config.Max)
 	}
 
-	if config.Min <= 0 {
+	for i, target := range scaleServiceTargets(config) {
+		code, err := validateScaleTarget(target)
+		if err != nil && len(config.Targets) != 0 {
+			return code, fmt.Errorf("Target %d: %v", i+1, err)
+		}
+		if err != nil {
+			return code, err
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+func validateScaleTarget(target model.ScaleServiceTarget) (int, error) {
+	if target.ServiceID != "" && (target.StackName != "" || target.ServiceName != "") {
+		return http.StatusBadRequest, fmt.Errorf("Only one of serviceId, or stackName and serviceName can be provided")
+	}
+
+	if target.ServiceID == "" && (target.StackName == "" || target.ServiceName == "") {
+		return http.StatusBadRequest, fmt.Errorf("stackName and serviceName must be provided together")
+	}
+
+	return validateScaleBounds(target.ScaleChange, target.Min, target.Max)
+}
+
+func validateScaleBounds(amount int64, min int64, max int64) (int, error) {
+	if amount <= 0 {
+		return http.StatusBadRequest, fmt.Errorf("Invalid amount: %v", amount)
+	}
+
+	if min <= 0 {
 		return http.StatusBadRequest, fmt.Errorf("Minimum scale not provided/invalid")
 	}
 
-	if config.Max <= 0 {
+	if max <= 0 {
 		return http.StatusBadRequest, fmt.Errorf("Maximum scale not provided/invalid")
 	}
 
-	if config.Min >= config.Max {
+	if min >= max {
 		return http.StatusBadRequest, fmt.Errorf("Max must be greater than min")
 	}
 
-	service, err := apiClient.Service.ById(config.ServiceID)
-	if err != nil {
-		return http.StatusInternalServerError, errors.Wrap(err, "Error in getService")
+	return http.StatusOK, nil
+}
+
+//scaleServiceTargets returns the services a config names by ID or by name, with the amount and
+//bounds of the config filled in where a target doesn't set its own
+func scaleServiceTargets(config model.ScaleService) []model.ScaleServiceTarget {
+	if len(config.Targets) == 0 {
+		return []model.ScaleServiceTarget{{
+			ServiceID:   config.ServiceID,
+			StackName:   config.StackName,
+			ServiceName: config.ServiceName,
+			ScaleChange: config.ScaleChange,
+			Min:         config.Min,
+			Max:         config.Max,
+		}}
+	}
+
+	targets := []model.ScaleServiceTarget{}
+	for _, target := range config.Targets {
+		if target.ScaleChange == 0 {
+			target.ScaleChange = config.ScaleChange
+		}
+		if target.Min == 0 {
+			target.Min = config.Min
+		}
+		if target.Max == 0 {
+			target.Max = config.Max
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+//findScaleTargets returns the services the config currently refers to, and the references that
+//match no service. Only a selector can match more than one service, its matches are sorted by ID.
+func findScaleTargets(config model.ScaleService, apiClient *client.RancherClient) ([]scaleTarget, []string, error) {
+	if len(config.ServiceSelector) != 0 {
+		services, err := FindServicesBySelector(apiClient, config.ServiceSelector)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(services) == 0 {
+			return nil, []string{serviceReference(config)}, nil
+		}
+		sort.Slice(services, func(i, j int) bool { return services[i].Id < services[j].Id })
+		targets := []scaleTarget{}
+		for i := range services {
+			targets = append(targets, scaleTarget{service: &services[i], amount: config.ScaleChange, min: config.Min, max: config.Max})
+		}
+		return targets, nil, nil
+	}
+
+	targets := []scaleTarget{}
+	missing := []string{}
+	for _, target := range scaleServiceTargets(config) {
+		service, err := findTargetService(target, apiClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		if service == nil {
+			missing = append(missing, targetReference(target))
+			continue
+		}
+		targets = append(targets, scaleTarget{service: service, amount: target.ScaleChange, min: target.Min, max: target.Max})
 	}
+	return targets, missing, nil
+}
 
+//findTargetService returns the service a target names, or nil when there's no such service
+func findTargetService(target model.ScaleServiceTarget, apiClient *client.RancherClient) (*client.Service, error) {
+	if target.ServiceID == "" {
+		return FindServiceByName(apiClient, target.StackName, target.ServiceName)
+	}
+	service, err := apiClient.Service.ById(target.ServiceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in getService")
+	}
 	if service == nil || service.Removed != "" {
-		return http.StatusBadRequest, fmt.Errorf("Invalid service %v", config.ServiceID)
+		return nil, nil
 	}
+	return service, nil
+}
 
-	if service.Kind != "service" && service.Kind != "loadBalancerService" {
-		return http.StatusBadRequest, fmt.Errorf("Can only create webhooks for Services. The supplied service is of type %v", service.Kind)
+func checkDistinctTargets(targets []scaleTarget) error {
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if seen[target.service.Id] {
+			return fmt.Errorf("Service %v is targeted more than once", target.service.Id)
+		}
+		seen[target.service.Id] = true
 	}
+	return nil
+}
 
-	if val, ok := service.LaunchConfig.Labels["io.rancher.scheduler.global"]; ok {
-		if val == "true" {
-			return http.StatusBadRequest, fmt.Errorf("Cannot create webhook for global service %s", config.ServiceID)
+//serviceReference describes how the config refers to its services, for messages
+func serviceReference(config model.ScaleService) string {
+	if len(config.ServiceSelector) == 0 {
+		references := []string{}
+		for _, target := range scaleServiceTargets(config) {
+			references = append(references, targetReference(target))
 		}
+		return strings.Join(references, ", ")
+	}
+	terms := []string{}
+	for key, value := range config.ServiceSelector {
+		terms = append(terms, key+"="+value)
 	}
+	sort.Strings(terms)
+	return "selector " + strings.Join(terms, ",")
+}
 
-	if service.LaunchConfig.ImageUuid == "docker:rancher/none" {
-		return http.StatusBadRequest, fmt.Errorf("Cannot create webhook for service with no image %s", config.ServiceID)
+func targetReference(target model.ScaleServiceTarget) string {
+	if target.ServiceID != "" {
+		return target.ServiceID
 	}
+	return target.StackName + "/" + target.ServiceName
+}
 
-	return http.StatusOK, nil
+func targetIDs(targets []scaleTarget) []string {
+	ids := []string{}
+	for _, target := range targets {
+		ids = append(ids, target.service.Id)
+	}
+	return ids
+}
+
+//resolveScaleTargets returns the services an execution scales right now
+func resolveScaleTargets(config model.ScaleService, apiClient *client.RancherClient) ([]scaleTarget, int, error) {
+	targets, missing, err := findScaleTargets(config, apiClient)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	switch {
+	case len(missing) != 0 && config.ServiceID != "":
+		return nil, http.StatusBadRequest, fmt.Errorf("Service %v has been deleted", config.ServiceID)
+	case len(missing) != 0:
+		return nil, http.StatusBadRequest, fmt.Errorf("No service found for %v", strings.Join(missing, ", "))
+	case len(targets) > 1 && len(config.ServiceSelector) != 0 && !config.AllMatching:
+		return nil, http.StatusConflict, fmt.Errorf("Service %v matches %d services %v, it must match one",
+			serviceReference(config), len(targets), targetIDs(targets))
+	}
+
+	if err := checkDistinctTargets(targets); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return targets, http.StatusOK, nil
+}
+
+//ResolveTarget fills in the IDs of the services a config given by name or selector refers to now
+func (s *ScaleServiceDriver) ResolveTarget(conf interface{}, apiClient *client.RancherClient) (interface{}, []string, error) {
+	config := model.ScaleService{}
+	if err := mapstructure.Decode(conf, &config); err != nil {
+		return nil, nil, errors.Wrap(err, "Couldn't unmarshal config")
+	}
+	config.ResolvedServiceID = ""
+	config.ResolvedServiceIDs = nil
+	if config.ServiceID != "" {
+		return config, nil, nil
+	}
+
+	targets, missing, err := findScaleTargets(config, apiClient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings := []string{}
+	for _, reference := range missing {
+		warnings = append(warnings, fmt.Sprintf("No service found for %v", reference))
+	}
+	switch {
+	case len(config.Targets) != 0 || config.AllMatching:
+		config.ResolvedServiceIDs = targetIDs(targets)
+	case len(targets) == 1:
+		config.ResolvedServiceID = targets[0].service.Id
+	case len(targets) > 1:
+		warnings = append(warnings, fmt.Sprintf("Service %v is ambiguous, it matches %d services %v. Executions fail until it matches one",
+			serviceReference(config), len(targets), targetIDs(targets)))
+	}
+	return config, warnings, nil
 }
 
 func (s *ScaleServiceDriver) Execute(conf interface{}, apiClient *client.RancherClient, requestBody interface{}) (int, error) {
+	_, code, err := s.ExecuteWithResults(conf, apiClient, requestBody)
+	return code, err
+}
+
+//ExecuteWithResults scales all the services of the config together. Every new scale is checked
+//against its bounds before any service is updated, and when updating a service fails the services
+//already scaled are scaled back.
+func (s *ScaleServiceDriver) ExecuteWithResults(conf interface{}, apiClient *client.RancherClient, requestBody interface{}) ([]model.ServiceResult, int, error) {
 	config := &model.ScaleService{}
 	err := mapstructure.Decode(conf, config)
 	if err != nil {
-		return http.StatusInternalServerError, errors.Wrap(err, "Couldn't unmarshal config")
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "Couldn't unmarshal config")
+	}
+
+	if code, err := validateScaleServiceConfig(*config); err != nil {
+		return nil, code, err
 	}
-	var newScale int64
-	serviceID := config.ServiceID
-	scaleAction := config.ScaleAction
-	scaleChange := config.ScaleChange
-	min := config.Min
-	max := config.Max
 
-	service, err := apiClient.Service.ById(serviceID)
+	//names and selectors are resolved on every execution so they follow recreated stacks
+	targets, code, err := resolveScaleTargets(*config, apiClient)
 	if err != nil {
-		return http.StatusInternalServerError, errors.Wrap(err, "Error in getService")
+		return nil, code, err
 	}
 
-	if service == nil || service.Removed != "" {
-		return http.StatusBadRequest, fmt.Errorf("Service %v has been deleted", config.ServiceID)
+	results := []model.ServiceResult{}
+	var boundsErr error
+	for i := range targets {
+		target := &targets[i]
+		result := model.ServiceResult{
+			ServiceID:     target.service.Id,
+			Name:          target.service.Name,
+			PreviousScale: target.service.Scale,
+			Scale:         target.service.Scale,
+			State:         "skipped",
+		}
+		if err := target.computeScale(config.ScaleAction); err != nil {
+			result.State, result.Message = "failed", err.Error()
+			if boundsErr == nil {
+				boundsErr = err
+				if len(targets) > 1 {
+					boundsErr = fmt.Errorf("Not scaling any service, service %v: %v", target.service.Id, err)
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	if boundsErr != nil {
+		return results, http.StatusBadRequest, boundsErr
 	}
 
+	for i := range targets {
+		_, err := apiClient.Service.Update(targets[i].service, client.Service{
+			Scale:        targets[i].newScale,
+			CurrentScale: targets[i].newScale,
+		})
+		if err != nil {
+			results[i].State, results[i].Message = "failed", err.Error()
+			rollbackScales(apiClient, targets[:i], results[:i])
+			return results, cattleErrorCode(err), errors.Wrap(err, "Error in updateService")
+		}
+		results[i].State, results[i].Scale = "scaled", targets[i].newScale
+	}
+	return results, http.StatusOK, nil
+}
+
+//computeScale sets the scale the target's service is scaled to, within the target's bounds
+func (t *scaleTarget) computeScale(scaleAction string) error {
 	if scaleAction == "up" {
-		newScale = service.Scale + scaleChange
-		if newScale > max {
-			return http.StatusBadRequest, fmt.Errorf("Cannot scale above provided max scale value")
+		t.newScale = t.service.Scale + t.amount
+		if t.newScale > t.max {
+			return fmt.Errorf("Cannot scale above provided max scale value")
 		}
 	} else if scaleAction == "down" {
-		newScale = service.Scale - scaleChange
-		if newScale < min {
-			return http.StatusBadRequest, fmt.Errorf("Cannot scale below provided min scale value")
+		t.newScale = t.service.Scale - t.amount
+		if t.newScale < t.min {
+			return fmt.Errorf("Cannot scale below provided min scale value")
 		}
 	} else {
-		return http.StatusBadRequest, fmt.Errorf("Scale action not provided")
+		return fmt.Errorf("Scale action not provided")
 	}
+	return nil
+}
 
-	service, err = apiClient.Service.Update(service, client.Service{
-		Scale:        newScale,
-		CurrentScale: newScale,
-	})
-	if err != nil {
-		statusCode := err.(*client.ApiError).StatusCode
-		return statusCode, errors.Wrap(err, "Error in updateService")
+//rollbackScales scales services back to the scale they had before the execution, newest first
+func rollbackScales(apiClient *client.RancherClient, targets []scaleTarget, results []model.ServiceResult) {
+	for i := len(targets) - 1; i >= 0; i-- {
+		//a map so that rolling back to a scale of 0 isn't dropped as an empty field
+		_, err := apiClient.Service.Update(targets[i].service, map[string]interface{}{
+			"scale":        targets[i].service.Scale,
+			"currentScale": targets[i].service.Scale,
+		})
+		if err != nil {
+			results[i].State, results[i].Message = "rollbackFailed", err.Error()
+			continue
+		}
+		results[i].State, results[i].Scale = "rolledBack", targets[i].service.Scale
 	}
-	return http.StatusOK, nil
+}
+
+//cattleErrorCode returns the status of an error returned by Cattle, or 500
+func cattleErrorCode(err error) int {
+	if apiErr, ok := errors.Cause(err).(*client.ApiError); ok {
+		return apiErr.StatusCode
+	}
+	return http.StatusInternalServerError
 }
 
 func (s *ScaleServiceDriver) ConvertToConfigAndSetOnWebhook(conf interface{}, webhook *model.Webhook) error {
@@ -157,6 +496,16 @@ func (s *ScaleServiceDriver) CustomizeSchema(schema *v1client.Schema) *v1client.
 	min.Min = &minValue
 	schema.ResourceFields["min"] = min
 
+	for _, name := range []string{"resolvedServiceId", "resolvedServiceIds"} {
+		resolved := schema.ResourceFields[name]
+		resolved.Create = false
+		schema.ResourceFields[name] = resolved
+	}
+
+	targets := schema.ResourceFields["targets"]
+	targets.Type = "array[scaleServiceTarget]"
+	schema.ResourceFields["targets"] = targets
+
 	max := schema.ResourceFields["max"]
 	max.Default = 100
 	max.Min = &minValue
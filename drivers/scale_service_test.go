@@ -0,0 +1,246 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestScaleServiceEndToEnd(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	serviceID := server.Add("1a5", "service", map[string]interface{}{
+		"kind":         "service",
+		"scale":        2,
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:nginx"},
+	})
+	globalID := server.Add("1a5", "service", map[string]interface{}{
+		"kind":         "service",
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:nginx", "labels": map[string]interface{}{"io.rancher.scheduler.global": "true"}},
+	})
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &ScaleServiceDriver{}
+	config := model.ScaleService{ServiceID: serviceID, ScaleAction: "up", ScaleChange: 2, Min: 1, Max: 5}
+	if code, err := driver.ValidatePayload(config, apiClient); err != nil {
+		t.Fatalf("Unexpected validation failure %d: %v", code, err)
+	}
+	global := config
+	global.ServiceID = globalID
+	if code, _ := driver.ValidatePayload(global, apiClient); code != http.StatusBadRequest {
+		t.Errorf("Expected a global service to be rejected, got %d", code)
+	}
+	missing := config
+	missing.ServiceID = "1s404"
+	if code, _ := driver.ValidatePayload(missing, apiClient); code != http.StatusBadRequest {
+		t.Errorf("Expected a missing service to be rejected, got %d", code)
+	}
+
+	if code, err := driver.Execute(config, apiClient, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	service := server.Get("service", serviceID)
+	if service["scale"] != float64(4) || service["state"] != "updating-active" {
+		t.Fatalf("Unexpected service after scaling up %v %v", service["scale"], service["state"])
+	}
+
+	//A second scale up passes max
+	if code, _ := driver.Execute(config, apiClient, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected scaling above max to fail with 400, got %d", code)
+	}
+	if service := server.Get("service", serviceID); service["scale"] != float64(4) || service["state"] != "active" {
+		t.Fatalf("Unexpected service after failed scale up %v %v", service["scale"], service["state"])
+	}
+
+	down := config
+	down.ScaleAction = "down"
+	down.ScaleChange = 1
+	server.Fail("service", "update", http.StatusConflict)
+	if code, _ := driver.Execute(down, apiClient, nil); code != http.StatusConflict {
+		t.Errorf("Expected Cattle's status to be returned, got %d", code)
+	}
+	server.Recover()
+	if code, err := driver.Execute(down, apiClient, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	if service := server.Get("service", serviceID); service["scale"] != float64(3) {
+		t.Fatalf("Unexpected scale after scaling down %v", service["scale"])
+	}
+
+	server.Fail("service", "get", http.StatusInternalServerError)
+	if code, _ := driver.Execute(down, apiClient, nil); code != http.StatusInternalServerError {
+		t.Errorf("Expected failing to get the service to return 500, got %d", code)
+	}
+}
+
+func TestScaleServiceByNameAndSelector(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	stackID := server.Add("1a5", "stack", map[string]interface{}{"name": "web"})
+	launchConfig := map[string]interface{}{"imageUuid": "docker:nginx", "labels": map[string]interface{}{"app": "web"}}
+	serviceID := server.Add("1a5", "service", map[string]interface{}{"kind": "service", "name": "nginx", "stackId": stackID,
+		"scale": 1, "launchConfig": launchConfig})
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &ScaleServiceDriver{}
+	byName := model.ScaleService{StackName: "web", ServiceName: "nginx", ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 5}
+	bySelector := byName
+	bySelector.StackName, bySelector.ServiceName = "", ""
+	bySelector.ServiceSelector = map[string]string{"app": "web"}
+	for _, config := range []model.ScaleService{byName, bySelector} {
+		if code, err := driver.ValidatePayload(config, apiClient); err != nil {
+			t.Fatalf("Unexpected validation failure %d: %v", code, err)
+		}
+		resolved, warnings, err := driver.ResolveTarget(config, apiClient)
+		if err != nil || len(warnings) != 0 || resolved.(model.ScaleService).ResolvedServiceID != serviceID {
+			t.Fatalf("Unexpected resolution %#v %v %v", resolved, warnings, err)
+		}
+	}
+
+	for message, config := range map[string]model.ScaleService{
+		"must be provided together": {StackName: "web", ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 5},
+		"Only one of":               {ServiceID: serviceID, StackName: "web", ServiceName: "nginx", ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 5},
+		"Invalid service web/redis": {StackName: "web", ServiceName: "redis", ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 5},
+	} {
+		if code, err := driver.ValidatePayload(config, apiClient); code != http.StatusBadRequest || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q, got %d %v", message, code, err)
+		}
+	}
+
+	//the stack is recreated, the receiver follows the service by name
+	service, err := apiClient.Service.ById(serviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := apiClient.Stack.ById(stackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apiClient.Service.Delete(service); err != nil {
+		t.Fatal(err)
+	}
+	if err := apiClient.Stack.Delete(stack); err != nil {
+		t.Fatal(err)
+	}
+	newStackID := server.Add("1a5", "stack", map[string]interface{}{"name": "web"})
+	newServiceID := server.Add("1a5", "service", map[string]interface{}{"kind": "service", "name": "nginx", "stackId": newStackID,
+		"scale": 1, "launchConfig": launchConfig})
+	if code, err := driver.Execute(byName, apiClient, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	if service := server.Get("service", newServiceID); service["scale"] != float64(2) {
+		t.Fatalf("Expected the recreated service to be scaled, got %v", service["scale"])
+	}
+
+	//a second match makes the selector ambiguous, validation warns and executing fails
+	server.Add("1a5", "service", map[string]interface{}{"kind": "service", "name": "worker", "stackId": newStackID,
+		"scale": 1, "launchConfig": launchConfig})
+	if code, err := driver.ValidatePayload(bySelector, apiClient); err != nil {
+		t.Fatalf("Expected an ambiguous selector to be accepted, got %d %v", code, err)
+	}
+	resolved, warnings, err := driver.ResolveTarget(bySelector, apiClient)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "matches 2 services") ||
+		resolved.(model.ScaleService).ResolvedServiceID != "" {
+		t.Fatalf("Expected an ambiguity warning, got %#v %v %v", resolved, warnings, err)
+	}
+	if code, err := driver.Execute(bySelector, apiClient, nil); code != http.StatusConflict {
+		t.Fatalf("Expected an ambiguous selector to fail with 409, got %d %v", code, err)
+	}
+}
+
+func TestScaleServiceTargets(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	stackID := server.Add("1a5", "stack", map[string]interface{}{"name": "web"})
+	launchConfig := map[string]interface{}{"imageUuid": "docker:nginx", "labels": map[string]interface{}{"app": "web"}}
+	frontendID := server.Add("1a5", "service", map[string]interface{}{"kind": "service", "name": "frontend", "stackId": stackID,
+		"scale": 2, "launchConfig": launchConfig})
+	workersID := server.Add("1a5", "service", map[string]interface{}{"kind": "service", "name": "workers", "stackId": stackID,
+		"scale": 1, "launchConfig": launchConfig})
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := func(results []model.ServiceResult) string {
+		s := []string{}
+		for _, result := range results {
+			s = append(s, fmt.Sprintf("%s:%s:%d", result.ServiceID, result.State, result.Scale))
+		}
+		return strings.Join(s, " ")
+	}
+
+	driver := &ScaleServiceDriver{}
+	config := model.ScaleService{ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 3, Targets: []model.ScaleServiceTarget{
+		{ServiceID: frontendID},
+		{StackName: "web", ServiceName: "workers", ScaleChange: 2, Max: 10},
+	}}
+	if code, err := driver.ValidatePayload(config, apiClient); err != nil {
+		t.Fatalf("Unexpected validation failure %d: %v", code, err)
+	}
+	resolved, warnings, err := driver.ResolveTarget(config, apiClient)
+	if err != nil || len(warnings) != 0 ||
+		strings.Join(resolved.(model.ScaleService).ResolvedServiceIDs, ",") != frontendID+","+workersID {
+		t.Fatalf("Unexpected resolution %#v %v %v", resolved, warnings, err)
+	}
+
+	results, code, err := driver.ExecuteWithResults(config, apiClient, nil)
+	if err != nil || states(results) != fmt.Sprintf("%s:scaled:3 %s:scaled:3", frontendID, workersID) {
+		t.Fatalf("Unexpected execution %d %v %v", code, err, results)
+	}
+
+	//the frontend would pass its max, so neither service is scaled
+	updates := len(server.Requests())
+	results, code, err = driver.ExecuteWithResults(config, apiClient, nil)
+	if code != http.StatusBadRequest || !strings.Contains(err.Error(), "Not scaling any service") ||
+		states(results) != fmt.Sprintf("%s:failed:3 %s:skipped:3", frontendID, workersID) {
+		t.Fatalf("Expected a bounds failure to scale nothing, got %d %v %v", code, err, results)
+	}
+	if len(server.Requests()) != updates {
+		t.Fatalf("Unexpected updates %v", server.Requests()[updates:])
+	}
+
+	//the workers fail to scale down, so the frontend is scaled back
+	down := config
+	down.ScaleAction = "down"
+	server.FailResource("service", workersID, http.StatusConflict)
+	results, code, err = driver.ExecuteWithResults(down, apiClient, nil)
+	if code != http.StatusConflict || states(results) != fmt.Sprintf("%s:rolledBack:3 %s:failed:3", frontendID, workersID) {
+		t.Fatalf("Expected the frontend to be rolled back, got %d %v %v", code, err, results)
+	}
+	if service := server.Get("service", frontendID); service["scale"] != float64(3) {
+		t.Fatalf("Expected the frontend to be scaled back to 3, got %v", service["scale"])
+	}
+	server.Recover()
+
+	selected := model.ScaleService{ScaleAction: "down", ScaleChange: 1, Min: 1, Max: 3,
+		ServiceSelector: map[string]string{"app": "web"}}
+	if code, _ := driver.Execute(selected, apiClient, nil); code != http.StatusConflict {
+		t.Fatalf("Expected a selector matching two services to need allMatching, got %d", code)
+	}
+	selected.AllMatching = true
+	results, code, err = driver.ExecuteWithResults(selected, apiClient, nil)
+	if err != nil || states(results) != fmt.Sprintf("%s:scaled:2 %s:scaled:2", frontendID, workersID) {
+		t.Fatalf("Unexpected execution %d %v %v", code, err, results)
+	}
+
+	for message, invalid := range map[string]model.ScaleService{
+		"more than once":           {ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 3, Targets: []model.ScaleServiceTarget{{ServiceID: frontendID}, {StackName: "web", ServiceName: "frontend"}}},
+		"Target 2: Invalid amount": {ScaleAction: "up", Min: 1, Max: 3, Targets: []model.ScaleServiceTarget{{ServiceID: frontendID, ScaleChange: 1}, {ServiceID: workersID}}},
+		"allMatching":              {ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 3, ServiceID: frontendID, AllMatching: true},
+		"Only one of":              {ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 3, ServiceID: frontendID, Targets: []model.ScaleServiceTarget{{ServiceID: workersID}}},
+	} {
+		if code, err := driver.ValidatePayload(invalid, apiClient); code != http.StatusBadRequest || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q, got %d %v", message, code, err)
+		}
+	}
+}
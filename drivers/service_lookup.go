@@ -0,0 +1,76 @@
+package drivers
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v2"
+)
+
+//FindServiceByName returns the service serviceName of the stack stackName, or nil when there's no
+//such service. Names are unique within a stack, unlike IDs they survive recreating the stack.
+func FindServiceByName(apiClient *client.RancherClient, stackName string, serviceName string) (*client.Service, error) {
+	stacks, err := apiClient.Stack.List(&client.ListOpts{
+		Filters: map[string]interface{}{"name": stackName, "removed_null": true},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing stacks")
+	}
+
+	for _, stack := range stacks.Data {
+		if stack.Name != stackName || stack.Removed != "" {
+			continue
+		}
+		services, err := apiClient.Service.List(&client.ListOpts{
+			Filters: map[string]interface{}{"name": serviceName, "stackId": stack.Id, "removed_null": true},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in listing services")
+		}
+		for _, service := range services.Data {
+			if service.Name == serviceName && service.StackId == stack.Id && service.Removed == "" {
+				service := service
+				return &service, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+//FindServicesBySelector returns the services whose launch config has all the labels of selector
+func FindServicesBySelector(apiClient *client.RancherClient, selector map[string]string) ([]client.Service, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("Empty service selector")
+	}
+	services, err := apiClient.Service.List(&client.ListOpts{
+		Filters: map[string]interface{}{"removed_null": true},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing services")
+	}
+
+	matched := []client.Service{}
+	for services != nil {
+		for _, service := range services.Data {
+			if service.Removed == "" && service.LaunchConfig != nil && hasLabels(service.LaunchConfig.Labels, selector) {
+				matched = append(matched, service)
+			}
+		}
+		if services.Pagination == nil || services.Pagination.Next == "" {
+			break
+		}
+		if services, err = services.Next(); err != nil {
+			return nil, errors.Wrap(err, "Error in listing services")
+		}
+	}
+	return matched, nil
+}
+
+func hasLabels(labels map[string]interface{}, selector map[string]string) bool {
+	for key, value := range selector {
+		if label, ok := labels[key].(string); !ok || label != value {
+			return false
+		}
+	}
+	return true
+}
@@ -26,6 +26,12 @@ func (s *ServiceUpgradeDriver) ValidatePayload(conf interface{}, apiClient *clie
 		return http.StatusInternalServerError, fmt.Errorf("Can't process config")
 	}
 
+	return validateServiceUpgradeConfig(config)
+}
+
+//validateServiceUpgradeConfig checks the config on its own, at creation and again in Execute once
+//request overrides are merged in
+func validateServiceUpgradeConfig(config model.ServiceUpgrade) (int, error) {
 	if config.ServiceSelector == nil {
 		return http.StatusBadRequest, fmt.Errorf("Service selectors not provided")
 	}
@@ -58,6 +64,10 @@ func (s *ServiceUpgradeDriver) Execute(conf interface{}, apiClient *client.Ranch
 		return http.StatusInternalServerError, errors.Wrap(err, "Couldn't unmarshal config")
 	}
 
+	if code, err := validateServiceUpgradeConfig(*config); err != nil {
+		return code, err
+	}
+
 	requestedTag := config.Tag
 	if requestPayload == nil {
 		return http.StatusBadRequest, fmt.Errorf("No Payload recevied from Docker Hub webhook")
@@ -95,7 +105,9 @@ func (s *ServiceUpgradeDriver) Execute(conf interface{}, apiClient *client.Ranch
 
 	log.Infof("Image %s pushed in Docker Hub, upgrading services with serviceSelector %v", pushedImage, config.ServiceSelector)
 
-	go upgradeServices(apiClient, config, pushedImage)
+	goBackground(func() {
+		upgradeServices(apiClient, config, pushedImage)
+	})
 
 	return http.StatusOK, nil
 }
@@ -154,45 +166,49 @@ func upgradeServices(apiClient *client.RancherClient, config *model.ServiceUpgra
 			continue
 		}
 
-		go func(service client.Service, apiClient *client.RancherClient, newLaunchConfig *client.LaunchConfig,
-			secConfigs []client.SecondaryLaunchConfig, primaryPresent bool, secondaryPresent bool) {
-			upgStrategy := &client.InServiceUpgradeStrategy{
-				BatchSize:      batchSize,
-				IntervalMillis: intervalMillis * 1000,
-				StartFirst:     startFirst,
-			}
-			if primaryPresent && secondaryPresent {
-				upgStrategy.LaunchConfig = newLaunchConfig
-				upgStrategy.SecondaryLaunchConfigs = secConfigs
-			} else if primaryPresent && !secondaryPresent {
-				upgStrategy.LaunchConfig = newLaunchConfig
-			} else if !primaryPresent && secondaryPresent {
-				upgStrategy.SecondaryLaunchConfigs = secConfigs
-			}
+		upgStrategy := &client.InServiceUpgradeStrategy{
+			BatchSize:      batchSize,
+			IntervalMillis: intervalMillis * 1000,
+			StartFirst:     startFirst,
+		}
+		if primaryPresent && secondaryPresent {
+			upgStrategy.LaunchConfig = newLaunchConfig
+			upgStrategy.SecondaryLaunchConfigs = secConfigs
+		} else if primaryPresent && !secondaryPresent {
+			upgStrategy.LaunchConfig = newLaunchConfig
+		} else if !primaryPresent && secondaryPresent {
+			upgStrategy.SecondaryLaunchConfigs = secConfigs
+		}
 
-			upgradedService, err := apiClient.Service.ActionUpgrade(&service, &client.ServiceUpgrade{
-				InServiceStrategy: upgStrategy,
-			})
-			if err != nil {
-				log.Errorf("Error %v in upgrading service %s", err, service.Id)
-				return
-			}
+		service := service
+		goBackground(func() {
+			upgradeService(apiClient, service, upgStrategy)
+		})
+	}
+}
 
-			if err := wait(apiClient, upgradedService); err != nil {
-				log.Errorln(err)
-				return
-			}
+func upgradeService(apiClient *client.RancherClient, service client.Service, upgStrategy *client.InServiceUpgradeStrategy) {
+	upgradedService, err := apiClient.Service.ActionUpgrade(&service, &client.ServiceUpgrade{
+		InServiceStrategy: upgStrategy,
+	})
+	if err != nil {
+		log.Errorf("Error %v in upgrading service %s", err, service.Id)
+		return
+	}
 
-			if upgradedService.State != "upgraded" {
-				return
-			}
+	if err := wait(apiClient, upgradedService); err != nil {
+		log.Errorln(err)
+		return
+	}
 
-			_, err = apiClient.Service.ActionFinishupgrade(upgradedService)
-			if err != nil {
-				log.Errorf("Error %v in finishUpgrade of service %s", err, upgradedService.Id)
-				return
-			}
-		}(service, apiClient, newLaunchConfig, secConfigs, primaryPresent, secondaryPresent)
+	if upgradedService.State != "upgraded" {
+		return
+	}
+
+	_, err = apiClient.Service.ActionFinishupgrade(upgradedService)
+	if err != nil {
+		log.Errorf("Error %v in finishUpgrade of service %s", err, upgradedService.Id)
+		return
 	}
 }
 
@@ -0,0 +1,81 @@
+package drivers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestServiceUpgradeEndToEnd(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	webID := server.Add("1a5", "service", map[string]interface{}{
+		"kind":         "service",
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:org/web:v1", "labels": map[string]interface{}{"upgrade": "web"}},
+	})
+	dbID := server.Add("1a5", "service", map[string]interface{}{
+		"kind":         "service",
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:org/db:v1", "labels": map[string]interface{}{"upgrade": "db"}},
+	})
+	apiClient, err := server.GetClient("1a5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &ServiceUpgradeDriver{}
+	config := model.ServiceUpgrade{
+		ServiceSelector: map[string]string{"upgrade": "web"},
+		Tag:             "v2",
+		BatchSize:       1,
+		IntervalMillis:  2,
+	}
+	push := func(tag string) map[string]interface{} {
+		return map[string]interface{}{
+			"push_data":  map[string]interface{}{"tag": tag},
+			"repository": map[string]interface{}{"repo_name": "org/web"},
+		}
+	}
+
+	if code, _ := driver.Execute(config, apiClient, map[string]interface{}{}); code != http.StatusBadRequest {
+		t.Errorf("Expected an incomplete payload to be rejected, got %d", code)
+	}
+	if code, err := driver.Execute(config, apiClient, push("v3")); err != nil || code != http.StatusOK {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	if code, err := driver.Execute(config, apiClient, push("v2")); err != nil || code != http.StatusOK {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	if !WaitForBackgroundWork(10 * time.Second) {
+		t.Fatal("Upgrade didn't finish")
+	}
+
+	web := server.Get("service", webID)
+	launchConfig := web["launchConfig"].(map[string]interface{})
+	if web["state"] != "finishing-upgrade" || launchConfig["imageUuid"] != "docker:org/web:v2" {
+		t.Fatalf("Unexpected service after upgrade %v %v", web["state"], launchConfig["imageUuid"])
+	}
+	if db := server.Get("service", dbID); db["launchConfig"].(map[string]interface{})["imageUuid"] != "docker:org/db:v1" {
+		t.Fatalf("Service not matching the selector was upgraded")
+	}
+	expected := []string{"upgrade service " + webID, "finishupgrade service " + webID}
+	if requests := server.Requests(); len(requests) != 2 || requests[0] != expected[0] || requests[1] != expected[1] {
+		t.Fatalf("Unexpected requests %v", requests)
+	}
+
+	//A failed upgrade is not finished
+	server.FailTransition("service", "upgrade", "Failed to pull image")
+	if code, err := driver.Execute(config, apiClient, push("v2")); err != nil || code != http.StatusOK {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	WaitForBackgroundWork(10 * time.Second)
+	web = server.Get("service", webID)
+	if web["transitioning"] != "error" || web["transitioningMessage"] != "Failed to pull image" {
+		t.Fatalf("Expected the upgrade to fail, got %v %v", web["transitioning"], web["transitioningMessage"])
+	}
+	if requests := server.Requests(); requests[len(requests)-1] != "upgrade service "+webID {
+		t.Fatalf("Expected a failed upgrade not to be finished, got %v", requests)
+	}
+}
@@ -0,0 +1,249 @@
+//Package expr evaluates the small expression language receivers use to filter and pick apart
+//request bodies, for example
+//
+//	status == "firing" && labels.severity in ["critical", "page"]
+//	alerts[0].labels.count
+//
+//Paths are looked up in the request body, $ is the body itself. A path that doesn't exist is
+//null. Numbers compare as numbers and strings as strings, ordering values of different types is
+//false rather than an error so a missing field simply doesn't match.
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//Expression is a parsed expression
+type Expression struct {
+	source string
+	root   node
+}
+
+//Parse parses an expression
+func Parse(source string) (*Expression, error) {
+	p := &parser{lexer: newLexer(source)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %v", p.tok)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+//Evaluate returns the value of the expression against data, which is a decoded JSON value
+func (e *Expression) Evaluate(data interface{}) (interface{}, error) {
+	return e.root.eval(data)
+}
+
+//Match evaluates an expression that must be true or false
+func (e *Expression) Match(data interface{}) (bool, error) {
+	value, err := e.Evaluate(data)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("Expression %q is %v, not true or false", e.source, describe(value))
+	}
+	return b, nil
+}
+
+type node interface {
+	eval(data interface{}) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(data interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type list struct {
+	items []node
+}
+
+func (n *list) eval(data interface{}) (interface{}, error) {
+	values := []interface{}{}
+	for _, item := range n.items {
+		value, err := item.eval(data)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+//path is a lookup in the data, a sequence of object keys (string) and array indexes (int)
+type path struct {
+	steps []interface{}
+}
+
+func (n *path) eval(data interface{}) (interface{}, error) {
+	current := data
+	for _, step := range n.steps {
+		switch s := step.(type) {
+		case string:
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			current = object[s]
+		case int:
+			array, ok := current.([]interface{})
+			if !ok || s < 0 || s >= len(array) {
+				return nil, nil
+			}
+			current = array[s]
+		}
+	}
+	return current, nil
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(data interface{}) (interface{}, error) {
+	value, err := n.operand.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("Can't apply ! to %v", describe(value))
+	}
+	return !b, nil
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n *logical) eval(data interface{}) (interface{}, error) {
+	left, err := n.operand(n.left, data)
+	if err != nil {
+		return nil, err
+	}
+	if (n.op == "&&" && !left) || (n.op == "||" && left) {
+		return left, nil
+	}
+	return n.operand(n.right, data)
+}
+
+func (n *logical) operand(operand node, data interface{}) (bool, error) {
+	value, err := operand.eval(data)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("Can't apply %s to %v", n.op, describe(value))
+	}
+	return b, nil
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n *comparison) eval(data interface{}) (interface{}, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			for _, item := range r {
+				if equal(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			l, ok := left.(string)
+			return ok && strings.Contains(r, l), nil
+		}
+		return false, nil
+	}
+
+	if l, ok := toNumber(left); ok {
+		if r, ok := toNumber(right); ok {
+			return compare(n.op, l < r, l == r), nil
+		}
+		return false, nil
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compare(n.op, l < r, l == r), nil
+		}
+	}
+	return false, nil
+}
+
+func compare(op string, less bool, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+	return false
+}
+
+func equal(a interface{}, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func describe(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T %v", value, value)
+}
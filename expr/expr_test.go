@@ -0,0 +1,84 @@
+package expr
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const alert = `{
+	"status": "firing",
+	"labels": {"severity": "critical", "team-name": "ops"},
+	"alerts": [{"labels": {"count": 3}}, {"labels": {"count": 5}}],
+	"repository": {"repo_name": "rancher/server"},
+	"push_data": {"tag": "v1.2"}
+}`
+
+func TestEvaluate(t *testing.T) {
+	var body interface{}
+	if err := json.Unmarshal([]byte(alert), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source   string
+		expected interface{}
+	}{
+		{`status == "firing"`, true},
+		{`status == 'resolved'`, false},
+		{`status == "firing" && labels.severity == "critical"`, true},
+		{`status == "firing" && labels.severity == "warning"`, false},
+		{`status == "resolved" || labels.severity == "critical"`, true},
+		{`!(status == "resolved")`, true},
+		{`labels["team-name"] == "ops"`, true},
+		{`labels.team-name`, "ops"},
+		{`alerts[1].labels.count`, float64(5)},
+		{`alerts[1].labels.count > 4`, true},
+		{`alerts[0].labels.count >= 3.5`, false},
+		{`alerts[0].labels.count <= -1`, false},
+		{`alerts[9].labels.count`, nil},
+		{`missing.field == null`, true},
+		{`missing.field > 1`, false},
+		{`status > 1`, false},
+		{`labels.severity in ["critical", "page"]`, true},
+		{`labels.severity in []`, false},
+		{`"rancher" in repository.repo_name`, true},
+		{`$.push_data.tag`, "v1.2"},
+		{`$.status != "firing"`, false},
+		{`1e1 == 10`, true},
+		{`true`, true},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.source)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.source, err)
+			continue
+		}
+		value, err := e.Evaluate(body)
+		if err != nil {
+			t.Errorf("Evaluate(%q) failed: %v", test.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("Evaluate(%q) = %#v, expected %#v", test.source, value, test.expected)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, source := range []string{``, `status ==`, `status == "firing`, `(status`, `a.`, `a[1.5]`, `a[b]`, `status # 1`, `[1, 2`, `a == b c`} {
+		if _, err := Parse(source); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", source)
+		}
+	}
+
+	for _, source := range []string{`status`, `status && true`, `!status`} {
+		e, err := Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Match(map[string]interface{}{"status": "firing"}); err == nil {
+			t.Errorf("Expected Match(%q) to fail on a non-boolean", source)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+type lexer struct {
+	source string
+	pos    int
+}
+
+func newLexer(source string) *lexer {
+	return &lexer{source: source}
+}
+
+//operators is ordered so two character operators are matched first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", ".", "[", "]", "(", ")", ",", "$"}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.source) && unicode.IsSpace(rune(l.source[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.source) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.source[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case c >= '0' && c <= '9' || (c == '-' && l.pos+1 < len(l.source) && l.source[l.pos+1] >= '0' && l.source[l.pos+1] <= '9'):
+		l.pos++
+		for l.pos < len(l.source) && strings.IndexByte("0123456789.eE+-", l.source[l.pos]) >= 0 {
+			if (l.source[l.pos] == '+' || l.source[l.pos] == '-') && l.source[l.pos-1] != 'e' && l.source[l.pos-1] != 'E' {
+				break
+			}
+			l.pos++
+		}
+		text := l.source[start:l.pos]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, fmt.Errorf("Invalid number %q at %d", text, start)
+		}
+		return token{kind: tokNumber, text: text, value: value, pos: start}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || l.source[l.pos] == '-' ||
+			unicode.IsLetter(rune(l.source[l.pos])) || unicode.IsDigit(rune(l.source[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.source[start:l.pos], pos: start}, nil
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(l.source[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("Unexpected character %q at %d", c, start)
+}
+
+func (l *lexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	l.pos++
+	value := []byte{}
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: l.source[start:l.pos], value: string(value), pos: start}, nil
+		case c == '\\' && l.pos+1 < len(l.source):
+			l.pos++
+			switch e := l.source[l.pos]; e {
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			default:
+				value = append(value, e)
+			}
+		default:
+			value = append(value, c)
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("Unterminated string at %d", start)
+}
+
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid expression %q: %s", p.lexer.source, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp && !(p.tok.kind == tokIdent && p.tok.text == "in") {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q, got %v", op, p.tok)
+	}
+	return p.next()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=", "in") {
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokString || tok.kind == tokNumber:
+		return &literal{value: tok.value}, p.next()
+	case tok.kind == tokIdent && tok.text == "true":
+		return &literal{value: true}, p.next()
+	case tok.kind == tokIdent && tok.text == "false":
+		return &literal{value: false}, p.next()
+	case tok.kind == tokIdent && tok.text == "null":
+		return &literal{value: nil}, p.next()
+	case tok.kind == tokIdent && tok.text != "in", p.isOp("$"):
+		return p.parsePath()
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case p.isOp("["):
+		return p.parseList()
+	}
+	return nil, p.errorf("unexpected %v", tok)
+}
+
+func (p *parser) parsePath() (node, error) {
+	n := &path{}
+	if p.isOp("$") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	} else {
+		n.steps = append(n.steps, p.tok.text)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		switch {
+		case p.isOp("."):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected a field name, got %v", p.tok)
+			}
+			n.steps = append(n.steps, p.tok.text)
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		case p.isOp("["):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			switch p.tok.kind {
+			case tokString:
+				n.steps = append(n.steps, p.tok.value.(string))
+			case tokNumber:
+				index := p.tok.value.(float64)
+				if index != float64(int(index)) {
+					return nil, p.errorf("invalid index %v", p.tok)
+				}
+				n.steps = append(n.steps, int(index))
+			default:
+				return nil, p.errorf("expected a quoted field name or an index, got %v", p.tok)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parseList() (node, error) {
+	n := &list{}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for !p.isOp("]") {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+		if !p.isOp(",") {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return n, p.expect("]")
+}
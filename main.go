@@ -2,12 +2,15 @@ package main
 
 import (
 	"fmt"
-	"net/http"
+	"io"
 	"os"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/webhook-service/cmd"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/service"
+	"github.com/rancher/webhook-service/store"
 	"github.com/urfave/cli"
 )
 
@@ -19,7 +22,39 @@ func main() {
 	app.Version = VERSION
 	app.Usage = "You need help!"
 	app.Action = StartWebhook
-	app.Commands = []cli.Command{}
+	app.Commands = []cli.Command{
+		{
+			Name:   "migrate",
+			Usage:  "Copy the receivers of one or more projects from one receiver store to another",
+			Action: MigrateReceivers,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "Receiver store to copy from: cattle, bolt or memory",
+					Value: "cattle",
+				},
+				cli.StringFlag{
+					Name:  "from-file",
+					Usage: "Path of the source store when --from is bolt",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "Receiver store to copy to: cattle, bolt or memory",
+					Value: "bolt",
+				},
+				cli.StringFlag{
+					Name:  "to-file",
+					Usage: "Path of the destination store when --to is bolt",
+				},
+				cli.StringSliceFlag{
+					Name:  "project-id",
+					Usage: "Project whose receivers are copied. May be repeated",
+				},
+			},
+		},
+		cmd.ReceiversCommand(),
+		cmd.KeysCommand(),
+	}
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name: "rsa-public-key-file",
@@ -47,23 +82,198 @@ func main() {
 			),
 			EnvVar: "RSA_PRIVATE_KEY_CONTENTS",
 		},
+		cli.StringFlag{
+			Name:   "rsa-public-keys-dir",
+			Usage:  "Directory of additional PEM public keys (*.pem) tokens may be verified with, reloaded on SIGHUP",
+			EnvVar: "RSA_PUBLIC_KEYS_DIR",
+		},
+		cli.StringFlag{
+			Name:   "rsa-public-keys-jwks-file",
+			Usage:  "JWKS file of additional public keys tokens may be verified with, reloaded on SIGHUP",
+			EnvVar: "RSA_PUBLIC_KEYS_JWKS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "listen-address",
+			Usage:  "Address the webhook service listens on",
+			Value:  ":8085",
+			EnvVar: "LISTEN_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert-file",
+			Usage:  "Path to the TLS certificate. The certificate is reloaded when the file changes",
+			EnvVar: "TLS_CERT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "tls-key-file",
+			Usage:  "Path to the TLS private key",
+			EnvVar: "TLS_KEY_FILE",
+		},
+		cli.StringFlag{
+			Name:   "tls-client-ca-file",
+			Usage:  "Path to a CA bundle. When set, clients must present a certificate signed by it",
+			EnvVar: "TLS_CLIENT_CA_FILE",
+		},
+		cli.DurationFlag{
+			Name:   "read-timeout",
+			Usage:  "Maximum duration for reading an entire request",
+			Value:  30 * time.Second,
+			EnvVar: "READ_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "write-timeout",
+			Usage:  "Maximum duration before timing out writes of a response",
+			Value:  60 * time.Second,
+			EnvVar: "WRITE_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "idle-timeout",
+			Usage:  "Maximum time to wait for the next request on a keep-alive connection",
+			Value:  120 * time.Second,
+			EnvVar: "IDLE_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "shutdown-timeout",
+			Usage:  "Maximum time to wait for in-flight requests and background driver work on shutdown",
+			Value:  5 * time.Minute,
+			EnvVar: "SHUTDOWN_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "client-cache-ttl",
+			Usage:  "How long a Rancher API client, and the project schemas it downloaded, is reused",
+			Value:  5 * time.Minute,
+			EnvVar: "CLIENT_CACHE_TTL",
+		},
+		cli.DurationFlag{
+			Name:   "readiness-cache-ttl",
+			Usage:  "How long /readyz reuses its last result. Keep it below the readiness probe's period",
+			Value:  2 * time.Second,
+			EnvVar: "READINESS_CACHE_TTL",
+		},
+		cli.StringFlag{
+			Name:   "receiver-store",
+			Usage:  "Where receivers are stored: cattle (GenericObjects), bolt or memory",
+			Value:  "cattle",
+			EnvVar: "RECEIVER_STORE",
+		},
+		cli.StringFlag{
+			Name:   "receiver-store-file",
+			Usage:  "Path of the receiver store file when receiver-store is bolt",
+			EnvVar: "RECEIVER_STORE_FILE",
+		},
+		cli.StringFlag{
+			Name:   "template-project-id",
+			Usage:  "Project whose members manage receiver templates, and where the cattle receiver store keeps them. Templates are disabled with the cattle store when unset",
+			EnvVar: "TEMPLATE_PROJECT_ID",
+		},
+		cli.BoolFlag{
+			Name:   "disable-management-auth",
+			Usage:  "Don't require a Rancher API key or token on the receivers API. Anyone who can reach the service can then manage any project's receivers",
+			EnvVar: "DISABLE_MANAGEMENT_AUTH",
+		},
+		cli.Int64Flag{
+			Name:   "max-body-bytes",
+			Usage:  "Largest request body accepted by receiver URLs, larger requests get a 413",
+			Value:  1 << 20,
+			EnvVar: "MAX_BODY_BYTES",
+		},
+		cli.StringSliceFlag{
+			Name:   "trusted-proxies",
+			Usage:  "Addresses or CIDRs of proxies whose X-Forwarded-For header is trusted when checking a receiver's allowedCIDRs",
+			EnvVar: "TRUSTED_PROXIES",
+		},
+		cli.StringSliceFlag{
+			Name:   "token-audience",
+			Usage:  "Audience a receiver token may be minted for and executed with, can be repeated. When set, tokens minted without an audience get the first one and tokens without an audience are rejected. Any audience is accepted when unset",
+			EnvVar: "TOKEN_AUDIENCE",
+		},
 	}
 	app.Run(os.Args)
 }
 
 func StartWebhook(c *cli.Context) {
 	drivers.RegisterDrivers()
-	privateKey, publicKey, err := service.GetKeys(c)
+	keys, err := service.LoadKeySet(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys.ReloadOnSIGHUP()
+
+	clientFactory := service.NewClientFactory(c.GlobalDuration("client-cache-ttl"))
+	receiverStore, err := store.New(c.GlobalString("receiver-store"), c.GlobalString("receiver-store-file"), clientFactory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	templateStore, err := store.NewTemplateStore(c.GlobalString("receiver-store"), receiverStore, clientFactory,
+		c.GlobalString("template-project-id"))
 	if err != nil {
-		log.Fatal("rsa-private-key-file or rsa-public-key-file not provided, halting")
+		log.Fatal(err)
+	}
+
+	trustedProxies, err := service.ParseCIDRs(c.GlobalStringSlice("trusted-proxies"))
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	rh := &service.RouteHandler{
-		PrivateKey:    privateKey,
-		PublicKey:     publicKey,
-		ClientFactory: &service.ClientFactory{},
+		Keys:           keys,
+		ClientFactory:  clientFactory,
+		Store:          receiverStore,
+		TokenAudiences: c.GlobalStringSlice("token-audience"),
+		TrustedProxies: trustedProxies,
+		MaxBodyBytes:   c.GlobalInt64("max-body-bytes"),
+
+		ReadinessCacheTTL: c.GlobalDuration("readiness-cache-ttl"),
+
+		Templates:         templateStore,
+		TemplateProjectID: c.GlobalString("template-project-id"),
+	}
+	if c.GlobalBool("disable-management-auth") {
+		log.Warn("Management API authentication is disabled")
+	} else {
+		rh.Authorizer = &service.CattleAuthorizer{Clients: clientFactory}
 	}
 	router := service.NewRouter(rh)
-	log.Infof("Webhook service listening on 8085")
-	log.Fatal(http.ListenAndServe(":8085", router))
+	err = service.ListenAndServe(router, service.ServerOpts{
+		ListenAddress:   c.GlobalString("listen-address"),
+		TLSCertFile:     c.GlobalString("tls-cert-file"),
+		TLSKeyFile:      c.GlobalString("tls-key-file"),
+		TLSClientCAFile: c.GlobalString("tls-client-ca-file"),
+		ReadTimeout:     c.GlobalDuration("read-timeout"),
+		WriteTimeout:    c.GlobalDuration("write-timeout"),
+		IdleTimeout:     c.GlobalDuration("idle-timeout"),
+		ShutdownTimeout: c.GlobalDuration("shutdown-timeout"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func MigrateReceivers(c *cli.Context) {
+	projectIDs := c.StringSlice("project-id")
+	if len(projectIDs) == 0 {
+		log.Fatal("At least one project-id must be provided")
+	}
+
+	clientFactory := service.NewClientFactory(c.GlobalDuration("client-cache-ttl"))
+	from, err := store.New(c.String("from"), c.String("from-file"), clientFactory)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if closer, ok := from.(io.Closer); ok {
+		defer closer.Close()
+	}
+	to, err := store.New(c.String("to"), c.String("to-file"), clientFactory)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if closer, ok := to.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	copied, err := store.Migrate(from, to, projectIDs)
+	if err != nil {
+		log.Fatalf("Migration stopped after copying %d receivers: %v", copied, err)
+	}
+	log.Infof("Copied %d receivers from %s to %s", copied, c.String("from"), c.String("to"))
 }
@@ -1,13 +1,34 @@
 package model
 
-//ScaleService driver
+//ScaleService driver. The service is given by its ID, by StackName and ServiceName, or by a
+//ServiceSelector matching its labels. Names and selectors are resolved on every execution, so they
+//keep working when a stack is recreated. Several services are scaled together by listing them in
+//Targets, or by a selector with AllMatching set. Resolved IDs are output only.
 type ScaleService struct {
+	ServiceID          string               `json:"serviceId,omitempty" mapstructure:"serviceId"`
+	StackName          string               `json:"stackName,omitempty" mapstructure:"stackName"`
+	ServiceName        string               `json:"serviceName,omitempty" mapstructure:"serviceName"`
+	ServiceSelector    map[string]string    `json:"serviceSelector,omitempty" mapstructure:"serviceSelector"`
+	AllMatching        bool                 `json:"allMatching,omitempty" mapstructure:"allMatching"`
+	Targets            []ScaleServiceTarget `json:"targets,omitempty" mapstructure:"targets"`
+	ResolvedServiceID  string               `json:"resolvedServiceId,omitempty" mapstructure:"resolvedServiceId"`
+	ResolvedServiceIDs []string             `json:"resolvedServiceIds,omitempty" mapstructure:"resolvedServiceIds"`
+	ScaleChange        int64                `json:"amount,omitempty" mapstructure:"amount"`
+	ScaleAction        string               `json:"action,omitempty" mapstructure:"action"`
+	Min                int64                `json:"min,omitempty" mapstructure:"min"`
+	Max                int64                `json:"max,omitempty" mapstructure:"max"`
+	Type               string               `json:"type,omitempty" mapstructure:"type"`
+}
+
+//ScaleServiceTarget is one of the services a scaleService receiver scales together. Amount, min and
+//max default to the receiver's.
+type ScaleServiceTarget struct {
 	ServiceID   string `json:"serviceId,omitempty" mapstructure:"serviceId"`
+	StackName   string `json:"stackName,omitempty" mapstructure:"stackName"`
+	ServiceName string `json:"serviceName,omitempty" mapstructure:"serviceName"`
 	ScaleChange int64  `json:"amount,omitempty" mapstructure:"amount"`
-	ScaleAction string `json:"action,omitempty" mapstructure:"action"`
 	Min         int64  `json:"min,omitempty" mapstructure:"min"`
 	Max         int64  `json:"max,omitempty" mapstructure:"max"`
-	Type        string `json:"type,omitempty" mapstructure:"type"`
 }
 
 //ServiceUpgrade driver
@@ -22,12 +43,27 @@ type ServiceUpgrade struct {
 
 //ScaleHost driver
 type ScaleHost struct {
-	HostSelector   map[string]string `json:"hostSelector,omitempty" mapstructure:"hostSelector"`
-	HostTemplateID string            `json:"hostTemplateId,omitempty" mapstructure:"hostTemplateId"`
-	Amount         int64             `json:"amount,omitempty" mapstructure:"amount"`
-	Action         string            `json:"action,omitempty" mapstructure:"action"`
-	Min            int64             `json:"min,omitempty" mapstructure:"min"`
-	Max            int64             `json:"max,omitempty" mapstructure:"max"`
-	DeleteOption   string            `json:"deleteOption,omitempty" mapstructure:"deleteOption"`
-	Type           string            `json:"type,omitempty" mapstructure:"type"`
+	HostSelector        map[string]string    `json:"hostSelector,omitempty" mapstructure:"hostSelector"`
+	HostTemplateID      string               `json:"hostTemplateId,omitempty" mapstructure:"hostTemplateId"`
+	HostTemplates       []HostTemplateWeight `json:"hostTemplates,omitempty" mapstructure:"hostTemplates"`
+	Amount              int64                `json:"amount,omitempty" mapstructure:"amount"`
+	Action              string               `json:"action,omitempty" mapstructure:"action"`
+	Min                 int64                `json:"min,omitempty" mapstructure:"min"`
+	Max                 int64                `json:"max,omitempty" mapstructure:"max"`
+	DeleteOption        string               `json:"deleteOption,omitempty" mapstructure:"deleteOption"`
+	DeletePriorityLabel string               `json:"deletePriorityLabel,omitempty" mapstructure:"deletePriorityLabel"`
+	ProtectedLabel      string               `json:"protectedLabel,omitempty" mapstructure:"protectedLabel"`
+	CloneLabels         map[string]string    `json:"cloneLabels,omitempty" mapstructure:"cloneLabels"`
+	CloneDriverConfig   map[string]string    `json:"cloneDriverConfig,omitempty" mapstructure:"cloneDriverConfig"`
+	HostnameTemplate    string               `json:"hostnameTemplate,omitempty" mapstructure:"hostnameTemplate"`
+	Force               bool                 `json:"force,omitempty" mapstructure:"force"`
+	DrainTimeoutSeconds int64                `json:"drainTimeoutSeconds,omitempty" mapstructure:"drainTimeoutSeconds"`
+	Type                string               `json:"type,omitempty" mapstructure:"type"`
+}
+
+//HostTemplateWeight is one template of a scaleHost group spread over several templates. New hosts
+//are spread across templates in proportion to their weights, which default to 1.
+type HostTemplateWeight struct {
+	HostTemplateID string `json:"hostTemplateId,omitempty" mapstructure:"hostTemplateId"`
+	Weight         int64  `json:"weight,omitempty" mapstructure:"weight"`
 }
@@ -13,16 +13,148 @@ type ServerAPIError struct {
 
 type Webhook struct {
 	v1client.Resource
-	URL                  string         `json:"url"`
-	Driver               string         `json:"driver"`
-	Name                 string         `json:"name"`
-	State                string         `json:"state"`
-	ScaleServiceConfig   ScaleService   `json:"scaleServiceConfig"`
-	ServiceUpgradeConfig ServiceUpgrade `json:"serviceUpgradeConfig"`
-	ScaleHostConfig      ScaleHost      `json:"scaleHostConfig"`
+	URL                  string                    `json:"url"`
+	Driver               string                    `json:"driver"`
+	Name                 string                    `json:"name"`
+	State                string                    `json:"state"`
+	Message              string                    `json:"message,omitempty"`
+	Warnings             []string                  `json:"warnings,omitempty"`
+	ScaleServiceConfig   ScaleService              `json:"scaleServiceConfig"`
+	ServiceUpgradeConfig ServiceUpgrade            `json:"serviceUpgradeConfig"`
+	ScaleHostConfig      ScaleHost                 `json:"scaleHostConfig"`
+	UseToken             bool                      `json:"useToken,omitempty"`
+	TokenTTLSeconds      int64                     `json:"tokenTtlSeconds,omitempty"`
+	TokenAudience        string                    `json:"tokenAudience,omitempty"`
+	AllowedCIDRs         []string                  `json:"allowedCIDRs,omitempty"`
+	Condition            string                    `json:"condition,omitempty"`
+	Transform            map[string]string         `json:"transform,omitempty"`
+	Overrides            map[string]OverrideBounds `json:"overrides,omitempty"`
+	TemplateID           string                    `json:"templateId,omitempty"`
+	TemplateVersion      int64                     `json:"templateVersion,omitempty"`
+}
+
+//OverrideBounds limits the values a call's body may set a driver config field to. Numeric fields
+//take Min and Max, string fields take the list of allowed Values.
+type OverrideBounds struct {
+	Min    int64    `json:"min,omitempty"`
+	Max    int64    `json:"max,omitempty"`
+	Values []string `json:"values,omitempty"`
 }
 
 type WebhookCollection struct {
 	v1client.Collection
 	Data []Webhook `json:"data,omitempty"`
 }
+
+//ReceiverImport is the input of the receivers import action: the receivers a project should have.
+//Receivers are matched to existing ones by name. Prune deletes the receivers the document doesn't
+//list, and DryRun only reports the changes an import would make.
+type ReceiverImport struct {
+	Receivers []Webhook `json:"receivers"`
+	Prune     bool      `json:"prune,omitempty"`
+	DryRun    bool      `json:"dryRun,omitempty"`
+}
+
+type ReceiverImportResult struct {
+	v1client.Resource
+	DryRun  bool             `json:"dryRun"`
+	Changes []ReceiverChange `json:"changes"`
+}
+
+//ReceiverChange is what an import or a template propagation did, or would do, to one receiver.
+//Action is create, update, delete or unchanged, and Fields lists the definition fields an update
+//changes. Propagations also report missing instances and failed projects, and skip projects the
+//caller may not create receivers in, with a Message. An import that stops reports its failed change.
+type ReceiverChange struct {
+	Name      string   `json:"name"`
+	Action    string   `json:"action"`
+	ID        string   `json:"receiverId,omitempty"`
+	ProjectID string   `json:"projectId,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Message   string   `json:"message,omitempty"`
+}
+
+//ReceiverTemplate is a receiver definition shared by projects. Strings of the definition may hold
+//placeholders, such as ${service:stack/name}, that are resolved in each project it's instantiated in.
+type ReceiverTemplate struct {
+	v1client.Resource
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Definition  map[string]interface{} `json:"definition"`
+	Version     int64                  `json:"version"`
+	Projects    []string               `json:"projects,omitempty"`
+	Created     string                 `json:"created,omitempty"`
+}
+
+type ReceiverTemplateCollection struct {
+	v1client.Collection
+	Data []ReceiverTemplate `json:"data,omitempty"`
+}
+
+//InstantiateInput picks the project a receiver template is instantiated in, and the values of its
+//${var:name} placeholders
+type InstantiateInput struct {
+	ProjectID string            `json:"projectId"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+//PropagateInput is the input of a template's propagate action, which brings its instances up to date
+type PropagateInput struct {
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type TemplatePropagation struct {
+	v1client.Resource
+	Version int64            `json:"version"`
+	DryRun  bool             `json:"dryRun"`
+	Changes []ReceiverChange `json:"changes"`
+}
+
+type IssueTokenInput struct {
+	TTLSeconds       int64  `json:"ttlSeconds,omitempty"`
+	NotBeforeSeconds int64  `json:"notBeforeSeconds,omitempty"`
+	Audience         string `json:"audience,omitempty"`
+}
+
+type IssuedToken struct {
+	v1client.Resource
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	Expires   string `json:"expires"`
+	NotBefore string `json:"notBefore"`
+}
+
+type Execution struct {
+	v1client.Resource
+	Time     string          `json:"time"`
+	SourceIP string          `json:"sourceIp"`
+	Code     int             `json:"code"`
+	Message  string          `json:"message,omitempty"`
+	Hosts    []HostProgress  `json:"hosts,omitempty"`
+	Services []ServiceResult `json:"services,omitempty"`
+}
+
+//ServiceResult is the outcome for one service of an execution scaling several services together.
+//State is scaled, failed, skipped, rolledBack or rollbackFailed.
+type ServiceResult struct {
+	ServiceID     string `json:"serviceId"`
+	Name          string `json:"name,omitempty"`
+	PreviousScale int64  `json:"previousScale"`
+	Scale         int64  `json:"scale"`
+	State         string `json:"state"`
+	Message       string `json:"message,omitempty"`
+}
+
+//HostProgress is the state of a host a driver works on during an execution, such as a host being
+//drained before it is deleted
+type HostProgress struct {
+	HostID   string `json:"hostId"`
+	Hostname string `json:"hostname,omitempty"`
+	State    string `json:"state"`
+	Message  string `json:"message,omitempty"`
+}
+
+type ExecutionCollection struct {
+	v1client.Collection
+	Data []Execution `json:"data,omitempty"`
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/webhook-service/config"
+)
+
+const defaultAuthCacheTTL = 30 * time.Second
+
+//Operations a management API caller can be authorized for
+const (
+	OpRead   = "read"
+	OpCreate = "create"
+	OpDelete = "delete"
+)
+
+//Authorizer decides whether the caller of a management API request may perform op on the
+//receivers of a project. It returns the response code to fail the request with.
+type Authorizer interface {
+	Authorize(r *http.Request, projectID string, op string) (int, error)
+}
+
+//CattleAuthorizer checks the caller's own Rancher API key or token against Cattle. Receivers are
+//GenericObjects, so the caller may perform op on receivers when Cattle lets them perform it on
+//the project's GenericObjects: reading the project-scoped genericobject schema with the caller's
+//credentials proves membership, and the schema's methods reflect the caller's role.
+type CattleAuthorizer struct {
+	TTL time.Duration
+	//Clients provides the connection pool and timeout of the permission checks, so they're made like
+	//the service's other requests to Cattle
+	Clients *ClientFactory
+
+	mu    sync.Mutex
+	cache map[string]*cachedPermissions
+}
+
+type cachedPermissions struct {
+	code      int
+	err       error
+	methods   map[string]bool
+	expiresAt time.Time
+}
+
+type genericObjectSchema struct {
+	CollectionMethods []string `json:"collectionMethods"`
+	ResourceMethods   []string `json:"resourceMethods"`
+}
+
+//authorized wraps a management API handler so it only runs once the caller is authorized for op
+func (rh *RouteHandler) authorized(op string, handler func(http.ResponseWriter, *http.Request) (int, error)) func(http.ResponseWriter, *http.Request) (int, error) {
+	return func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if rh.Authorizer != nil {
+			projectID, errCode, err := getProjectID(r)
+			if err != nil {
+				return errCode, err
+			}
+			if code, err := rh.Authorizer.Authorize(r, projectID, op); err != nil {
+				return code, err
+			}
+		}
+		return handler(w, r)
+	}
+}
+
+func (a *CattleAuthorizer) Authorize(r *http.Request, projectID string, op string) (int, error) {
+	credentials, apply := callerCredentials(r)
+	if credentials == "" {
+		return 401, fmt.Errorf("Rancher API key or token required")
+	}
+
+	permissions := a.permissions(credentials, apply, projectID)
+	if permissions.err != nil {
+		return permissions.code, permissions.err
+	}
+
+	var allowed bool
+	switch op {
+	case OpRead:
+		allowed = permissions.methods["collection:GET"]
+	case OpCreate:
+		allowed = permissions.methods["collection:POST"]
+	case OpDelete:
+		allowed = permissions.methods["resource:DELETE"]
+	}
+	if !allowed {
+		return 403, fmt.Errorf("Not allowed to %s webhooks in project %s", op, projectID)
+	}
+	return 0, nil
+}
+
+//permissions returns the caller's methods on the project's GenericObjects, cached for TTL by a hash
+//of the credentials so they aren't kept in memory in the clear
+func (a *CattleAuthorizer) permissions(credentials string, apply func(*http.Request), projectID string) *cachedPermissions {
+	sum := sha256.Sum256([]byte(credentials))
+	key := hex.EncodeToString(sum[:]) + "/" + projectID
+
+	a.mu.Lock()
+	if a.cache == nil {
+		a.cache = map[string]*cachedPermissions{}
+	}
+	if cached, ok := a.cache[key]; ok && time.Now().Before(cached.expiresAt) {
+		a.mu.Unlock()
+		return cached
+	}
+	a.mu.Unlock()
+
+	permissions := a.fetchPermissions(apply, projectID)
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = defaultAuthCacheTTL
+	}
+	permissions.expiresAt = time.Now().Add(ttl)
+
+	// Don't cache failures to reach Cattle
+	if permissions.code < 500 {
+		a.mu.Lock()
+		for k, cached := range a.cache {
+			if time.Now().After(cached.expiresAt) {
+				delete(a.cache, k)
+			}
+		}
+		a.cache[key] = permissions
+		a.mu.Unlock()
+	}
+	return permissions
+}
+
+func (a *CattleAuthorizer) fetchPermissions(apply func(*http.Request), projectID string) *cachedPermissions {
+	url := fmt.Sprintf("%s/projects/%s/schemas/genericobject", config.GetConfig().CattleURL, projectID)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return &cachedPermissions{code: 500, err: fmt.Errorf("Error creating request to Cattle: %v", err)}
+	}
+	apply(request)
+
+	clients := a.Clients
+	if clients == nil {
+		clients = &ClientFactory{}
+	}
+	resp, err := clients.httpClient(clientTimeout).Do(request)
+	if err != nil {
+		return &cachedPermissions{code: 503, err: fmt.Errorf("Error reaching Cattle to authorize request: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return &cachedPermissions{code: 401, err: fmt.Errorf("Invalid Rancher API key or token")}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound:
+		return &cachedPermissions{code: 403, err: fmt.Errorf("Not a member of project %s", projectID)}
+	case resp.StatusCode != http.StatusOK:
+		logrus.Errorf("Cattle responded with %s authorizing request for project %s", resp.Status, projectID)
+		return &cachedPermissions{code: 503, err: fmt.Errorf("Unable to authorize request")}
+	}
+
+	schema := &genericObjectSchema{}
+	if err := json.NewDecoder(resp.Body).Decode(schema); err != nil {
+		return &cachedPermissions{code: 503, err: fmt.Errorf("Unable to authorize request: %v", err)}
+	}
+	methods := map[string]bool{}
+	for _, method := range schema.CollectionMethods {
+		methods["collection:"+method] = true
+	}
+	for _, method := range schema.ResourceMethods {
+		methods["resource:"+method] = true
+	}
+	return &cachedPermissions{methods: methods}
+}
+
+//callerCredentials finds the Rancher API key or token the caller authenticated with, and returns a
+//function that sets the same credentials on a request to Cattle
+func callerCredentials(r *http.Request) (string, func(*http.Request)) {
+	if accessKey, secretKey, ok := r.BasicAuth(); ok && accessKey != "" {
+		return "basic:" + accessKey + ":" + secretKey, func(req *http.Request) {
+			req.SetBasicAuth(accessKey, secretKey)
+		}
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		if token != "" {
+			return "bearer:" + token, func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+	}
+
+	if cookie, err := r.Cookie("token"); err == nil && cookie.Value != "" {
+		token := cookie.Value
+		return "cookie:" + token, func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func fakeCattleAuth(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+		accessKey, secretKey, _ := req.BasicAuth()
+		if cookie, err := req.Cookie("token"); err == nil {
+			accessKey, secretKey = "owner", cookie.Value
+		}
+		if secretKey != "secret" {
+			w.WriteHeader(401)
+			return
+		}
+		if req.URL.Path != "/v2-beta/projects/1a1/schemas/genericobject" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch accessKey {
+		case "owner":
+			w.Write([]byte(`{"collectionMethods": ["GET", "POST"], "resourceMethods": ["GET", "PUT", "DELETE"]}`))
+		case "readonly":
+			w.Write([]byte(`{"collectionMethods": ["GET"], "resourceMethods": ["GET"]}`))
+		default:
+			w.WriteHeader(403)
+		}
+	}))
+}
+
+func TestCattleAuthorizer(t *testing.T) {
+	var requests int32
+	cattle := fakeCattleAuth(t, &requests)
+	defer cattle.Close()
+	os.Setenv("CATTLE_URL", cattle.URL+"/v2-beta")
+	defer os.Unsetenv("CATTLE_URL")
+
+	authorizer := &CattleAuthorizer{}
+	tests := []struct {
+		name      string
+		projectID string
+		op        string
+		auth      func(*http.Request)
+		code      int
+	}{
+		{"no credentials", "1a1", OpRead, func(*http.Request) {}, 401},
+		{"bad secret", "1a1", OpRead, func(r *http.Request) { r.SetBasicAuth("owner", "wrong") }, 401},
+		{"owner reads", "1a1", OpRead, func(r *http.Request) { r.SetBasicAuth("owner", "secret") }, 0},
+		{"owner creates", "1a1", OpCreate, func(r *http.Request) { r.SetBasicAuth("owner", "secret") }, 0},
+		{"owner deletes", "1a1", OpDelete, func(r *http.Request) { r.SetBasicAuth("owner", "secret") }, 0},
+		{"readonly reads", "1a1", OpRead, func(r *http.Request) { r.SetBasicAuth("readonly", "secret") }, 0},
+		{"readonly creates", "1a1", OpCreate, func(r *http.Request) { r.SetBasicAuth("readonly", "secret") }, 403},
+		{"readonly deletes", "1a1", OpDelete, func(r *http.Request) { r.SetBasicAuth("readonly", "secret") }, 403},
+		{"outsider", "1a1", OpRead, func(r *http.Request) { r.SetBasicAuth("outsider", "secret") }, 403},
+		{"other project", "1a2", OpRead, func(r *http.Request) { r.SetBasicAuth("owner", "secret") }, 403},
+		{"token cookie", "1a1", OpCreate, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: "secret"}) }, 0},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest("GET", "http://localhost/v1-webhooks/receivers?projectId="+test.projectID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.auth(request)
+		if code, err := authorizer.Authorize(request, test.projectID, test.op); code != test.code {
+			t.Errorf("%s: expected code %d, got %d (%v)", test.name, test.code, code, err)
+		}
+	}
+
+	// Checks without credentials don't reach Cattle and each caller is fetched once per project
+	if count := atomic.LoadInt32(&requests); count != 6 {
+		t.Fatalf("Expected permissions to be cached per caller and project, got %d requests", count)
+	}
+}
+
+func TestManagementAPIRequiresAuth(t *testing.T) {
+	var requests int32
+	cattle := fakeCattleAuth(t, &requests)
+	defer cattle.Close()
+	os.Setenv("CATTLE_URL", cattle.URL+"/v2-beta")
+	defer os.Unsetenv("CATTLE_URL")
+
+	rh := &RouteHandler{
+		ClientFactory: r.ClientFactory,
+		Store:         r.Store,
+		Keys:          r.Keys,
+		Authorizer:    &CattleAuthorizer{},
+	}
+	authRouter := NewRouter(rh)
+
+	send := func(method string, body string, accessKey string) int {
+		url := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+		request, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if accessKey != "" {
+			request.SetBasicAuth(accessKey, "secret")
+		}
+		response := httptest.NewRecorder()
+		authRouter.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	if code := send("GET", "", ""); code != 401 {
+		t.Fatalf("StatusCode %d, list without credentials must be rejected", code)
+	}
+	if code := send("GET", "", "readonly"); code != 200 {
+		t.Fatalf("StatusCode %d, readonly member must be able to list", code)
+	}
+	body := `{"driver":"scaleService","name":"wh-authz",
+		"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`
+	if code := send("POST", body, "readonly"); code != 403 {
+		t.Fatalf("StatusCode %d, readonly member must not create webhooks", code)
+	}
+}
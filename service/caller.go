@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/webhook-service/store"
+)
+
+//ParseCIDRs parses a list of CIDRs. A bare address is taken as a network of just that address.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid CIDR %v", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR %v", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//callerIP returns the address a receiver URL was called from. X-Forwarded-For is only believed when
+//the direct peer is one of TrustedProxies, and is then read right to left skipping trusted proxies,
+//so a client can't choose its own address by sending the header.
+func (rh *RouteHandler) callerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(rh.TrustedProxies, ip) {
+		return ip
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header[http.CanonicalHeaderKey("X-Forwarded-For")] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(rh.TrustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+//checkCaller rejects calls from addresses outside the receiver's allowedCIDRs
+func (rh *RouteHandler) checkCaller(receiver *store.Receiver, caller net.IP) (int, error) {
+	if len(receiver.AllowedCIDRs) == 0 {
+		return 0, nil
+	}
+	allowed, err := ParseCIDRs(receiver.AllowedCIDRs)
+	if err != nil {
+		return 500, err
+	}
+	if caller != nil && containsIP(allowed, caller) {
+		return 0, nil
+	}
+
+	err = fmt.Errorf("Calls from %v are not allowed for this webhook", caller)
+	logrus.Warnf("Rejected call to webhook %s in project %s from %v: not in allowedCIDRs", receiver.ID,
+		receiver.ProjectID, caller)
+	rh.recordExecution(receiver, caller, 403, err.Error())
+	return 403, err
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+)
+
+func TestCallerIP(t *testing.T) {
+	proxies, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := &RouteHandler{TrustedProxies: proxies}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"203.0.113.5:4000", nil, "203.0.113.5"},
+		{"203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"1.1.1.1, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"192.168.1.1:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"192.168.1.2:4000", []string{"198.51.100.1"}, "192.168.1.2"},
+		{"10.0.0.2:4000", []string{"garbage, 10.0.0.3"}, "10.0.0.3"},
+		{"[2001:db8::1]:4000", nil, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest("POST", "http://localhost/v1-webhooks/endpoint", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.RemoteAddr = test.remoteAddr
+		for _, header := range test.forwarded {
+			request.Header.Add("X-Forwarded-For", header)
+		}
+		if ip := rh.callerIP(request); ip.String() != test.expected {
+			t.Errorf("callerIP(%v, %v) = %v, expected %v", test.remoteAddr, test.forwarded, ip, test.expected)
+		}
+	}
+
+	if _, err := ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("Expected invalid CIDR to be rejected")
+	}
+}
+
+func TestAllowedCIDRs(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	create := func(cidrs string) *httptest.ResponseRecorder {
+		jsonStr := []byte(`{"driver":"scaleService","name":"wh-cidrs","allowedCIDRs":` + cidrs + `,
+			"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+		request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := create(`["not-a-cidr"]`); response.Code != 400 {
+		t.Fatalf("StatusCode %d, invalid allowedCIDRs must be rejected", response.Code)
+	}
+
+	response := create(`["10.0.0.0/8", "2001:db8::/32"]`)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d creating webhook with allowedCIDRs: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+	if len(wh.AllowedCIDRs) != 2 || wh.Links["history"] == "" {
+		t.Fatalf("Unexpected webhook: %#v", wh)
+	}
+
+	execute := func(remoteAddr string) int {
+		request, err := http.NewRequest("POST", wh.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.RemoteAddr = remoteAddr
+		request.Header.Set("X-Forwarded-For", "10.0.0.1")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response.Code
+	}
+	if code := execute("203.0.113.5:4000"); code != 403 {
+		t.Fatalf("StatusCode %d, call from outside allowedCIDRs must be rejected", code)
+	}
+	if code := execute("10.1.2.3:4000"); code != 200 {
+		t.Fatalf("StatusCode %d, call from allowedCIDRs must be executed", code)
+	}
+
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/v1-webhooks/receivers/%s/history?projectId=1a1", server.URL, wh.Id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d getting history", response.Code)
+	}
+	history := &model.ExecutionCollection{}
+	if err := json.Unmarshal(response.Body.Bytes(), history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Data) < 2 || history.Data[0].Code != 200 || history.Data[0].SourceIP != "10.1.2.3" ||
+		history.Data[1].Code != 403 || history.Data[1].SourceIP != "203.0.113.5" {
+		t.Fatalf("Unexpected history: %#v", history.Data)
+	}
+
+	request, err = http.NewRequest("DELETE", fmt.Sprintf("%s/v1-webhooks/receivers/%s?projectId=1a1", server.URL, wh.Id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 204 {
+		t.Fatalf("StatusCode %d deleting webhook", response.Code)
+	}
+	r.history.mu.Lock()
+	_, kept := r.history.records[historyKey("1a1", wh.Id)]
+	r.history.mu.Unlock()
+	if kept {
+		t.Fatal("Expected the history of a deleted receiver to be dropped")
+	}
+}
@@ -2,29 +2,186 @@ package service
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/v2"
 	"github.com/rancher/webhook-service/config"
 )
 
+const defaultClientTTL = 5 * time.Minute
+
+//clientTimeout bounds the requests the service makes to Cattle
+const clientTimeout = 30 * time.Second
+
+//pingTimeout bounds readiness pings, which must answer well within a probe's timeout
+const pingTimeout = 5 * time.Second
+
 type RancherClientFactory interface {
 	GetClient(projectID string) (*client.RancherClient, error)
+	Invalidate(projectID string)
+	Ping() error
 }
 
-type ClientFactory struct{}
+//ClientFactory hands out per-project Rancher clients. Building a client downloads the project's
+//schemas from Cattle, so clients are cached for TTL and concurrent requests for the same project
+//share a single build.
+type ClientFactory struct {
+	TTL time.Duration
+	//Transport carries the factory's own requests to Cattle, such as pings and permission checks,
+	//http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	clients  map[string]*cachedClient
+	inflight map[string]*clientCall
+}
+
+type cachedClient struct {
+	client    *client.RancherClient
+	expiresAt time.Time
+}
+
+type clientCall struct {
+	done   chan struct{}
+	client *client.RancherClient
+	err    error
+}
+
+//sharedTransport pools the connections of the requests to Cattle made outside the Rancher clients.
+//go-rancher builds an http.Client per request and gives no way to set its transport, so the Rancher
+//clients go through http.DefaultTransport, which keeps their connections alive too.
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   50,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+func NewClientFactory(ttl time.Duration) *ClientFactory {
+	return &ClientFactory{TTL: ttl, Transport: sharedTransport}
+}
 
 func (f *ClientFactory) GetClient(projectID string) (*client.RancherClient, error) {
+	f.mu.Lock()
+	if f.clients == nil {
+		f.clients = map[string]*cachedClient{}
+		f.inflight = map[string]*clientCall{}
+	}
+
+	if cached, ok := f.clients[projectID]; ok && time.Now().Before(cached.expiresAt) {
+		f.mu.Unlock()
+		return cached.client, nil
+	}
+
+	if call, ok := f.inflight[projectID]; ok {
+		f.mu.Unlock()
+		<-call.done
+		return call.client, call.err
+	}
+
+	call := &clientCall{done: make(chan struct{})}
+	f.inflight[projectID] = call
+	f.mu.Unlock()
+
+	call.client, call.err = f.newRancherClient(projectID)
+
+	f.mu.Lock()
+	delete(f.inflight, projectID)
+	if call.err == nil {
+		f.clients[projectID] = &cachedClient{
+			client:    call.client,
+			expiresAt: time.Now().Add(f.ttl()),
+		}
+	}
+	f.mu.Unlock()
+	close(call.done)
+
+	return call.client, call.err
+}
+
+//Invalidate drops the cached client for a project so the next request builds a fresh one
+func (f *ClientFactory) Invalidate(projectID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clients, projectID)
+}
+
+func (f *ClientFactory) ttl() time.Duration {
+	if f.TTL <= 0 {
+		return defaultClientTTL
+	}
+	return f.TTL
+}
+
+func (f *ClientFactory) newRancherClient(projectID string) (*client.RancherClient, error) {
 	config := config.GetConfig()
 	url := fmt.Sprintf("%s/projects/%s/schemas", config.CattleURL, projectID)
 	apiClient, err := client.NewRancherClient(&client.ClientOpts{
-		Timeout:   time.Second * 30,
+		Timeout:   clientTimeout,
 		Url:       url,
 		AccessKey: config.CattleAccessKey,
 		SecretKey: config.CattleSecretKey,
 	})
 	if err != nil {
+		logrus.Errorf("Error creating API client for project %s: %v", projectID, err)
 		return &client.RancherClient{}, fmt.Errorf("Error in creating API client")
 	}
 	return apiClient, nil
 }
+
+//httpClient makes requests to Cattle through the factory's transport
+func (f *ClientFactory) httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: f.Transport}
+}
+
+//Ping makes an authenticated request to CATTLE_URL to verify that Cattle is reachable
+//and accepts the configured credentials
+func (f *ClientFactory) Ping() error {
+	config := config.GetConfig()
+	request, err := http.NewRequest("GET", config.CattleURL, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating request to Cattle: %v", err)
+	}
+	request.SetBasicAuth(config.CattleAccessKey, config.CattleSecretKey)
+
+	resp, err := f.httpClient(pingTimeout).Do(request)
+	if err != nil {
+		return fmt.Errorf("Error reaching Cattle: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Cattle responded with %s", resp.Status)
+	}
+	return nil
+}
+
+//invalidateOnAuthError drops the cached client for a project when Cattle rejected its credentials
+func (rh *RouteHandler) invalidateOnAuthError(projectID string, err error) {
+	if isAuthError(err) {
+		logrus.Infof("Dropping cached client for project %s after auth error", projectID)
+		rh.ClientFactory.Invalidate(projectID)
+	}
+}
+
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	apiErr, ok := errors.Cause(err).(*client.ApiError)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+}
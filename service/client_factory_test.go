@@ -0,0 +1,93 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientFactoryCachesClients(t *testing.T) {
+	var schemaRequests int32
+	cattle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&schemaRequests, 1)
+		// Slow enough that concurrent callers overlap with the first build
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("X-API-Schemas", "http://"+req.Host+req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "collection", "data": []}`))
+	}))
+	defer cattle.Close()
+
+	os.Setenv("CATTLE_URL", cattle.URL+"/v2-beta")
+	defer os.Unsetenv("CATTLE_URL")
+
+	factory := &ClientFactory{TTL: time.Minute}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := factory.GetClient("1a1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := atomic.LoadInt32(&schemaRequests); count != 1 {
+		t.Fatalf("Expected concurrent requests to share one client build, got %d", count)
+	}
+
+	if _, err := factory.GetClient("1a2"); err != nil {
+		t.Fatal(err)
+	}
+	if count := atomic.LoadInt32(&schemaRequests); count != 2 {
+		t.Fatalf("Expected a separate client per project, got %d schema requests", count)
+	}
+
+	factory.Invalidate("1a1")
+	if _, err := factory.GetClient("1a1"); err != nil {
+		t.Fatal(err)
+	}
+	if count := atomic.LoadInt32(&schemaRequests); count != 3 {
+		t.Fatalf("Expected invalidated client to be rebuilt, got %d schema requests", count)
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientFactoryTransport(t *testing.T) {
+	cattle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-API-Schemas", "http://"+req.Host+req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "collection", "data": []}`))
+	}))
+	defer cattle.Close()
+
+	os.Setenv("CATTLE_URL", cattle.URL+"/v2-beta")
+	defer os.Unsetenv("CATTLE_URL")
+
+	defaultTransport := http.DefaultTransport
+	if NewClientFactory(time.Minute); http.DefaultTransport != defaultTransport {
+		t.Fatal("The client factory must not replace http.DefaultTransport")
+	}
+
+	transport := &countingTransport{}
+	factory := &ClientFactory{TTL: time.Minute, Transport: transport}
+	if err := factory.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&transport.requests) != 1 {
+		t.Fatal("Expected the ping to use the factory's transport")
+	}
+}
@@ -12,9 +12,9 @@ import (
 	"github.com/dchest/uniuri"
 	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/api"
-	"github.com/rancher/go-rancher/v2"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
 )
 
 func (rh *RouteHandler) ConstructPayload(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -41,22 +41,9 @@ func (rh *RouteHandler) ConstructPayload(w http.ResponseWriter, r *http.Request)
 		return 400, errors.Wrap(err, "Bad request body")
 	}
 
-	if wh.Name == "" {
-		return 400, fmt.Errorf("Name not provided")
-	}
-
-	if wh.Driver == "" {
-		return 400, fmt.Errorf("Driver not provided")
-	}
-
-	driver := drivers.GetDriver(wh.Driver)
-	if driver == nil {
-		return 400, fmt.Errorf("Invalid driver %v", wh.Driver)
-	}
-
-	driverConfig := getDriverConfig(wh)
-	if driverConfig == nil {
-		return 400, fmt.Errorf("Invalid driver %v", wh.Driver)
+	driver, driverConfig, err := checkReceiverDefinition(wh)
+	if err != nil {
+		return 400, err
 	}
 
 	apiClient, err := rh.ClientFactory.GetClient(projectID)
@@ -64,54 +51,109 @@ func (rh *RouteHandler) ConstructPayload(w http.ResponseWriter, r *http.Request)
 		return 500, err
 	}
 
-	code, err := rh.isUniqueName(wh.Name, projectID, apiClient)
+	code, err := rh.isUniqueName(wh.Name, projectID)
 	if err != nil {
 		return code, err
 	}
 
 	code, err = driver.ValidatePayload(driverConfig, apiClient)
 	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
 		return code, err
 	}
 
-	uuid := uniuri.NewLen(40)
-
-	url := apiContext.UrlBuilder.Version("v1-webhooks")
-	url = url + "/endpoint?key=" + uuid + "&projectId=" + projectID
-
-	//saveWebhook needs only user fields
-	webhook, err := saveWebhook(uuid, wh.Name, wh.Driver, url, driverConfig, apiClient)
+	receiver, code, err := rh.createReceiver(apiContext, wh, projectID, driverConfig, nil)
 	if err != nil {
-		return 500, err
+		return code, err
 	}
 
 	//needs only user fields
-	whResponse, err := newWebhook(apiContext, url, webhook.Id, wh.Driver, wh.Name, driverConfig, driver,
-		webhook.State, r)
+	whResponse, err := newWebhook(apiContext, receiver.URL, receiver.ID, wh.Driver, wh.Name, driverConfig, driver,
+		receiver.State, r)
 	if err != nil {
 		return 500, errors.Wrap(err, "Unable to create webhook response")
 	}
+	setReceiverOptions(whResponse, receiver)
+	rh.resolveTarget(whResponse, driver, driverConfig, apiClient, projectID)
 	apiContext.WriteResource(whResponse)
 	return 200, nil
 }
 
-func saveWebhook(uuid string, name string, driver string, url string, config interface{}, apiClient *client.RancherClient) (*client.GenericObject, error) {
-	resourceData := map[string]interface{}{
-		"url":    url,
-		"driver": driver,
-		"config": config,
+//checkReceiverDefinition validates the fields of a receiver definition that don't need Cattle, and
+//returns its driver and driver config
+func checkReceiverDefinition(wh *model.Webhook) (drivers.WebhookDriver, interface{}, error) {
+	if wh.Name == "" {
+		return nil, nil, fmt.Errorf("Name not provided")
+	}
+
+	if wh.Driver == "" {
+		return nil, nil, fmt.Errorf("Driver not provided")
 	}
-	obj, err := apiClient.GenericObject.Create(&client.GenericObject{
-		Name:         name,
-		Key:          uuid,
-		ResourceData: resourceData,
-		Kind:         "webhookReceiver",
-	})
 
+	driver := drivers.GetDriver(wh.Driver)
+	if driver == nil {
+		return nil, nil, fmt.Errorf("Invalid driver %v", wh.Driver)
+	}
+
+	if _, err := ParseCIDRs(wh.AllowedCIDRs); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateReceiverRules(wh.Condition, wh.Transform); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateOverrides(driver, wh.Overrides); err != nil {
+		return nil, nil, err
+	}
+
+	driverConfig := getDriverConfig(wh)
+	if driverConfig == nil {
+		return nil, nil, fmt.Errorf("Invalid driver %v", wh.Driver)
+	}
+	return driver, driverConfig, nil
+}
+
+//createReceiver gives a validated receiver a new key and URL and stores it. origin is the receiver
+//template it's an instance of, if any.
+func (rh *RouteHandler) createReceiver(apiContext *api.ApiContext, wh *model.Webhook, projectID string,
+	driverConfig interface{}, origin *templateOrigin) (*store.Receiver, int, error) {
+	uuid := uniuri.NewLen(40)
+
+	url := apiContext.UrlBuilder.Version("v1-webhooks")
+	url = url + "/endpoint?key=" + uuid + "&projectId=" + projectID
+	if wh.UseToken {
+		//the receiver is still stored so deleting it revokes the token
+		token, err := rh.newReceiverToken(wh, projectID, uuid, driverConfig)
+		if err != nil {
+			return nil, 400, err
+		}
+		url = tokenURL(apiContext, token)
+	}
+
+	receiver := &store.Receiver{
+		ProjectID:    projectID,
+		Name:         wh.Name,
+		Key:          uuid,
+		Driver:       wh.Driver,
+		URL:          url,
+		Config:       driverConfig,
+		AllowedCIDRs: wh.AllowedCIDRs,
+		Condition:    wh.Condition,
+		Transform:    wh.Transform,
+		Overrides:    wh.Overrides,
+	}
+	if origin != nil {
+		receiver.TemplateID = origin.template.ID
+		receiver.TemplateVersion = origin.template.Version
+		receiver.TemplateVariables = origin.variables
+	}
+	receiver, err := rh.Store.Create(receiver)
 	if err != nil {
-		return &client.GenericObject{}, fmt.Errorf("Failed to create webhook: %v", err)
+		rh.invalidateOnAuthError(projectID, err)
+		return nil, storeErrorCode(err), err
 	}
-	return obj, nil
+	return receiver, 0, nil
 }
 
 func getDriverConfig(wh *model.Webhook) interface{} {
@@ -1,73 +1,56 @@
 package service
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/rancher/go-rancher/v2"
 	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
 )
 
 func (rh *RouteHandler) Execute(w http.ResponseWriter, r *http.Request) (int, error) {
-	var requestBody interface{}
-
-	if r.Body != nil {
-		bytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return 500, fmt.Errorf("Error reading request body in Execute handler: %v", err)
-		}
-
-		if len(bytes) > 0 {
-			err = json.Unmarshal(bytes, &requestBody)
-			if err != nil {
-				return 500, fmt.Errorf("Error unmarshalling request body in Execute handler: %v", err)
-			}
-		}
+	requestBody, code, err := rh.readPayload(r)
+	if err != nil {
+		return code, err
 	}
 
-	jwtSigned := r.FormValue("token")
+	//the body was read already, so take the url parameters from the query only
+	query := r.URL.Query()
+	caller := rh.callerIP(r)
+	jwtSigned := query.Get("token")
 	if jwtSigned != "" {
-		code, err := rh.ExecuteWithJwt(jwtSigned, requestBody)
-		if err != nil {
-			return code, err
-		}
-		return 200, nil
+		return rh.ExecuteWithJwt(jwtSigned, caller, requestBody)
 	}
 
-	uuid := r.FormValue("key")
+	uuid := query.Get("key")
 	if uuid == "" {
 		return 400, fmt.Errorf("Invalid execute url, should have 'token' or 'key'")
 	}
 
-	projectID := r.FormValue("projectId")
+	projectID := query.Get("projectId")
 	if projectID == "" {
 		return 400, fmt.Errorf("Invalid execute url, url must contain projectId")
 	}
 
-	code, err := rh.ExecuteWithKey(uuid, projectID, requestBody)
-	if err != nil {
-		return code, err
-	}
-
-	return 200, nil
+	return rh.ExecuteWithKey(uuid, projectID, caller, requestBody)
 }
 
-func (rh *RouteHandler) ExecuteWithJwt(jwtSigned string, requestBody interface{}) (int, error) {
-	token, err := jwt.Parse(jwtSigned, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return rh.PublicKey, nil
-	})
+func (rh *RouteHandler) ExecuteWithJwt(jwtSigned string, caller net.IP, requestBody interface{}) (int, error) {
+	token, err := rh.Keys.Parse(jwtSigned)
 
 	if err != nil || !token.Valid {
 		return 400, fmt.Errorf("Invalid token error: %v", err)
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if code, err := rh.verifyAudience(claims); err != nil {
+			return code, err
+		}
+
 		driverID, ok := claims["driver"].(string)
 		if !ok {
 			return 400, fmt.Errorf("Driver not found after decode")
@@ -93,73 +76,121 @@ func (rh *RouteHandler) ExecuteWithJwt(jwtSigned string, requestBody interface{}
 			return 500, err
 		}
 
-		code, err := validateWebhook(uuid, apiClient)
+		receiver, code, err := rh.validateWebhook(uuid, projectID)
 		if err != nil {
+			rh.invalidateOnAuthError(projectID, err)
 			return code, err
 		}
 
-		responseCode, err := driver.Execute(claims["config"], apiClient, requestBody)
-		if err != nil {
-			return responseCode, fmt.Errorf("Error %v in executing driver for %s", err, driverID)
+		if code, err := rh.checkCaller(receiver, caller); err != nil {
+			return code, err
 		}
+
+		return rh.executeReceiver(receiver, driver, claims["config"], apiClient, caller, requestBody)
 	}
 	return 200, nil
 }
 
-func (rh *RouteHandler) ExecuteWithKey(uuid string, projectID string, requestBody interface{}) (int, error) {
-	apiClient, err := rh.ClientFactory.GetClient(projectID)
-	if err != nil {
-		return 500, err
+func (rh *RouteHandler) ExecuteWithKey(uuid string, projectID string, caller net.IP, requestBody interface{}) (int, error) {
+	receiver, err := rh.Store.GetByKey(projectID, uuid)
+	if store.IsNotFound(err) {
+		return 403, fmt.Errorf("Requested webhook has been revoked/does not exist for this account")
 	}
-
-	filters := make(map[string]interface{})
-	filters["key"] = uuid
-	goCollection, err := apiClient.GenericObject.List(&client.ListOpts{
-		Filters: filters,
-	})
 	if err != nil {
-		return 500, fmt.Errorf("Error %v filtering genericObjects by key", err)
+		rh.invalidateOnAuthError(projectID, err)
+		return 500, fmt.Errorf("Error %v looking up webhook by key", err)
 	}
 
-	if len(goCollection.Data) == 0 {
-		return 403, fmt.Errorf("Requested webhook has been revoked/does not exist for this account")
-	}
-
-	resourceData := goCollection.Data[0].ResourceData
-	driverID, ok := resourceData["driver"].(string)
-	if !ok {
-		return 400, fmt.Errorf("No driver provided")
+	if code, err := rh.checkCaller(receiver, caller); err != nil {
+		return code, err
 	}
 
-	driver := drivers.GetDriver(driverID)
+	driver := drivers.GetDriver(receiver.Driver)
 	if driver == nil {
-		return 400, fmt.Errorf("Driver %s is not registered", driverID)
+		return 400, fmt.Errorf("Driver %s is not registered", receiver.Driver)
 	}
 
-	driverConfig, ok := resourceData["config"]
-	if !ok {
+	if receiver.Config == nil {
 		return 400, fmt.Errorf("Driver config not found")
 	}
 
-	responseCode, err := driver.Execute(driverConfig, apiClient, requestBody)
+	apiClient, err := rh.ClientFactory.GetClient(projectID)
 	if err != nil {
-		return responseCode, fmt.Errorf("Error %v in executing driver for %s", err, driverID)
+		return 500, err
 	}
 
-	return 200, nil
+	return rh.executeReceiver(receiver, driver, receiver.Config, apiClient, caller, requestBody)
 }
 
-func validateWebhook(uuid string, apiClient *client.RancherClient) (int, error) {
-	filters := make(map[string]interface{})
-	filters["key"] = uuid
-	webhookCollection, err := apiClient.GenericObject.List(&client.ListOpts{
-		Filters: filters,
+//executeReceiver runs the driver for an authorized call to a receiver's URL, unless the receiver's
+//condition skips it, and records the outcome in the receiver's history
+func (rh *RouteHandler) executeReceiver(receiver *store.Receiver, driver drivers.WebhookDriver, config interface{},
+	apiClient *client.RancherClient, caller net.IP, requestBody interface{}) (int, error) {
+
+	config, skipped, err := applyReceiverRules(receiver, config, requestBody)
+	if err != nil {
+		rh.recordExecution(receiver, caller, 400, err.Error())
+		return 400, err
+	}
+	if skipped {
+		rh.recordExecution(receiver, caller, 202, fmt.Sprintf("Skipped, condition %q not met", receiver.Condition))
+		return 202, nil
+	}
+
+	if len(receiver.Transform) != 0 || len(receiver.Overrides) != 0 {
+		if code, err := validateRewrittenConfig(receiver.Driver, driver, config, apiClient); err != nil {
+			rh.invalidateOnAuthError(receiver.ProjectID, err)
+			rh.recordExecution(receiver, caller, code, err.Error())
+			return code, err
+		}
+	}
+
+	progressDriver, ok := driver.(drivers.ProgressDriver)
+	if !ok {
+		var results []model.ServiceResult
+		var responseCode int
+		if resultDriver, ok := driver.(drivers.ServiceResultDriver); ok {
+			results, responseCode, err = resultDriver.ExecuteWithResults(config, apiClient, requestBody)
+		} else {
+			responseCode, err = driver.Execute(config, apiClient, requestBody)
+		}
+		if err != nil {
+			rh.invalidateOnAuthError(receiver.ProjectID, err)
+			err = fmt.Errorf("Error %v in executing driver for %s", err, receiver.Driver)
+			rh.recordServiceResults(receiver, rh.recordExecution(receiver, caller, responseCode, err.Error()), results)
+			return responseCode, err
+		}
+		rh.recordServiceResults(receiver, rh.recordExecution(receiver, caller, 200, ""), results)
+		return 200, nil
+	}
+
+	//the execution is recorded up front so hosts the driver keeps working on in the background
+	//show up on it, and its outcome is filled in once the driver returns
+	id := rh.recordExecution(receiver, caller, 0, "")
+	responseCode, err := progressDriver.ExecuteWithProgress(config, apiClient, requestBody, func(progress model.HostProgress) {
+		rh.recordHostProgress(receiver, id, progress)
 	})
 	if err != nil {
-		return 500, err
+		rh.invalidateOnAuthError(receiver.ProjectID, err)
+		err = fmt.Errorf("Error %v in executing driver for %s", err, receiver.Driver)
+		rh.history.update(receiver.ProjectID, receiver.ID, id, func(execution *model.Execution) {
+			execution.Code, execution.Message = responseCode, err.Error()
+		})
+		return responseCode, err
+	}
+	rh.history.update(receiver.ProjectID, receiver.ID, id, func(execution *model.Execution) {
+		execution.Code = 200
+	})
+	return 200, nil
+}
+
+func (rh *RouteHandler) validateWebhook(uuid string, projectID string) (*store.Receiver, int, error) {
+	receiver, err := rh.Store.GetByKey(projectID, uuid)
+	if store.IsNotFound(err) {
+		return nil, 403, fmt.Errorf("Requested webhook has been revoked")
 	}
-	if len(webhookCollection.Data) > 0 {
-		return 0, nil
+	if err != nil {
+		return nil, 500, err
 	}
-	return 403, fmt.Errorf("Requested webhook has been revoked")
+	return receiver, 0, nil
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/rancher/rancher-auth-service/util"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
 )
 
 var server *httptest.Server
@@ -70,8 +71,7 @@ func init() {
 	privateKey := util.ParsePrivateKey("../testutils/private.pem")
 	publicKey := util.ParsePublicKey("../testutils/public.pem")
 	r = &RouteHandler{
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
+		Keys: NewKeySet(privateKey, publicKey),
 	}
 
 	mockWebhook := &mockGenericObject{
@@ -80,6 +80,7 @@ func init() {
 	r.ClientFactory = &MockRancherClientFactory{
 		mw: mockWebhook,
 	}
+	r.Store = store.NewGenericObjectStore(r.ClientFactory)
 	router = NewRouter(r)
 	server = httptest.NewServer(router)
 }
@@ -138,9 +139,18 @@ func (e *MockRancherClientFactory) GetClient(projectID string) (*client.RancherC
 	return mockClient, nil
 }
 
+func (e *MockRancherClientFactory) Invalidate(projectID string) {
+}
+
+func (e *MockRancherClientFactory) Ping() error {
+	return nil
+}
+
 type mockGenericObject struct {
 	client.GenericObjectOperations
 	created map[string]*client.GenericObject
+	// ignoreFilters makes List behave like a Cattle that drops unknown filters
+	ignoreFilters bool
 }
 
 func (m *mockGenericObject) Create(webhook *client.GenericObject) (*client.GenericObject, error) {
@@ -154,17 +164,33 @@ func (m *mockGenericObject) Create(webhook *client.GenericObject) (*client.Gener
 func (m *mockGenericObject) List(opts *client.ListOpts) (*client.GenericObjectCollection, error) {
 	webhooks := []client.GenericObject{}
 	for _, wh := range m.created {
+		if !m.ignoreFilters && !matchesFilters(wh, opts.Filters) {
+			continue
+		}
 		webhooks = append(webhooks, *wh)
 	}
 	return &client.GenericObjectCollection{Data: webhooks}, nil
 }
 
 func (m *mockGenericObject) ById(id string) (*client.GenericObject, error) {
-	fmt.Printf("%v %#v\n\n", id, m.created)
 	if wh, ok := m.created[id]; ok {
 		return wh, nil
 	}
-	return nil, fmt.Errorf("Doesn't exist")
+	return nil, nil
+}
+
+func matchesFilters(obj *client.GenericObject, filters map[string]interface{}) bool {
+	fields := map[string]string{
+		"kind": obj.Kind,
+		"name": obj.Name,
+		"key":  obj.Key,
+	}
+	for k, v := range filters {
+		if field, ok := fields[k]; ok && field != v {
+			return false
+		}
+	}
+	return true
 }
 
 func (m *mockGenericObject) Delete(container *client.GenericObject) error {
@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -12,53 +13,58 @@ import (
 	"github.com/rancher/go-rancher/v2"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
 )
 
 func (rh *RouteHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) (int, error) {
 	logrus.Infof("Listing webhooks")
+	if r.URL.Query().Get("export") != "" {
+		return rh.ExportWebhooks(w, r)
+	}
 	apiContext := api.GetApiContext(r)
 	projectID, errCode, err := getProjectID(r)
 	if err != nil {
 		return errCode, err
 	}
-	apiClient, err := rh.ClientFactory.GetClient(projectID)
+	opts, err := getListOptions(r)
+	if err != nil {
+		return 400, err
+	}
+	page, err := rh.Store.List(projectID, opts)
 	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
 		return 500, err
 	}
-	filters := make(map[string]interface{})
-	filters["kind"] = "webhookReceiver"
-	objs, err := apiClient.GenericObject.List(&client.ListOpts{
-		Filters: filters,
-	})
 	response := []model.Webhook{}
-	for _, obj := range objs.Data {
-		webhook, err := rh.convertToWebhookGenericObject(obj)
-		if err != nil {
-			logrus.Warnf("Skipping webhook %s because: %v", obj.Id, err)
-			continue
-		}
-
-		driver := drivers.GetDriver(webhook.Driver)
-		if driver == nil {
-			logrus.Warnf("Skipping webhook %s because driver cannot be located", webhook.ID)
-			continue
-		}
-		respWebhook, err := newWebhook(apiContext, webhook.URL, webhook.ID, webhook.Driver, webhook.Name,
-			webhook.Config, driver, webhook.State, r)
-		if err != nil {
-			logrus.Warnf("Skipping webhook %s an error ocurred while producing response: %v", webhook.ID, err)
-			continue
-		}
+	for _, receiver := range page.Receivers {
+		response = append(response, *newWebhookFromReceiver(apiContext, receiver, r))
+	}
 
-		response = append(response, *respWebhook)
+	query := r.URL.Query()
+	collectionURL := apiContext.UrlBuilder.Current() + "?" + query.Encode()
+	collection := v1client.Collection{
+		ResourceType: "receiver",
+		Links:        map[string]string{"self": collectionURL},
+		Sort: &v1client.Sort{
+			Name:  opts.Sort,
+			Order: opts.Order,
+		},
+		Pagination: &v1client.Pagination{
+			Marker:  opts.Marker,
+			Partial: page.NextMarker != "",
+		},
+	}
+	limit, total := int64(opts.Limit), int64(page.Total)
+	collection.Pagination.Limit = &limit
+	collection.Pagination.Total = &total
+	if page.NextMarker != "" {
+		query.Set("marker", page.NextMarker)
+		collection.Pagination.Next = apiContext.UrlBuilder.Current() + "?" + query.Encode()
 	}
 
-	collectionURL := apiContext.UrlBuilder.Current() + "?projectId=" + projectID
 	apiContext.Write(&model.WebhookCollection{
-		Collection: v1client.Collection{
-			ResourceType: "receiver",
-			Links:        map[string]string{"self": collectionURL}},
-		Data: response})
+		Collection: collection,
+		Data:       response})
 	return 200, nil
 }
 
@@ -72,33 +78,29 @@ func (rh *RouteHandler) GetWebhook(w http.ResponseWriter, r *http.Request) (int,
 	if err != nil {
 		return errCode, err
 	}
-	apiClient, err := rh.ClientFactory.GetClient(projectID)
-	if err != nil {
-		return 500, err
-	}
-	obj, err := apiClient.GenericObject.ById(webhookID)
+	receiver, err := rh.Store.Get(projectID, webhookID)
 	if err != nil {
-		return 500, err
+		rh.invalidateOnAuthError(projectID, err)
+		return storeErrorCode(err), err
 	}
 
-	if obj == nil {
-		return 404, fmt.Errorf("Webhook not found")
+	driver := drivers.GetDriver(receiver.Driver)
+	if driver == nil {
+		return 400, fmt.Errorf("Can't find driver %v", receiver.Driver)
 	}
 
-	webhook, err := rh.convertToWebhookGenericObject(*obj)
+	respWebhook, err := newWebhook(apiContext, receiver.URL, receiver.ID, receiver.Driver, receiver.Name,
+		receiver.Config, driver, receiver.State, r)
 	if err != nil {
-		return 500, err
-	}
-
-	driver := drivers.GetDriver(webhook.Driver)
-	if driver == nil {
-		return 400, fmt.Errorf("Can't find driver %v", webhook.Driver)
+		return 500, errors.Wrap(err, "Unable to create webhook response")
 	}
+	setReceiverOptions(respWebhook, receiver)
 
-	respWebhook, err := newWebhook(apiContext, webhook.URL, webhook.ID, webhook.Driver, webhook.Name,
-		webhook.Config, driver, webhook.State, r)
+	apiClient, err := rh.ClientFactory.GetClient(projectID)
 	if err != nil {
-		return 500, errors.Wrap(err, "Unable to create webhook response")
+		respWebhook.Warnings = append(respWebhook.Warnings, fmt.Sprintf("Unable to resolve the target: %v", err))
+	} else {
+		rh.resolveTarget(respWebhook, driver, receiver.Config, apiClient, projectID)
 	}
 
 	apiContext.WriteResource(respWebhook)
@@ -114,25 +116,34 @@ func (rh *RouteHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) (i
 		return errCode, err
 	}
 
-	apiClient, err := rh.ClientFactory.GetClient(projectID)
+	err = rh.Store.Delete(projectID, webhookID)
 	if err != nil {
-		return 500, err
-	}
-	obj, err := apiClient.GenericObject.ById(webhookID)
-	if err != nil {
-		return 500, err
+		rh.invalidateOnAuthError(projectID, err)
+		return storeErrorCode(err), err
 	}
+	rh.history.forget(projectID, webhookID)
+	return 204, nil
+}
 
-	if obj == nil {
-		return 404, fmt.Errorf("Webhook not found")
+func getListOptions(r *http.Request) (store.ListOptions, error) {
+	query := r.URL.Query()
+	opts := store.ListOptions{
+		Marker:     query.Get("marker"),
+		Sort:       query.Get("sort"),
+		Order:      query.Get("order"),
+		Driver:     query.Get("driver"),
+		NamePrefix: query.Get("name_prefix"),
+		State:      query.Get("state"),
 	}
-
-	err = apiClient.GenericObject.Delete(obj)
-	if err != nil {
-		statusCode := err.(*client.ApiError).StatusCode
-		return statusCode, err
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid limit %v", limit)
+		}
+		opts.Limit = l
 	}
-	return 204, nil
+	err := opts.Validate()
+	return opts, err
 }
 
 func getProjectID(r *http.Request) (string, int, error) {
@@ -153,71 +164,108 @@ func newWebhook(context *api.ApiContext, url string, id string, driverName strin
 		selfLink = selfLink + "?projectId=" + projectID
 	}
 
+	historyLink := context.UrlBuilder.ReferenceByIdLink("receiver", id) + "/history"
+	if projectID != "" {
+		historyLink = historyLink + "?projectId=" + projectID
+	}
+
 	webhook := &model.Webhook{
 		Resource: v1client.Resource{
 			Id:    id,
 			Type:  "receiver",
-			Links: map[string]string{"self": selfLink},
+			Links: map[string]string{"self": selfLink, "history": historyLink},
 		},
 		URL:    url,
 		Driver: driverName,
 		Name:   name,
 		State:  state,
 	}
-	driver.ConvertToConfigAndSetOnWebhook(driverConfig, webhook)
+	if driver != nil {
+		if err := driver.ConvertToConfigAndSetOnWebhook(driverConfig, webhook); err != nil {
+			return nil, err
+		}
+	}
 	return webhook, nil
 }
 
-type webhookGenericObject struct {
-	ID     string
-	Name   string
-	State  string
-	Links  map[string]string
-	Driver string
-	URL    string
-	Key    string
-	Config interface{}
-}
-
-func (rh *RouteHandler) convertToWebhookGenericObject(genericObject client.GenericObject) (webhookGenericObject, error) {
-	d, ok := genericObject.ResourceData["driver"].(string)
-	if !ok {
-		return webhookGenericObject{}, fmt.Errorf("Couldn't read webhook data. Bad driver")
+//newWebhookFromReceiver builds the API resource for a stored receiver. Receivers that can't be
+//decoded, or whose driver isn't registered, are returned in error state with a message.
+func newWebhookFromReceiver(context *api.ApiContext, receiver *store.Receiver, r *http.Request) *model.Webhook {
+	message := receiver.Error
+	driver := drivers.GetDriver(receiver.Driver)
+	if message == "" && driver == nil {
+		message = fmt.Sprintf("Can't find driver %v", receiver.Driver)
 	}
 
-	url, ok := genericObject.ResourceData["url"].(string)
-	if !ok {
-		return webhookGenericObject{}, fmt.Errorf("Couldn't read webhook data. Bad url")
+	if message == "" {
+		webhook, err := newWebhook(context, receiver.URL, receiver.ID, receiver.Driver, receiver.Name,
+			receiver.Config, driver, receiver.State, r)
+		if err == nil {
+			setReceiverOptions(webhook, receiver)
+			return webhook
+		}
+		message = fmt.Sprintf("An error ocurred while producing response: %v", err)
 	}
 
-	config, ok := genericObject.ResourceData["config"]
-	if !ok {
-		return webhookGenericObject{}, fmt.Errorf("Couldn't read webhook data. Bad config on resource")
-	}
+	webhook, _ := newWebhook(context, receiver.URL, receiver.ID, receiver.Driver, receiver.Name,
+		nil, nil, "error", r)
+	webhook.Message = message
+	return webhook
+}
 
-	return webhookGenericObject{
-		Name:   genericObject.Name,
-		ID:     genericObject.Id,
-		State:  genericObject.State,
-		Links:  genericObject.Links,
-		Driver: d,
-		URL:    url,
-		Key:    genericObject.Key,
-		Config: config,
-	}, nil
+//setReceiverOptions copies the driver independent options of a receiver onto its API resource
+func setReceiverOptions(webhook *model.Webhook, receiver *store.Receiver) {
+	webhook.AllowedCIDRs = receiver.AllowedCIDRs
+	webhook.Condition = receiver.Condition
+	webhook.Transform = receiver.Transform
+	webhook.Overrides = receiver.Overrides
+	webhook.TemplateID = receiver.TemplateID
+	webhook.TemplateVersion = receiver.TemplateVersion
 }
 
-func (rh *RouteHandler) isUniqueName(webhookName string, projectID string, apiClient *client.RancherClient) (int, error) {
-	filters := make(map[string]interface{})
-	filters["name"] = webhookName
-	obj, err := apiClient.GenericObject.List(&client.ListOpts{
-		Filters: filters,
-	})
+//resolveTarget shows the target the driver currently resolves the receiver's config to, if the
+//driver refers to targets indirectly. Failing to resolve it is only a warning on the receiver.
+func (rh *RouteHandler) resolveTarget(webhook *model.Webhook, driver drivers.WebhookDriver, config interface{},
+	apiClient *client.RancherClient, projectID string) {
+	resolver, ok := driver.(drivers.TargetResolver)
+	if !ok {
+		return
+	}
+	resolved, warnings, err := resolver.ResolveTarget(config, apiClient)
+	if err == nil {
+		err = driver.ConvertToConfigAndSetOnWebhook(resolved, webhook)
+	}
 	if err != nil {
-		return 500, err
+		rh.invalidateOnAuthError(projectID, err)
+		webhook.Warnings = append(webhook.Warnings, fmt.Sprintf("Unable to resolve the target: %v", err))
+		return
+	}
+	webhook.Warnings = append(webhook.Warnings, warnings...)
+}
+
+func (rh *RouteHandler) isUniqueName(webhookName string, projectID string) (int, error) {
+	_, err := rh.Store.GetByName(projectID, webhookName)
+	if err == nil || store.IsCorrupt(err) {
+		return 400, &store.ConflictError{Name: webhookName}
 	}
-	if len(obj.Data) > 0 {
-		return 400, fmt.Errorf("Cannot have duplicate webhook name, webhook %s already exists", webhookName)
+	if !store.IsNotFound(err) {
+		rh.invalidateOnAuthError(projectID, err)
+		return 500, err
 	}
 	return 200, nil
 }
+
+//storeErrorCode maps an error returned by the receiver store to a response code
+func storeErrorCode(err error) int {
+	switch cause := errors.Cause(err).(type) {
+	case *store.NotFoundError:
+		return 404
+	case *store.ConflictError, *store.TemplateConflictError:
+		return 400
+	case *store.TemplateNotFoundError:
+		return 404
+	case *client.ApiError:
+		return cause.StatusCode
+	}
+	return 500
+}
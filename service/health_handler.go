@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/webhook-service/config"
+)
+
+//defaultReadinessCacheTTL is kept below common readiness probe periods, so every probe sees a
+//fresh result
+const defaultReadinessCacheTTL = 2 * time.Second
+
+type checkResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type readinessResponse struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Checks    map[string]checkResult `json:"checks"`
+}
+
+//readinessCache holds the last readiness result so probes don't hit Cattle on every call. One
+//probe at a time refreshes it, without holding the lock while Cattle is pinged.
+type readinessCache struct {
+	mu        sync.Mutex
+	response  *readinessResponse
+	expiresAt time.Time
+	//refreshing is closed once the refresh in progress, if any, is done
+	refreshing chan struct{}
+}
+
+//Healthz reports that the process is up and serving requests
+func (rh *RouteHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthResponse(w, 200, map[string]string{"status": "ok"})
+}
+
+//Readyz reports whether the service has the configuration, keys and Cattle connectivity
+//it needs to handle requests
+func (rh *RouteHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	response := rh.readiness.get(rh.readinessCacheTTL(), rh.checkReadiness)
+	code := 200
+	if response.Status != "ok" {
+		code = 503
+	}
+	writeHealthResponse(w, code, response)
+}
+
+//get returns the cached result, refreshing it with check once it's older than ttl. Probes arriving
+//during a refresh get the previous result, or wait for the refresh when there's none yet.
+func (c *readinessCache) get(ttl time.Duration, check func() *readinessResponse) *readinessResponse {
+	c.mu.Lock()
+	if c.response != nil && time.Now().Before(c.expiresAt) {
+		response := c.response
+		c.mu.Unlock()
+		return response
+	}
+	if refreshing := c.refreshing; refreshing != nil {
+		response := c.response
+		c.mu.Unlock()
+		if response != nil {
+			return response
+		}
+		<-refreshing
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.response
+	}
+	refreshing := make(chan struct{})
+	c.refreshing = refreshing
+	c.mu.Unlock()
+
+	response := check()
+
+	c.mu.Lock()
+	c.response = response
+	c.expiresAt = time.Now().Add(ttl)
+	c.refreshing = nil
+	c.mu.Unlock()
+	close(refreshing)
+	return response
+}
+
+func (rh *RouteHandler) readinessCacheTTL() time.Duration {
+	if rh.ReadinessCacheTTL <= 0 {
+		return defaultReadinessCacheTTL
+	}
+	return rh.ReadinessCacheTTL
+}
+
+func (rh *RouteHandler) checkReadiness() *readinessResponse {
+	response := &readinessResponse{
+		Status:    "ok",
+		CheckedAt: time.Now().UTC(),
+		Checks:    map[string]checkResult{},
+	}
+
+	record := func(name string, err error) {
+		if err != nil {
+			logrus.Warnf("Readiness check %s failed: %v", name, err)
+			response.Status = "fail"
+			response.Checks[name] = checkResult{Status: "fail", Message: err.Error()}
+			return
+		}
+		response.Checks[name] = checkResult{Status: "ok"}
+	}
+
+	configErr := checkConfig(config.GetConfig())
+	record("config", configErr)
+	record("keys", rh.checkKeys())
+	if configErr != nil {
+		record("cattle", fmt.Errorf("Skipped because configuration is incomplete"))
+	} else {
+		record("cattle", rh.ClientFactory.Ping())
+	}
+
+	return response
+}
+
+func checkConfig(c config.Config) error {
+	missing := []string{}
+	if c.CattleURL == "" {
+		missing = append(missing, "CATTLE_URL")
+	}
+	if c.CattleAccessKey == "" {
+		missing = append(missing, "CATTLE_ACCESS_KEY")
+	}
+	if c.CattleSecretKey == "" {
+		missing = append(missing, "CATTLE_SECRET_KEY")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing configuration: %v", missing)
+	}
+	return nil
+}
+
+func (rh *RouteHandler) checkKeys() error {
+	if rh.Keys == nil {
+		return fmt.Errorf("RSA keys not loaded")
+	}
+	if _, privateKey := rh.Keys.SigningKey(); privateKey == nil {
+		return fmt.Errorf("RSA private key not loaded")
+	}
+	return nil
+}
+
+func writeHealthResponse(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.Errorf("Failed to write health response: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/healthz", server.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d means healthz failed", response.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	os.Setenv("CATTLE_URL", "http://cattle/v2-beta")
+	os.Setenv("CATTLE_ACCESS_KEY", "access")
+	os.Setenv("CATTLE_SECRET_KEY", "secret")
+	defer os.Unsetenv("CATTLE_URL")
+	defer os.Unsetenv("CATTLE_ACCESS_KEY")
+	defer os.Unsetenv("CATTLE_SECRET_KEY")
+
+	rh := &RouteHandler{
+		Keys:          r.Keys,
+		ClientFactory: r.ClientFactory,
+	}
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/readyz", server.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	rh.Readyz(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d means readyz failed: %s", response.Code, response.Body.String())
+	}
+	ready := &readinessResponse{}
+	if err := json.Unmarshal(response.Body.Bytes(), ready); err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []string{"config", "keys", "cattle"} {
+		if ready.Checks[check].Status != "ok" {
+			t.Fatalf("Expected check %s to pass, got %#v", check, ready.Checks[check])
+		}
+	}
+
+	// Results are cached, so a missing key is not noticed until the cache expires
+	rh.Keys = nil
+	response = httptest.NewRecorder()
+	rh.Readyz(response, request)
+	if response.Code != 200 {
+		t.Fatalf("Expected cached readiness result, got %d", response.Code)
+	}
+
+	rh.ReadinessCacheTTL = time.Nanosecond
+	rh.readiness.expiresAt = time.Now()
+	response = httptest.NewRecorder()
+	rh.Readyz(response, request)
+	if response.Code != 503 {
+		t.Fatalf("Expected the missing key to be noticed once the cache expired, got %d", response.Code)
+	}
+}
+
+func TestReadyzMissingConfig(t *testing.T) {
+	os.Unsetenv("CATTLE_URL")
+	rh := &RouteHandler{
+		ClientFactory: r.ClientFactory,
+	}
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/readyz", server.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	rh.Readyz(response, request)
+	if response.Code != 503 {
+		t.Fatalf("Expected 503 for missing config and keys, got %d", response.Code)
+	}
+	ready := &readinessResponse{}
+	if err := json.Unmarshal(response.Body.Bytes(), ready); err != nil {
+		t.Fatal(err)
+	}
+	if ready.Checks["config"].Status != "fail" || ready.Checks["keys"].Status != "fail" || ready.Checks["cattle"].Status != "fail" {
+		t.Fatalf("Unexpected readiness checks: %#v", ready.Checks)
+	}
+}
+
+func TestReadinessCacheRefresh(t *testing.T) {
+	cache := &readinessCache{}
+	cache.get(time.Nanosecond, func() *readinessResponse { return &readinessResponse{Status: "ok"} })
+	cache.expiresAt = time.Now()
+
+	release := make(chan struct{})
+	refreshed := make(chan *readinessResponse)
+	go func() {
+		refreshed <- cache.get(time.Minute, func() *readinessResponse {
+			<-release
+			return &readinessResponse{Status: "fail"}
+		})
+	}()
+	for {
+		cache.mu.Lock()
+		started := cache.refreshing != nil
+		cache.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A probe during a slow refresh gets the previous result instead of waiting for Cattle
+	if response := cache.get(time.Minute, func() *readinessResponse {
+		t.Fatal("Expected a single refresh at a time")
+		return nil
+	}); response.Status != "ok" {
+		t.Fatalf("Expected the previous result during the refresh, got %#v", response)
+	}
+	close(release)
+	if response := <-refreshed; response.Status != "fail" {
+		t.Fatalf("Unexpected refreshed result %#v", response)
+	}
+	if response := cache.get(time.Minute, nil); response.Status != "fail" {
+		t.Fatalf("Expected the refreshed result to be cached, got %#v", response)
+	}
+}
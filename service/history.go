@@ -0,0 +1,140 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rancher/go-rancher/api"
+	v1client "github.com/rancher/go-rancher/client"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+)
+
+//historySize is how many executions are kept per receiver
+const historySize = 100
+
+//executionHistory keeps the latest calls to every receiver's URL in memory, newest last
+type executionHistory struct {
+	mu      sync.Mutex
+	records map[string][]model.Execution
+	lastID  int64
+}
+
+func historyKey(projectID string, receiverID string) string {
+	return projectID + "/" + receiverID
+}
+
+//add stores an execution and returns the id it was given
+func (h *executionHistory) add(projectID string, receiverID string, execution model.Execution) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.records == nil {
+		h.records = map[string][]model.Execution{}
+	}
+	h.lastID++
+	execution.Id = strconv.FormatInt(h.lastID, 10)
+	key := historyKey(projectID, receiverID)
+	records := append(h.records[key], execution)
+	if len(records) > historySize {
+		records = records[len(records)-historySize:]
+	}
+	h.records[key] = records
+	return execution.Id
+}
+
+//update changes a stored execution in place, it does nothing once the execution was dropped
+func (h *executionHistory) update(projectID string, receiverID string, id string, change func(*model.Execution)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := h.records[historyKey(projectID, receiverID)]
+	for i := range records {
+		if records[i].Id == id {
+			change(&records[i])
+			return
+		}
+	}
+}
+
+//forget drops the history of a deleted receiver
+func (h *executionHistory) forget(projectID string, receiverID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.records, historyKey(projectID, receiverID))
+}
+
+func (h *executionHistory) list(projectID string, receiverID string) []model.Execution {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]model.Execution{}, h.records[historyKey(projectID, receiverID)]...)
+}
+
+//recordExecution adds the outcome of a call to a receiver's URL to its history and returns its id
+func (rh *RouteHandler) recordExecution(receiver *store.Receiver, caller net.IP, code int, message string) string {
+	execution := model.Execution{
+		Resource: v1client.Resource{
+			Type: "execution",
+		},
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Code:    code,
+		Message: message,
+	}
+	if caller != nil {
+		execution.SourceIP = caller.String()
+	}
+	return rh.history.add(receiver.ProjectID, receiver.ID, execution)
+}
+
+//recordHostProgress sets the latest state of a host on an execution
+func (rh *RouteHandler) recordHostProgress(receiver *store.Receiver, id string, progress model.HostProgress) {
+	rh.history.update(receiver.ProjectID, receiver.ID, id, func(execution *model.Execution) {
+		for i := range execution.Hosts {
+			if execution.Hosts[i].HostID == progress.HostID {
+				execution.Hosts[i] = progress
+				return
+			}
+		}
+		execution.Hosts = append(execution.Hosts, progress)
+	})
+}
+
+//recordServiceResults sets the outcome per service on an execution
+func (rh *RouteHandler) recordServiceResults(receiver *store.Receiver, id string, results []model.ServiceResult) {
+	if len(results) == 0 {
+		return
+	}
+	rh.history.update(receiver.ProjectID, receiver.ID, id, func(execution *model.Execution) {
+		execution.Services = results
+	})
+}
+
+//ListExecutions returns the latest calls to a receiver's URL, newest first
+func (rh *RouteHandler) ListExecutions(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	webhookID := mux.Vars(r)["id"]
+	projectID, errCode, err := getProjectID(r)
+	if err != nil {
+		return errCode, err
+	}
+
+	if _, err := rh.Store.Get(projectID, webhookID); err != nil && !store.IsCorrupt(err) {
+		rh.invalidateOnAuthError(projectID, err)
+		return storeErrorCode(err), err
+	}
+
+	records := rh.history.list(projectID, webhookID)
+	data := []model.Execution{}
+	for i := len(records) - 1; i >= 0; i-- {
+		data = append(data, records[i])
+	}
+	apiContext.Write(&model.ExecutionCollection{
+		Collection: v1client.Collection{
+			ResourceType: "execution",
+		},
+		Data: data,
+	})
+	return 200, nil
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/api"
+	v1client "github.com/rancher/go-rancher/client"
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+	"github.com/rancher/webhook-service/yaml"
+)
+
+//ExportWebhooks writes the project's receivers as a document the import action accepts. Ids, keys and
+//URLs are left out, they belong to the project the receivers live in.
+func (rh *RouteHandler) ExportWebhooks(w http.ResponseWriter, r *http.Request) (int, error) {
+	format := r.URL.Query().Get("export")
+	if format != "yaml" && format != "json" {
+		return 400, fmt.Errorf("Invalid export format %v, expected yaml or json", format)
+	}
+	projectID, errCode, err := getProjectID(r)
+	if err != nil {
+		return errCode, err
+	}
+
+	receivers, err := store.ListAll(rh.Store, projectID)
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return 500, err
+	}
+	definitions := []map[string]interface{}{}
+	for _, receiver := range receivers {
+		definition, err := receiverDefinition(receiver)
+		if err != nil {
+			logrus.Warnf("Not exporting receiver %s because: %v", receiver.ID, err)
+			continue
+		}
+		definitions = append(definitions, definition)
+	}
+	document := map[string]interface{}{"receivers": definitions}
+
+	var data []byte
+	if format == "yaml" {
+		data, err = yaml.Marshal(document)
+		w.Header().Set("Content-Type", "application/yaml")
+	} else {
+		data, err = json.MarshalIndent(document, "", "  ")
+		data = append(data, '\n')
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		return 500, err
+	}
+	w.Write(data)
+	return 200, nil
+}
+
+//ReceiverCollectionAction dispatches POST requests on the receivers collection, which create a
+//receiver unless an action is given
+func (rh *RouteHandler) ReceiverCollectionAction(w http.ResponseWriter, r *http.Request) (int, error) {
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "":
+		return rh.ConstructPayload(w, r)
+	case "import":
+		return rh.ImportReceivers(w, r)
+	}
+	return 404, fmt.Errorf("Invalid action %v", action)
+}
+
+//ImportReceivers makes the project's receivers match a YAML or JSON document. Every receiver of the
+//document is validated before anything changes. Existing receivers are updated in place, so their
+//keys and URLs stay the same. Changes are applied one by one and not rolled back: when one fails,
+//the response lists the changes applied before it and the failed one.
+func (rh *RouteHandler) ImportReceivers(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	projectID, errCode, err := getProjectID(r)
+	if err != nil {
+		return errCode, err
+	}
+
+	requestBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 500, err
+	}
+	input := &model.ReceiverImport{}
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		err = yaml.Unmarshal(requestBytes, input)
+	} else {
+		err = json.Unmarshal(requestBytes, input)
+	}
+	if err != nil {
+		return 400, errors.Wrap(err, "Bad request body")
+	}
+
+	if input.Prune && rh.Authorizer != nil {
+		if code, err := rh.Authorizer.Authorize(r, projectID, OpDelete); err != nil {
+			return code, err
+		}
+	}
+
+	existing, err := store.ListAll(rh.Store, projectID)
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return 500, err
+	}
+	plan, code, err := rh.planImport(projectID, input, existing)
+	if err != nil {
+		return code, err
+	}
+
+	result := &model.ReceiverImportResult{
+		Resource: v1client.Resource{
+			Type: "receiverImportResult",
+		},
+		DryRun:  input.DryRun,
+		Changes: []model.ReceiverChange{},
+	}
+	for _, step := range plan {
+		if !input.DryRun {
+			id, code, err := rh.applyImportStep(apiContext, projectID, step)
+			if err != nil {
+				err = fmt.Errorf("Import stopped after %d changes, %s of receiver %s failed: %v",
+					len(result.Changes), step.change.Action, step.change.Name, err)
+				failed := step.change
+				failed.Action = "failed"
+				failed.Message = err.Error()
+				result.Changes = append(result.Changes, failed)
+				return code, &errorWithResult{error: err, result: result}
+			}
+			step.change.ID = id
+		}
+		result.Changes = append(result.Changes, step.change)
+	}
+
+	apiContext.WriteResource(result)
+	return 200, nil
+}
+
+//importStep is one change of an import, with what's needed to apply it
+type importStep struct {
+	change       model.ReceiverChange
+	webhook      *model.Webhook
+	driverConfig interface{}
+	existing     *store.Receiver
+}
+
+//planImport validates the document and works out the changes it makes to the existing receivers.
+//All invalid receivers are reported at once.
+func (rh *RouteHandler) planImport(projectID string, input *model.ReceiverImport, existing []*store.Receiver) ([]*importStep, int, error) {
+	apiClient, err := rh.ClientFactory.GetClient(projectID)
+	if err != nil {
+		return nil, 500, err
+	}
+
+	byName := map[string]*store.Receiver{}
+	for _, receiver := range existing {
+		byName[receiver.Name] = receiver
+	}
+
+	plan := []*importStep{}
+	problems := []string{}
+	listed := map[string]bool{}
+	for i := range input.Receivers {
+		wh := &input.Receivers[i]
+		driver, driverConfig, err := checkReceiverDefinition(wh)
+		if err == nil && listed[wh.Name] {
+			err = fmt.Errorf("Listed more than once")
+		}
+		if err == nil {
+			if _, err = driver.ValidatePayload(driverConfig, apiClient); err != nil {
+				rh.invalidateOnAuthError(projectID, err)
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("receiver %d (%s): %v", i+1, wh.Name, err))
+			continue
+		}
+		listed[wh.Name] = true
+
+		step := &importStep{
+			change:       model.ReceiverChange{Name: wh.Name, Action: "create"},
+			webhook:      wh,
+			driverConfig: driverConfig,
+			existing:     byName[wh.Name],
+		}
+		if step.existing != nil {
+			step.change.ID = step.existing.ID
+			step.change.Fields, err = changedFields(step.existing, wh)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("receiver %d (%s): %v", i+1, wh.Name, err))
+				continue
+			}
+			step.change.Action = "update"
+			if len(step.change.Fields) == 0 {
+				step.change.Action = "unchanged"
+			}
+		}
+		plan = append(plan, step)
+	}
+	if len(problems) > 0 {
+		return nil, 400, fmt.Errorf("Invalid receivers, nothing was imported: %s", strings.Join(problems, "; "))
+	}
+
+	if input.Prune {
+		for _, receiver := range existing {
+			if !listed[receiver.Name] {
+				plan = append(plan, &importStep{
+					change:   model.ReceiverChange{Name: receiver.Name, Action: "delete", ID: receiver.ID},
+					existing: receiver,
+				})
+			}
+		}
+	}
+	return plan, 0, nil
+}
+
+//applyImportStep makes one change of an import and returns the id of the receiver it changed
+func (rh *RouteHandler) applyImportStep(apiContext *api.ApiContext, projectID string, step *importStep) (string, int, error) {
+	switch step.change.Action {
+	case "create":
+		receiver, code, err := rh.createReceiver(apiContext, step.webhook, projectID, step.driverConfig, nil)
+		if err != nil {
+			return "", code, err
+		}
+		return receiver.ID, 0, nil
+	case "update":
+		receiver, err := rh.updateReceiver(step.existing, step.webhook, step.driverConfig)
+		if err != nil {
+			return "", storeErrorCode(err), err
+		}
+		return receiver.ID, 0, nil
+	case "delete":
+		if err := rh.Store.Delete(projectID, step.existing.ID); err != nil {
+			rh.invalidateOnAuthError(projectID, err)
+			return "", storeErrorCode(err), err
+		}
+		rh.history.forget(projectID, step.existing.ID)
+	}
+	return step.change.ID, 0, nil
+}
+
+//updateReceiver rewrites an existing receiver from a validated definition, keeping its key and URL
+func (rh *RouteHandler) updateReceiver(existing *store.Receiver, wh *model.Webhook, driverConfig interface{}) (*store.Receiver, error) {
+	update := *existing
+	update.Name = wh.Name
+	update.Driver = wh.Driver
+	update.Config = driverConfig
+	update.AllowedCIDRs = wh.AllowedCIDRs
+	update.Condition = wh.Condition
+	update.Transform = wh.Transform
+	update.Overrides = wh.Overrides
+	update.Error = ""
+	receiver, err := rh.Store.Update(&update)
+	if err != nil {
+		rh.invalidateOnAuthError(existing.ProjectID, err)
+		return nil, err
+	}
+	return receiver, nil
+}
+
+//changedFields lists the definition fields a receiver would change to match wh. The driver config
+//of a token URL receiver is signed into its token, so it can't be changed in place.
+func changedFields(receiver *store.Receiver, wh *model.Webhook) ([]string, error) {
+	desired, err := webhookDefinition(wh)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]interface{}{}
+	if receiver.Error == "" {
+		if current, err = receiverDefinition(receiver); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := []string{}
+	for key := range desired {
+		if !reflect.DeepEqual(desired[key], current[key]) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+
+	if receiver.Error == "" && usesToken(receiver) {
+		for _, field := range fields {
+			if field == "driver" || field == "useToken" || strings.HasSuffix(field, "Config") {
+				return nil, fmt.Errorf("The %s of a receiver with a token URL can't be changed, delete it first", field)
+			}
+		}
+	} else if wh.UseToken {
+		return nil, fmt.Errorf("An existing receiver can't be given a token URL, delete it first")
+	}
+	return fields, nil
+}
+
+//receiverDefinition is the declarative form of a stored receiver
+func receiverDefinition(receiver *store.Receiver) (map[string]interface{}, error) {
+	if receiver.Error != "" {
+		return nil, errors.New(receiver.Error)
+	}
+	driver := drivers.GetDriver(receiver.Driver)
+	if driver == nil {
+		return nil, fmt.Errorf("Can't find driver %v", receiver.Driver)
+	}
+	wh := &model.Webhook{
+		Driver:       receiver.Driver,
+		Name:         receiver.Name,
+		UseToken:     usesToken(receiver),
+		AllowedCIDRs: receiver.AllowedCIDRs,
+		Condition:    receiver.Condition,
+		Transform:    receiver.Transform,
+		Overrides:    receiver.Overrides,
+	}
+	if err := driver.ConvertToConfigAndSetOnWebhook(receiver.Config, wh); err != nil {
+		return nil, err
+	}
+	return webhookDefinition(wh)
+}
+
+//webhookDefinition is the declarative form of a receiver definition: its user fields and the config
+//of its own driver, with empty fields left out
+func webhookDefinition(wh *model.Webhook) (map[string]interface{}, error) {
+	definition := map[string]interface{}{
+		"name":   wh.Name,
+		"driver": wh.Driver,
+	}
+	config, err := jsonValue(getDriverConfig(wh))
+	if err != nil {
+		return nil, err
+	}
+	if configMap, ok := config.(map[string]interface{}); ok {
+		delete(configMap, "type")
+	}
+	definition[wh.Driver+"Config"] = config
+
+	if wh.UseToken {
+		definition["useToken"] = true
+	}
+	if len(wh.AllowedCIDRs) > 0 {
+		definition["allowedCIDRs"] = wh.AllowedCIDRs
+	}
+	if wh.Condition != "" {
+		definition["condition"] = wh.Condition
+	}
+	if len(wh.Transform) > 0 {
+		definition["transform"] = wh.Transform
+	}
+	if len(wh.Overrides) > 0 {
+		definition["overrides"] = wh.Overrides
+	}
+	return jsonMap(definition)
+}
+
+//usesToken tells if a receiver was created with useToken
+func usesToken(receiver *store.Receiver) bool {
+	return strings.Contains(receiver.URL, "/endpoint?token=")
+}
+
+//jsonValue round-trips value through JSON, so values of different Go types that encode the same
+//compare equal
+func jsonValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func jsonMap(value map[string]interface{}) (map[string]interface{}, error) {
+	result, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]interface{}), nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+)
+
+func TestImportExportReceivers(t *testing.T) {
+	rh := &RouteHandler{
+		ClientFactory: r.ClientFactory,
+		Store:         store.NewMemoryStore(),
+		Keys:          r.Keys,
+	}
+	router := NewRouter(rh)
+
+	importDocument := func(contentType string, document string) (int, *model.ReceiverImportResult, string) {
+		request, err := http.NewRequest("POST", "http://localhost/v1-webhooks/receivers?action=import&projectId=1a1",
+			bytes.NewBufferString(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		result := &model.ReceiverImportResult{}
+		json.Unmarshal(response.Body.Bytes(), result)
+		return response.Code, result, response.Body.String()
+	}
+	actions := func(result *model.ReceiverImportResult) string {
+		a := []string{}
+		for _, change := range result.Changes {
+			a = append(a, fmt.Sprintf("%s:%s%v", change.Name, change.Action, change.Fields))
+		}
+		return strings.Join(a, " ")
+	}
+	receiver := func(name string) string {
+		return "- name: " + name + "\n  driver: scaleService\n" +
+			"  scaleServiceConfig: {serviceId: id, action: up, amount: 1, min: 1, max: 4}\n"
+	}
+
+	code, result, body := importDocument("application/yaml", "receivers:\n"+receiver("a")+receiver("b"))
+	if code != 200 || actions(result) != "a:create[] b:create[]" || result.Changes[0].ID == "" {
+		t.Fatalf("Unexpected import %d %s", code, body)
+	}
+	created, err := rh.Store.GetByName("1a1", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := rh.Store.GetByName("1a1", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh.history.add("1a1", pruned.ID, model.Execution{Code: 200})
+
+	update := "prune: true\nreceivers:\n" + receiver("a") + "  condition: body.status == 'firing'\n"
+	code, result, body = importDocument("application/yaml", "dryRun: true\n"+update)
+	if code != 200 || !result.DryRun || actions(result) != "a:update[condition] b:delete[]" {
+		t.Fatalf("Unexpected dry run %d %s", code, body)
+	}
+	if _, err := rh.Store.GetByName("1a1", "b"); err != nil {
+		t.Fatalf("Dry run deleted a receiver: %v", err)
+	}
+
+	code, result, body = importDocument("application/yaml", update)
+	if code != 200 || actions(result) != "a:update[condition] b:delete[]" {
+		t.Fatalf("Unexpected import %d %s", code, body)
+	}
+	updated, err := rh.Store.GetByName("1a1", "a")
+	if err != nil || updated.Key != created.Key || updated.URL != created.URL || updated.Condition != "body.status == 'firing'" {
+		t.Fatalf("Receiver not updated in place: %#v %v", updated, err)
+	}
+	if _, err := rh.Store.GetByName("1a1", "b"); !store.IsNotFound(err) {
+		t.Fatalf("Receiver b not pruned: %v", err)
+	}
+	if executions := rh.history.list("1a1", pruned.ID); len(executions) != 0 {
+		t.Fatalf("Expected the history of a pruned receiver to be dropped: %#v", executions)
+	}
+
+	code, _, body = importDocument("application/json", `{"receivers": [{"name": "c", "driver": "scaleService",
+		"scaleServiceConfig": {"serviceId": "id", "action": "up", "amount": 1, "min": 2, "max": 4}}, {"name": "d"}]}`)
+	if code != 400 || !strings.Contains(body, "receiver 1 (c)") || !strings.Contains(body, "receiver 2 (d): Driver not provided") {
+		t.Fatalf("Expected all invalid receivers to be reported, got %d %s", code, body)
+	}
+	if list, _ := store.ListAll(rh.Store, "1a1"); len(list) != 1 {
+		t.Fatalf("Invalid import changed receivers: %#v", list)
+	}
+
+	request, err := http.NewRequest("GET", "http://localhost/v1-webhooks/receivers?export=yaml&projectId=1a1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	exported := response.Body.String()
+	if response.Code != 200 || !strings.Contains(exported, "name: a") || strings.Contains(exported, created.Key) {
+		t.Fatalf("Unexpected export %d\n%s", response.Code, exported)
+	}
+
+	code, result, body = importDocument("application/yaml", exported)
+	if code != 200 || actions(result) != "a:unchanged[]" {
+		t.Fatalf("Expected re-importing the export to change nothing, got %d %s\n%s", code, body, exported)
+	}
+}
+
+//failingStore fails to create receivers named bad
+type failingStore struct {
+	*store.MemoryStore
+}
+
+func (s failingStore) Create(receiver *store.Receiver) (*store.Receiver, error) {
+	if receiver.Name == "bad" {
+		return nil, fmt.Errorf("Store unavailable")
+	}
+	return s.MemoryStore.Create(receiver)
+}
+
+func TestImportReportsAppliedChangesOnFailure(t *testing.T) {
+	rh := &RouteHandler{
+		ClientFactory: r.ClientFactory,
+		Store:         failingStore{store.NewMemoryStore()},
+		Keys:          r.Keys,
+	}
+	router := NewRouter(rh)
+
+	document := "receivers:\n"
+	for _, name := range []string{"a", "bad", "c"} {
+		document += "- name: " + name + "\n  driver: scaleService\n" +
+			"  scaleServiceConfig: {serviceId: id, action: up, amount: 1, min: 1, max: 4}\n"
+	}
+	request, err := http.NewRequest("POST", "http://localhost/v1-webhooks/receivers?action=import&projectId=1a1",
+		bytes.NewBufferString(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/yaml")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	result := &model.ReceiverImportResult{}
+	if err := json.Unmarshal(response.Body.Bytes(), result); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != 500 || len(result.Changes) != 2 || result.Changes[0].Action != "create" || result.Changes[0].ID == "" ||
+		result.Changes[1].Name != "bad" || result.Changes[1].Action != "failed" ||
+		!strings.Contains(result.Changes[1].Message, "Import stopped after 1 changes, create of receiver bad failed: Store unavailable") {
+		t.Fatalf("Unexpected failed import %d %s", response.Code, response.Body.String())
+	}
+	if _, err := rh.Store.GetByName("1a1", "a"); err != nil {
+		t.Fatalf("Expected the change applied before the failure to be kept: %v", err)
+	}
+	if _, err := rh.Store.GetByName("1a1", "c"); !store.IsNotFound(err) {
+		t.Fatalf("Expected the import to stop at the failure: %v", err)
+	}
+}
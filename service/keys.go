@@ -2,42 +2,357 @@ package service
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 
-	"github.com/rancher/rancher-auth-service/util"
+	"github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/urfave/cli"
 )
 
-func GetKeys(c *cli.Context) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	var PrivateKey *rsa.PrivateKey
-	var PublicKey *rsa.PublicKey
-	privateKeyFile := c.GlobalString("rsa-private-key-file")
-	privateKeyFileContents := c.GlobalString("rsa-private-key-contents")
+//KeySource says where the signing key and the verifying public keys are read from. Files are read
+//again on every reload, contents are fixed for the life of the process.
+type KeySource struct {
+	PrivateKeyFile     string
+	PrivateKeyContents string
+	PublicKeyFile      string
+	PublicKeyContents  string
+	PublicKeysDir      string
+	JWKSFile           string
+}
+
+//KeySet holds the private key new tokens are signed with and every public key tokens may be
+//verified with, indexed by kid. The signing key's public half is always part of the set, so old
+//keys can be kept around for verification while a new one signs.
+type KeySet struct {
+	source *KeySource
+
+	mu         sync.RWMutex
+	signingKey *rsa.PrivateKey
+	signingKID string
+	publicKeys map[string]*rsa.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+//NewKeySet builds a fixed key set, without a source to reload from
+func NewKeySet(privateKey *rsa.PrivateKey, publicKeys ...*rsa.PublicKey) *KeySet {
+	k := &KeySet{}
+	k.set(privateKey, publicKeys, map[string]*rsa.PublicKey{})
+	return k
+}
+
+//LoadKeySet reads the key set configured on the command line
+func LoadKeySet(c *cli.Context) (*KeySet, error) {
+	source := &KeySource{
+		PrivateKeyFile:     c.GlobalString("rsa-private-key-file"),
+		PrivateKeyContents: c.GlobalString("rsa-private-key-contents"),
+		PublicKeyFile:      c.GlobalString("rsa-public-key-file"),
+		PublicKeyContents:  c.GlobalString("rsa-public-key-contents"),
+		PublicKeysDir:      c.GlobalString("rsa-public-keys-dir"),
+		JWKSFile:           c.GlobalString("rsa-public-keys-jwks-file"),
+	}
+	return LoadKeySetFrom(source)
+}
+
+//LoadKeySetFrom reads a key set from source, which it is reloaded from
+func LoadKeySetFrom(source *KeySource) (*KeySet, error) {
+	k := &KeySet{source: source}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//Reload reads the keys from the key set's source again. The current keys are kept if any key
+//fails to load.
+func (k *KeySet) Reload() error {
+	if k.source == nil {
+		return nil
+	}
+	privateKey, publicKeys, withKID, err := k.source.load()
+	if err != nil {
+		return err
+	}
+	k.set(privateKey, publicKeys, withKID)
+	kid, _ := k.SigningKey()
+	logrus.Infof("Loaded %d public keys, signing with key %s", len(k.PublicKeys()), kid)
+	return nil
+}
+
+//ReloadOnSIGHUP reloads the key set every time the process receives SIGHUP
+func (k *KeySet) ReloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := k.Reload(); err != nil {
+				logrus.Errorf("Failed to reload keys, keeping the current ones: %v", err)
+			}
+		}
+	}()
+}
+
+func (k *KeySet) set(privateKey *rsa.PrivateKey, publicKeys []*rsa.PublicKey, withKID map[string]*rsa.PublicKey) {
+	keys := map[string]*rsa.PublicKey{}
+	for kid, key := range withKID {
+		keys[kid] = key
+	}
+	for _, key := range publicKeys {
+		if key != nil {
+			keys[keyID(key)] = key
+		}
+	}
+
+	signingKID := ""
+	if privateKey != nil {
+		signingKID = keyID(&privateKey.PublicKey)
+		keys[signingKID] = &privateKey.PublicKey
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.signingKey = privateKey
+	k.signingKID = signingKID
+	k.publicKeys = keys
+}
+
+//SigningKey returns the key new tokens are signed with and its kid
+func (k *KeySet) SigningKey() (string, *rsa.PrivateKey) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signingKID, k.signingKey
+}
+
+//PublicKey returns the public key with the given kid, or nil
+func (k *KeySet) PublicKey(kid string) *rsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.publicKeys[kid]
+}
+
+//PublicKeys returns a copy of all public keys by kid
+func (k *KeySet) PublicKeys() map[string]*rsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := map[string]*rsa.PublicKey{}
+	for kid, key := range k.publicKeys {
+		keys[kid] = key
+	}
+	return keys
+}
+
+//Sign signs claims with the signing key and sets its kid in the token header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	kid, privateKey := k.SigningKey()
+	if privateKey == nil {
+		return "", fmt.Errorf("No private key loaded, can't sign tokens")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(privateKey)
+}
+
+//Parse verifies an RS256 token with the public key named by its kid. Tokens minted before key ids
+//were introduced have no kid and are tried against every key, so they keep working as long as the
+//key that signed them is in the set.
+func (k *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	parse := func(key *rsa.PublicKey) (*jwt.Token, error) {
+		return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			}
+			if key != nil {
+				return key, nil
+			}
+			kid, _ := token.Header["kid"].(string)
+			if found := k.PublicKey(kid); found != nil {
+				return found, nil
+			}
+			return nil, fmt.Errorf("Unknown key id %v", token.Header["kid"])
+		})
+	}
+
+	token, err := parse(nil)
+	if token == nil || token.Header["kid"] != nil {
+		return token, err
+	}
+
+	signingKID, _ := k.SigningKey()
+	kids := k.sortedKIDs(signingKID)
+	for _, kid := range kids {
+		token, err = parse(k.PublicKey(kid))
+		if vErr, ok := err.(*jwt.ValidationError); ok && vErr.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
+			continue
+		}
+		return token, err
+	}
+	return token, err
+}
 
-	if privateKeyFile != "" && privateKeyFileContents != "" {
-		return nil, nil, fmt.Errorf("Can't specify both, file and contents, halting")
+//sortedKIDs lists the kids with first in front, so the likeliest key is tried first
+func (k *KeySet) sortedKIDs(first string) []string {
+	kids := []string{}
+	for kid := range k.PublicKeys() {
+		if kid != first {
+			kids = append(kids, kid)
+		}
 	}
-	if privateKeyFile != "" {
-		PrivateKey = util.ParsePrivateKey(privateKeyFile)
-	} else if privateKeyFileContents != "" {
-		PrivateKey = util.ParsePrivateKeyContents(privateKeyFileContents)
-	} else {
-		return nil, nil, fmt.Errorf("Please provide either rsa-private-key-file or rsa-private-key-contents, halting")
+	sort.Strings(kids)
+	if first != "" {
+		kids = append([]string{first}, kids...)
 	}
+	return kids
+}
 
-	publicKeyFile := c.GlobalString("rsa-public-key-file")
-	publicKeyFileContents := c.GlobalString("rsa-public-key-contents")
+//JWKS returns the public keys as a JSON Web Key Set
+func (k *KeySet) JWKS() interface{} {
+	set := jwks{Keys: []jwk{}}
+	keys := k.PublicKeys()
+	for _, kid := range k.sortedKIDs("") {
+		key := keys[kid]
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	return set
+}
 
-	if publicKeyFile != "" && publicKeyFileContents != "" {
-		return nil, nil, fmt.Errorf("Can't specify both, file and contents, halting")
+//keyID is the RFC 7638 thumbprint of key, so the same key always gets the same kid
+func keyID(key *rsa.PublicKey) string {
+	thumbprint := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+	sum := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (s *KeySource) load() (*rsa.PrivateKey, []*rsa.PublicKey, map[string]*rsa.PublicKey, error) {
+	privateKeyPEM, err := readKey(s.PrivateKeyFile, s.PrivateKeyContents, "rsa-private-key")
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	if publicKeyFile != "" {
-		PublicKey = util.ParsePublicKey(publicKeyFile)
-	} else if publicKeyFileContents != "" {
-		PublicKey = util.ParsePublicKeyContents(publicKeyFileContents)
-	} else {
-		return nil, nil, fmt.Errorf("Please provide either rsa-public-key-file or rsa-public-key-contents, halting")
+	if privateKeyPEM == nil {
+		return nil, nil, nil, fmt.Errorf("Please provide either rsa-private-key-file or rsa-private-key-contents, halting")
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to parse private key: %v", err)
 	}
 
-	return PrivateKey, PublicKey, nil
+	publicKeys := []*rsa.PublicKey{}
+	publicKeyPEM, err := readKey(s.PublicKeyFile, s.PublicKeyContents, "rsa-public-key")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if publicKeyPEM != nil {
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPEM)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to parse public key: %v", err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	if s.PublicKeysDir != "" {
+		files, err := filepath.Glob(filepath.Join(s.PublicKeysDir, "*.pem"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, file := range files {
+			keyBytes, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(keyBytes)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("Failed to parse public key %s: %v", file, err)
+			}
+			publicKeys = append(publicKeys, publicKey)
+		}
+	}
+
+	withKID := map[string]*rsa.PublicKey{}
+	if s.JWKSFile != "" {
+		withKID, err = readJWKSFile(s.JWKSFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return privateKey, publicKeys, withKID, nil
+}
+
+func readKey(file string, contents string, name string) ([]byte, error) {
+	if file != "" && contents != "" {
+		return nil, fmt.Errorf("Can't specify both, %s-file and %s-contents, halting", name, name)
+	}
+	if file != "" {
+		return ioutil.ReadFile(file)
+	}
+	if contents != "" {
+		return []byte(contents), nil
+	}
+	return nil, nil
+}
+
+//readJWKSFile reads the RSA keys of a JSON Web Key Set. Keys without a kid are given their
+//thumbprint.
+func readJWKSFile(file string) (map[string]*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	set := &jwks{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("Failed to parse JWKS file %s: %v", file, err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.N, "="))
+		e, errE := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.E, "="))
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+			return nil, fmt.Errorf("Invalid key %s in JWKS file %s", key.Kid, file)
+		}
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		kid := key.Kid
+		if kid == "" {
+			kid = keyID(publicKey)
+		}
+		keys[kid] = publicKey
+	}
+	return keys, nil
 }
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func writeKeyPEM(t *testing.T, path string, key interface{}) {
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signWith(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"uuid": "key1"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := map[string]*rsa.PrivateKey{}
+	for _, name := range []string{"old", "new", "jwks", "unknown"} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+
+	publicDir := filepath.Join(dir, "public")
+	if err := os.Mkdir(publicDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPEM(t, filepath.Join(publicDir, "old.pem"), &keys["old"].PublicKey)
+	privateFile := filepath.Join(dir, "private.pem")
+	writeKeyPEM(t, privateFile, keys["old"])
+
+	jwksFile := filepath.Join(dir, "jwks.json")
+	set := NewKeySet(nil, &keys["jwks"].PublicKey).JWKS().(jwks)
+	set.Keys[0].Kid = "external-1"
+	data, _ := json.Marshal(set)
+	if err := ioutil.WriteFile(jwksFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &KeySource{PrivateKeyFile: privateFile, PublicKeysDir: publicDir, JWKSFile: jwksFile}
+	k := &KeySet{source: source}
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	oldKID, _ := k.SigningKey()
+	legacy := signWith(t, keys["old"], "")
+
+	// Rotate the signing key, the old one stays in the directory for verification
+	writeKeyPEM(t, privateFile, keys["new"])
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newKID, _ := k.SigningKey()
+	if newKID == oldKID || newKID != keyID(&keys["new"].PublicKey) {
+		t.Fatalf("Signing key not rotated: %v %v", oldKID, newKID)
+	}
+
+	signed, err := k.Sign(jwt.MapClaims{"uuid": "key1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"active key", signed, true},
+		{"old key by kid", signWith(t, keys["old"], oldKID), true},
+		{"old key without kid", legacy, true},
+		{"jwks key", signWith(t, keys["jwks"], "external-1"), true},
+		{"unknown kid", signWith(t, keys["unknown"], "nope"), false},
+		{"unknown key without kid", signWith(t, keys["unknown"], ""), false},
+		{"kid of another key", signWith(t, keys["unknown"], newKID), false},
+	}
+	for _, test := range tests {
+		token, err := k.Parse(test.token)
+		valid := err == nil && token.Valid
+		if valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v (%v)", test.name, test.valid, valid, err)
+		}
+	}
+
+	// A broken key file keeps the current keys
+	if err := ioutil.WriteFile(privateFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reload(); err == nil {
+		t.Fatal("Expected reload of a broken key to fail")
+	}
+	if kid, _ := k.SigningKey(); kid != newKID {
+		t.Fatalf("Keys changed after failed reload: %v", kid)
+	}
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/v1-webhooks/jwks.json", server.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d getting jwks", response.Code)
+	}
+	set := &jwks{}
+	if err := json.Unmarshal(response.Body.Bytes(), set); err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := r.Keys.SigningKey()
+	if len(set.Keys) != 1 || set.Keys[0].Kid != kid || set.Keys[0].N == "" || set.Keys[0].E != "AQAB" {
+		t.Fatalf("Unexpected jwks: %#v", set)
+	}
+}
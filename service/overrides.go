@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/model"
+)
+
+//validateOverrides checks that every overridable field is a numeric or string field of the driver's
+//config and that its bounds suit the field's kind
+func validateOverrides(driver drivers.WebhookDriver, overrides map[string]model.OverrideBounds) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	kinds := configFieldKinds(driver.GetDriverConfigResource())
+	for field, bounds := range overrides {
+		kind, ok := kinds[field]
+		if !ok || field == "type" {
+			return fmt.Errorf("Invalid override, %s is not a config field of this driver", field)
+		}
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if len(bounds.Values) > 0 {
+				return fmt.Errorf("Invalid override for %s, values can only be given for string fields", field)
+			}
+			if bounds.Min > bounds.Max {
+				return fmt.Errorf("Invalid override for %s, min must not be greater than max", field)
+			}
+			if bounds.Min == 0 && bounds.Max == 0 {
+				return fmt.Errorf("Invalid override for %s, min and max not provided", field)
+			}
+		case reflect.String:
+			if bounds.Min != 0 || bounds.Max != 0 {
+				return fmt.Errorf("Invalid override for %s, min and max can only be given for numeric fields", field)
+			}
+			if len(bounds.Values) == 0 {
+				return fmt.Errorf("Invalid override for %s, allowed values not provided", field)
+			}
+		default:
+			return fmt.Errorf("Invalid override, %s can't be overridden", field)
+		}
+	}
+	return nil
+}
+
+//configFieldKinds maps the JSON names of a driver config struct's fields to their kinds
+func configFieldKinds(config interface{}) map[string]reflect.Kind {
+	kinds := map[string]reflect.Kind{}
+	t := reflect.TypeOf(config)
+	if t == nil || t.Kind() != reflect.Struct {
+		return kinds
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			kinds[name] = t.Field(i).Type.Kind()
+		}
+	}
+	return kinds
+}
+
+//applyOverrides sets the overridable config fields found at the top level of a call's body. A value
+//of the wrong type or outside its bounds rejects the call rather than being ignored, so a caller
+//never gets an action it didn't ask for.
+func applyOverrides(overrides map[string]model.OverrideBounds, config map[string]interface{},
+	requestBody interface{}) error {
+	body, ok := requestBody.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for field, bounds := range overrides {
+		value, ok := body[field]
+		if !ok || value == nil {
+			continue
+		}
+		if len(bounds.Values) > 0 {
+			s, ok := value.(string)
+			if !ok || !containsString(bounds.Values, s) {
+				return fmt.Errorf("Invalid %s %v, must be one of %s", field, value, strings.Join(bounds.Values, ", "))
+			}
+			config[field] = s
+			continue
+		}
+		n, ok := overrideInt(value)
+		if !ok {
+			return fmt.Errorf("Invalid %s %v, must be a whole number", field, value)
+		}
+		if n < bounds.Min || n > bounds.Max {
+			return fmt.Errorf("Invalid %s %d, must be between %d and %d", field, n, bounds.Min, bounds.Max)
+		}
+		config[field] = n
+	}
+	return nil
+}
+
+//overrideInt reads a whole number from a JSON number or, for form and text bodies, a string
+func overrideInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+			return 0, false
+		}
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestOverrides(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	create := func(overrides string) *httptest.ResponseRecorder {
+		jsonStr := []byte(`{"driver":"scaleService","name":"wh-overrides","overrides": ` + overrides + `,
+			"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+		request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	for _, overrides := range []string{
+		`{"serviceId": {"values": ["id"]}, "missing": {"max": 3}}`,
+		`{"amount": {"min": 3, "max": 1}}`,
+		`{"amount": {}}`,
+		`{"amount": {"values": ["1"]}}`,
+		`{"action": {"max": 2}}`,
+		`{"action": {}}`,
+		`{"type": {"values": ["scaleService"]}}`,
+	} {
+		if response := create(overrides); response.Code != 400 {
+			t.Fatalf("StatusCode %d, overrides %s must be rejected", response.Code, overrides)
+		}
+	}
+
+	response := create(`{"amount": {"min": 1, "max": 3}, "action": {"values": ["up"]}}`)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d creating webhook with overrides: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+	if wh.Overrides["amount"].Max != 3 || len(wh.Overrides["action"].Values) != 1 {
+		t.Fatalf("Overrides missing from webhook: %#v", wh)
+	}
+
+	// The mock driver fails unless amount is 1, which shows whether the override was applied
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{}`, 200},
+		{`{"amount": 1, "action": "up"}`, 200},
+		{`{"amount": 2}`, 500},
+		{`{"amount": 4}`, 400},
+		{`{"amount": 0}`, 400},
+		{`{"amount": 1.5}`, 400},
+		{`{"amount": "1"}`, 200},
+		{`{"action": "down"}`, 400},
+		{`{"action": 1}`, 400},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest("POST", wh.URL, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != test.code {
+			t.Errorf("StatusCode %d executing with %s, expected %d", response.Code, test.body, test.code)
+		}
+	}
+}
+
+func TestOverriddenConfigIsValidated(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	launchConfig := map[string]interface{}{"imageUuid": "docker:nginx"}
+	serviceID := cattle.Add("1a1", "service", map[string]interface{}{"kind": "service", "scale": 1, "launchConfig": launchConfig})
+	globalID := cattle.Add("1a1", "service", map[string]interface{}{"kind": "service", "scale": 1,
+		"launchConfig": map[string]interface{}{"imageUuid": "docker:nginx", "labels": map[string]interface{}{"io.rancher.scheduler.global": "true"}}})
+	apiClient, err := cattle.GetClient("1a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := &RouteHandler{}
+	receiver := &store.Receiver{ProjectID: "1a1", ID: "1", Driver: "scaleService",
+		Overrides: map[string]model.OverrideBounds{"serviceId": {Values: []string{serviceID, globalID}}}}
+	config := model.ScaleService{ServiceID: serviceID, ScaleAction: "up", ScaleChange: 1, Min: 1, Max: 4}
+
+	body := map[string]interface{}{"serviceId": globalID}
+	if code, err := rh.executeReceiver(receiver, &drivers.ScaleServiceDriver{}, config, apiClient, nil, body); code != 400 ||
+		!strings.Contains(err.Error(), "global service") {
+		t.Fatalf("Expected the overridden global service to be rejected, got %d %v", code, err)
+	}
+	if service := cattle.Get("service", globalID); service["scale"] != float64(1) {
+		t.Fatalf("The global service must not be scaled, got %v", service["scale"])
+	}
+
+	if code, err := rh.executeReceiver(receiver, &drivers.ScaleServiceDriver{}, config, apiClient, nil, map[string]interface{}{}); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+//readPayload reads the body of a call to a receiver URL and normalizes it to the JSON-like values
+//drivers expect. Form bodies become an object of their fields, with repeated fields as a list,
+//and text bodies become {"text": body}. Bodies without a known Content-Type, and form bodies that
+//are a JSON object or array, are read as JSON. An empty body is nil.
+func (rh *RouteHandler) readPayload(r *http.Request) (interface{}, int, error) {
+	if r.Body == nil {
+		return nil, 0, nil
+	}
+
+	maxBytes := rh.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+	if r.ContentLength > maxBytes {
+		return nil, 413, fmt.Errorf("Request body is larger than %d bytes", maxBytes)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, 500, fmt.Errorf("Error reading request body in Execute handler: %v", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, 413, fmt.Errorf("Request body is larger than %d bytes", maxBytes)
+	}
+	if len(body) == 0 {
+		return nil, 0, nil
+	}
+
+	//bodies were always read as JSON, so JSON stays the fallback for callers that send it without
+	//the right Content-Type, such as curl -d which sends it as form data
+	mediaType := ""
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			mediaType = ""
+		}
+	}
+
+	switch {
+	case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var payload interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, 400, fmt.Errorf("Request body is not valid JSON: %v", err)
+		}
+		return payload, 0, nil
+
+	case mediaType == "application/x-www-form-urlencoded":
+		if payload, ok := jsonDocument(body); ok {
+			return payload, 0, nil
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, 400, fmt.Errorf("Request body is not valid form data: %v", err)
+		}
+		payload := map[string]interface{}{}
+		for key, list := range values {
+			if len(list) == 1 {
+				payload[key] = list[0]
+				continue
+			}
+			items := []interface{}{}
+			for _, item := range list {
+				items = append(items, item)
+			}
+			payload[key] = items
+		}
+		return payload, 0, nil
+
+	case mediaType == "text/plain":
+		return map[string]interface{}{"text": string(body)}, 0, nil
+	}
+
+	if payload, ok := jsonDocument(body); ok {
+		return payload, 0, nil
+	}
+	return nil, 415, fmt.Errorf("Unsupported Content-Type %v, must be application/json, application/x-www-form-urlencoded or text/plain", mediaType)
+}
+
+//jsonDocument parses a body that is a JSON object or array. Form data never starts with { or [
+//unescaped, so such a body sent with another Content-Type can be read as JSON safely.
+func jsonDocument(body []byte) (interface{}, bool) {
+	trimmed := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, false
+	}
+	return payload, true
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPayload(t *testing.T) {
+	rh := &RouteHandler{MaxBodyBytes: 64}
+
+	tests := []struct {
+		contentType string
+		body        string
+		code        int
+		payload     interface{}
+	}{
+		{"", "", 0, nil},
+		{"", `{"a": 1}`, 0, map[string]interface{}{"a": float64(1)}},
+		{"application/json; charset=utf-8", `["x"]`, 0, []interface{}{"x"}},
+		{"application/vnd.docker+json", `{"b": true}`, 0, map[string]interface{}{"b": true}},
+		{"application/json", `{"a": `, 400, nil},
+		{"application/x-www-form-urlencoded", "status=firing&tag=a&tag=b", 0,
+			map[string]interface{}{"status": "firing", "tag": []interface{}{"a", "b"}}},
+		{"application/x-www-form-urlencoded", "bad=%zz", 400, nil},
+		{"text/plain", "disk full on host1", 0, map[string]interface{}{"text": "disk full on host1"}},
+		{"application/x-www-form-urlencoded", `{"status": "firing"}`, 0, map[string]interface{}{"status": "firing"}},
+		{"application/x-www-form-urlencoded", `[1]`, 0, []interface{}{float64(1)}},
+		{"application/xml", "<a/>", 415, nil},
+		{"application/octet-stream", `{"a": 1}`, 0, map[string]interface{}{"a": float64(1)}},
+		{"not a type;;", `{"a": 1}`, 0, map[string]interface{}{"a": float64(1)}},
+		{"not a type;;", "x", 400, nil},
+		{"text/plain", strings.Repeat("x", 65), 413, nil},
+		{"text/plain", strings.Repeat("x", 64), 0, map[string]interface{}{"text": strings.Repeat("x", 64)}},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest("POST", "http://localhost/v1-webhooks/endpoint", bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			request.Header.Set("Content-Type", test.contentType)
+		}
+		payload, code, err := rh.readPayload(request)
+		if code != test.code || (test.code == 0 && err != nil) {
+			t.Errorf("readPayload(%q, %q) returned code %d (%v), expected %d", test.contentType, test.body, code, err, test.code)
+			continue
+		}
+		if !reflect.DeepEqual(payload, test.payload) {
+			t.Errorf("readPayload(%q, %q) = %#v, expected %#v", test.contentType, test.body, payload, test.payload)
+		}
+	}
+}
+
+func TestExecuteRejectsLargeBody(t *testing.T) {
+	url := fmt.Sprintf("%s/v1-webhooks/endpoint?key=key&projectId=1a1", server.URL)
+	request, err := http.NewRequest("POST", url, bytes.NewBufferString(strings.Repeat("x", defaultMaxBodyBytes+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "text/plain")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 413 {
+		t.Fatalf("StatusCode %d, body above the limit must be rejected", response.Code)
+	}
+}
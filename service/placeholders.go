@@ -0,0 +1,241 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/yaml"
+)
+
+//placeholderPattern matches the placeholders of a receiver template, such as ${service:web/nginx}
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+//placeholderKinds are the placeholders a template may use, and whether they take an argument
+var placeholderKinds = map[string]bool{
+	//projectId is the project the template is instantiated in
+	"projectId": false,
+	//var:name is a variable given to the instantiate action
+	"var": true,
+	//service:stack/name is the ID of the service name of the stack stack
+	"service": true,
+	//serviceSelector:key=value,... is the ID of the one service whose labels match
+	"serviceSelector": true,
+	//hostTemplate:name is the ID of the host template named name
+	"hostTemplate": true,
+}
+
+//parsePlaceholder splits the text between ${ and } into its kind and argument
+func parsePlaceholder(text string) (string, string, error) {
+	parts := strings.SplitN(text, ":", 2)
+	kind, arg := parts[0], ""
+	if len(parts) == 2 {
+		arg = strings.TrimSpace(parts[1])
+	}
+	takesArg, ok := placeholderKinds[kind]
+	if !ok {
+		return "", "", fmt.Errorf("Unknown placeholder ${%s}", text)
+	}
+	if takesArg != (arg != "") {
+		if takesArg {
+			return "", "", fmt.Errorf("Placeholder ${%s} needs an argument, such as ${%s:value}", text, kind)
+		}
+		return "", "", fmt.Errorf("Placeholder ${%s} takes no argument", text)
+	}
+	if kind == "service" && len(strings.Split(arg, "/")) != 2 {
+		return "", "", fmt.Errorf("Placeholder ${%s} must name a service as stack/service", text)
+	}
+	if kind == "serviceSelector" {
+		if _, err := parseSelector(arg); err != nil {
+			return "", "", fmt.Errorf("Placeholder ${%s}: %v", text, err)
+		}
+	}
+	return kind, arg, nil
+}
+
+//parseSelector reads a selector written as key=value,key2=value2
+func parseSelector(text string) (map[string]string, error) {
+	selector := map[string]string{}
+	for _, term := range strings.Split(text, ",") {
+		parts := strings.SplitN(term, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Invalid selector %q, expected key=value,key2=value2", text)
+		}
+		selector[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return selector, nil
+}
+
+//checkPlaceholders makes sure every placeholder of a template definition is well formed
+func checkPlaceholders(value interface{}) error {
+	return walkStrings(value, func(s string) error {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(s, -1) {
+			if _, _, err := parsePlaceholder(match[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func walkStrings(value interface{}, f func(string) error) error {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, f); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//placeholderResolver resolves the placeholders of a template definition in one project
+type placeholderResolver struct {
+	apiClient *client.RancherClient
+	projectID string
+	variables map[string]string
+	resolved  map[string]string
+}
+
+func newPlaceholderResolver(apiClient *client.RancherClient, projectID string, variables map[string]string) *placeholderResolver {
+	return &placeholderResolver{
+		apiClient: apiClient,
+		projectID: projectID,
+		variables: variables,
+		resolved:  map[string]string{},
+	}
+}
+
+//resolve returns a copy of value with its placeholders replaced. A string that is a single ${var:}
+//placeholder takes the variable's YAML type, so variables can set numbers and booleans too.
+func (p *placeholderResolver) resolve(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return p.resolveString(v)
+	case map[string]interface{}:
+		resolved := map[string]interface{}{}
+		for key, item := range v {
+			r, err := p.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := []interface{}{}
+		for _, item := range v {
+			r, err := p.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, r)
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+func (p *placeholderResolver) resolveString(s string) (interface{}, error) {
+	matches := placeholderPattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	result := ""
+	last := 0
+	for _, match := range matches {
+		value, err := p.lookup(s[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 1 && match[0] == 0 && match[1] == len(s) && strings.HasPrefix(s, "${var:") {
+			if typed, err := yaml.Parse([]byte(value)); err == nil && typed != nil {
+				if _, isMap := typed.(map[string]interface{}); !isMap {
+					return typed, nil
+				}
+			}
+		}
+		result += s[last:match[0]] + value
+		last = match[1]
+	}
+	return result + s[last:], nil
+}
+
+func (p *placeholderResolver) lookup(text string) (string, error) {
+	if value, ok := p.resolved[text]; ok {
+		return value, nil
+	}
+	kind, arg, err := parsePlaceholder(text)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch kind {
+	case "projectId":
+		value = p.projectID
+	case "var":
+		var ok bool
+		if value, ok = p.variables[arg]; !ok {
+			return "", fmt.Errorf("Variable %s is not given", arg)
+		}
+	case "service":
+		names := strings.Split(arg, "/")
+		service, err := drivers.FindServiceByName(p.apiClient, names[0], names[1])
+		if err != nil {
+			return "", err
+		}
+		if service == nil {
+			return "", fmt.Errorf("No service %s in project %s", arg, p.projectID)
+		}
+		value = service.Id
+	case "serviceSelector":
+		selector, _ := parseSelector(arg)
+		services, err := drivers.FindServicesBySelector(p.apiClient, selector)
+		if err != nil {
+			return "", err
+		}
+		if len(services) != 1 {
+			ids := []string{}
+			for _, service := range services {
+				ids = append(ids, service.Id)
+			}
+			sort.Strings(ids)
+			return "", fmt.Errorf("Selector %s must match one service in project %s, it matches %d %v", arg,
+				p.projectID, len(services), ids)
+		}
+		value = services[0].Id
+	case "hostTemplate":
+		templates, err := p.apiClient.HostTemplate.List(&client.ListOpts{
+			Filters: map[string]interface{}{"name": arg, "removed_null": true},
+		})
+		if err != nil {
+			return "", errors.Wrap(err, "Error in listing hostTemplates")
+		}
+		for _, template := range templates.Data {
+			if template.Name == arg && template.Removed == "" {
+				value = template.Id
+				break
+			}
+		}
+		if value == "" {
+			return "", fmt.Errorf("No host template %s in project %s", arg, p.projectID)
+		}
+	}
+	p.resolved[text] = value
+	return value, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+func seedMixedKindObjects(mw *mockGenericObject) func() {
+	resourceData := map[string]interface{}{
+		"driver": "scaleService",
+		"url":    "http://localhost/v1-webhooks/endpoint",
+		"config": map[string]interface{}{"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4},
+	}
+	seeded := []*client.GenericObject{
+		{Resource: client.Resource{Id: "1go2"}, Kind: "otherKind", Name: "wh-shared", Key: "foreign-key", ResourceData: resourceData},
+		{Resource: client.Resource{Id: "1go3"}, Kind: "webhookReceiver", Name: "wh-broken", Key: "broken-key", ResourceData: map[string]interface{}{}},
+		{Resource: client.Resource{Id: "1go4"}, Kind: "webhookReceiver", AccountId: "1a9", Name: "wh-other-project", Key: "other-project-key", ResourceData: resourceData},
+	}
+	for _, obj := range seeded {
+		mw.created[obj.Id] = obj
+	}
+	return func() {
+		for _, obj := range seeded {
+			delete(mw.created, obj.Id)
+		}
+	}
+}
+
+func TestReceiverLookupsIgnoreOtherKindsAndProjects(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+	cleanup := seedMixedKindObjects(mw)
+	defer cleanup()
+
+	for _, ignoreFilters := range []bool{false, true} {
+		mw.ignoreFilters = ignoreFilters
+		checkReceiverScoping(t, mw)
+	}
+	mw.ignoreFilters = false
+}
+
+func checkReceiverScoping(t *testing.T, mw *mockGenericObject) {
+	// A GenericObject of another kind must not block the name
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	jsonStr := []byte(`{"driver":"scaleService","name":"wh-shared",
+		"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+	request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d, name used by another kind must not conflict: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+
+	// A receiver that can't be decoded still holds its name
+	jsonStr = []byte(`{"driver":"scaleService","name":"wh-broken",
+		"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+	request, err = http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 400 {
+		t.Fatalf("StatusCode %d, expected conflict with corrupt receiver", response.Code)
+	}
+
+	// Keys of other kinds and other projects can't be executed
+	for _, key := range []string{"foreign-key", "other-project-key"} {
+		executeURL := fmt.Sprintf("%s/v1-webhooks/endpoint?key=%s&projectId=1a1", server.URL, key)
+		request, err = http.NewRequest("POST", executeURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response = httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != 403 {
+			t.Fatalf("StatusCode %d, key %s must not execute", response.Code, key)
+		}
+	}
+
+	// Other kinds and other projects are invisible to get, delete and list
+	for _, id := range []string{"1go2", "1go4"} {
+		byID := fmt.Sprintf("%s/v1-webhooks/receivers/%s?projectId=1a1", server.URL, id)
+		for _, method := range []string{"GET", "DELETE"} {
+			request, err = http.NewRequest(method, byID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response = httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			if response.Code != 404 {
+				t.Fatalf("StatusCode %d, %s of %s should be not found", response.Code, method, id)
+			}
+		}
+		if _, ok := mw.created[id]; !ok {
+			t.Fatalf("Object %s of another kind or project was deleted", id)
+		}
+	}
+
+	request, err = http.NewRequest("GET", constructURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	whCollection := &model.WebhookCollection{}
+	if err := json.Unmarshal(response.Body.Bytes(), whCollection); err != nil {
+		t.Fatal(err)
+	}
+	brokenListed := false
+	for _, listed := range whCollection.Data {
+		if listed.Id == "1go2" || listed.Id == "1go4" {
+			t.Fatalf("Listed object %s that is not a receiver of this project", listed.Id)
+		}
+		if listed.Id == "1go3" {
+			brokenListed = true
+			if listed.State != "error" || listed.Message == "" {
+				t.Fatalf("Broken receiver should be listed in error state with a message: %#v", listed)
+			}
+		}
+	}
+	if !brokenListed {
+		t.Fatalf("Broken receiver was not listed")
+	}
+
+	// Broken receivers can be filtered by state, and pages are bounded by limit
+	request, err = http.NewRequest("GET", constructURL+"&state=error&limit=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	whCollection = &model.WebhookCollection{}
+	if err := json.Unmarshal(response.Body.Bytes(), whCollection); err != nil {
+		t.Fatal(err)
+	}
+	if len(whCollection.Data) != 1 || whCollection.Data[0].Id != "1go3" {
+		t.Fatalf("Expected only the broken receiver, got %#v", whCollection.Data)
+	}
+
+	request, err = http.NewRequest("GET", constructURL+"&limit=0&sort=size", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 400 {
+		t.Fatalf("StatusCode %d, invalid sort should be rejected", response.Code)
+	}
+}
@@ -1,8 +1,9 @@
 package service
 
 import (
-	"crypto/rsa"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -10,6 +11,7 @@ import (
 	v1client "github.com/rancher/go-rancher/client"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
 )
 
 var schemas *v1client.Schemas
@@ -21,14 +23,18 @@ func HandleError(s *v1client.Schemas, t func(http.ResponseWriter, *http.Request)
 			logrus.Errorf("Error in request: %v", err)
 			rw.Header().Add("Content-Type", "application/json")
 			rw.WriteHeader(code)
-			writeErr := apiContext.WriteResource(&model.ServerAPIError{
+			var resource interface{} = &model.ServerAPIError{
 				Resource: v1client.Resource{
 					Type: "error",
 				},
 				Code:    code,
 				Status:  "Server Error",
 				Message: err.Error(),
-			})
+			}
+			if withResult, ok := err.(*errorWithResult); ok {
+				resource = withResult.result
+			}
+			writeErr := apiContext.WriteResource(resource)
 			if writeErr != nil {
 				logrus.Errorf("Failed to write err: %v", err)
 			}
@@ -40,10 +46,38 @@ func HandleError(s *v1client.Schemas, t func(http.ResponseWriter, *http.Request)
 	}))
 }
 
+//errorWithResult fails a request with a resource telling what was done before the error, which
+//is written instead of the error
+type errorWithResult struct {
+	error
+	result interface{}
+}
+
 type RouteHandler struct {
 	ClientFactory RancherClientFactory
-	PrivateKey    *rsa.PrivateKey
-	PublicKey     *rsa.PublicKey
+	Store         store.ReceiverStore
+	Keys          *KeySet
+	//Templates keeps receiver templates, which are disabled when it's nil
+	Templates store.TemplateStore
+	//TemplateProjectID is the project whose members manage receiver templates when there's an
+	//Authorizer
+	TemplateProjectID string
+	//Authorizer checks callers of the management API, which is open to anyone when it's nil
+	Authorizer Authorizer
+	//TokenAudiences restricts the aud claim of minted and executed tokens, any audience is
+	//accepted when empty
+	TokenAudiences []string
+	//TrustedProxies are the peers whose X-Forwarded-For header is believed when checking a
+	//receiver's allowedCIDRs
+	TrustedProxies []*net.IPNet
+	//MaxBodyBytes limits the size of bodies sent to receiver URLs, 1MiB when not set
+	MaxBodyBytes int64
+	//ReadinessCacheTTL is how long /readyz reuses its last result, 2s when not set. Keep it below
+	//the readiness probe's period.
+	ReadinessCacheTTL time.Duration
+
+	readiness readinessCache
+	history   executionHistory
 }
 
 func NewRouter(r *RouteHandler) *mux.Router {
@@ -51,26 +85,55 @@ func NewRouter(r *RouteHandler) *mux.Router {
 	router := mux.NewRouter().StrictSlash(false)
 	f := HandleError
 
+	router.Methods("GET").Path("/healthz").HandlerFunc(r.Healthz)
+	router.Methods("GET").Path("/readyz").HandlerFunc(r.Readyz)
+
 	router.Methods("GET").Path("/v1-webhooks").Handler(VersionHandler(schemas))
 	router.Methods("GET").Path("/v1-webhooks/").Handler(VersionHandler(schemas))
 
+	router.Methods("GET").Path("/v1-webhooks/jwks.json").HandlerFunc(r.JWKS)
+
 	router.Methods("GET").Path("/v1-webhooks/schemas/").Handler(api.SchemasHandler(schemas))
 	router.Methods("GET").Path("/v1-webhooks/schemas").Handler(api.SchemasHandler(schemas))
 
 	router.Methods("GET").Path("/v1-webhooks/schemas/{id}").Handler(api.SchemaHandler(schemas))
 	router.Methods("GET").Path("/v1-webhooks/schemas/{id}/").Handler(api.SchemaHandler(schemas))
 
-	router.Methods("POST").Path("/v1-webhooks/receivers").Handler(f(schemas, r.ConstructPayload))
-	router.Methods("POST").Path("/v1-webhooks/receivers/").Handler(f(schemas, r.ConstructPayload))
+	router.Methods("POST").Path("/v1-webhooks/receivers").Handler(f(schemas, r.authorized(OpCreate, r.ReceiverCollectionAction)))
+	router.Methods("POST").Path("/v1-webhooks/receivers/").Handler(f(schemas, r.authorized(OpCreate, r.ReceiverCollectionAction)))
+
+	router.Methods("GET").Path("/v1-webhooks/receivers").Handler(f(schemas, r.authorized(OpRead, r.ListWebhooks)))
+	router.Methods("GET").Path("/v1-webhooks/receivers/").Handler(f(schemas, r.authorized(OpRead, r.ListWebhooks)))
+
+	router.Methods("GET").Path("/v1-webhooks/receivers/{id}").Handler(f(schemas, r.authorized(OpRead, r.GetWebhook)))
+	router.Methods("GET").Path("/v1-webhooks/receivers/{id}/").Handler(f(schemas, r.authorized(OpRead, r.GetWebhook)))
+
+	router.Methods("GET").Path("/v1-webhooks/receivers/{id}/history").Handler(f(schemas, r.authorized(OpRead, r.ListExecutions)))
+	router.Methods("GET").Path("/v1-webhooks/receivers/{id}/history/").Handler(f(schemas, r.authorized(OpRead, r.ListExecutions)))
+
+	router.Methods("POST").Path("/v1-webhooks/receivers/{id}").Handler(f(schemas, r.authorized(OpCreate, r.ReceiverAction)))
+	router.Methods("POST").Path("/v1-webhooks/receivers/{id}/").Handler(f(schemas, r.authorized(OpCreate, r.ReceiverAction)))
+
+	router.Methods("DELETE").Path("/v1-webhooks/receivers/{id}").Handler(f(schemas, r.authorized(OpDelete, r.DeleteWebhook)))
+	router.Methods("DELETE").Path("/v1-webhooks/receivers/{id}/").Handler(f(schemas, r.authorized(OpDelete, r.DeleteWebhook)))
 
-	router.Methods("GET").Path("/v1-webhooks/receivers").Handler(f(schemas, r.ListWebhooks))
-	router.Methods("GET").Path("/v1-webhooks/receivers/").Handler(f(schemas, r.ListWebhooks))
+	router.Methods("GET").Path("/v1-webhooks/receivertemplates").Handler(f(schemas, r.templateHandler(OpRead, r.ListTemplates)))
+	router.Methods("GET").Path("/v1-webhooks/receivertemplates/").Handler(f(schemas, r.templateHandler(OpRead, r.ListTemplates)))
 
-	router.Methods("GET").Path("/v1-webhooks/receivers/{id}").Handler(f(schemas, r.GetWebhook))
-	router.Methods("GET").Path("/v1-webhooks/receivers/{id}/").Handler(f(schemas, r.GetWebhook))
+	router.Methods("POST").Path("/v1-webhooks/receivertemplates").Handler(f(schemas, r.templateHandler(OpCreate, r.CreateTemplate)))
+	router.Methods("POST").Path("/v1-webhooks/receivertemplates/").Handler(f(schemas, r.templateHandler(OpCreate, r.CreateTemplate)))
 
-	router.Methods("DELETE").Path("/v1-webhooks/receivers/{id}").Handler(f(schemas, r.DeleteWebhook))
-	router.Methods("DELETE").Path("/v1-webhooks/receivers/{id}/").Handler(f(schemas, r.DeleteWebhook))
+	router.Methods("GET").Path("/v1-webhooks/receivertemplates/{id}").Handler(f(schemas, r.templateHandler(OpRead, r.GetTemplate)))
+	router.Methods("GET").Path("/v1-webhooks/receivertemplates/{id}/").Handler(f(schemas, r.templateHandler(OpRead, r.GetTemplate)))
+
+	router.Methods("PUT").Path("/v1-webhooks/receivertemplates/{id}").Handler(f(schemas, r.templateHandler(OpCreate, r.UpdateTemplate)))
+	router.Methods("PUT").Path("/v1-webhooks/receivertemplates/{id}/").Handler(f(schemas, r.templateHandler(OpCreate, r.UpdateTemplate)))
+
+	router.Methods("POST").Path("/v1-webhooks/receivertemplates/{id}").Handler(f(schemas, r.templateHandler("", r.TemplateAction)))
+	router.Methods("POST").Path("/v1-webhooks/receivertemplates/{id}/").Handler(f(schemas, r.templateHandler("", r.TemplateAction)))
+
+	router.Methods("DELETE").Path("/v1-webhooks/receivertemplates/{id}").Handler(f(schemas, r.templateHandler(OpDelete, r.DeleteTemplate)))
+	router.Methods("DELETE").Path("/v1-webhooks/receivertemplates/{id}/").Handler(f(schemas, r.templateHandler(OpDelete, r.DeleteTemplate)))
 
 	router.Methods("POST").Path("/v1-webhooks/endpoint").Handler(f(schemas, r.Execute))
 	router.Methods("POST").Path("/v1-webhooks/endpoint/").Handler(f(schemas, r.Execute))
@@ -84,9 +147,28 @@ func driverSchemas() *v1client.Schemas {
 	webhook.CollectionMethods = []string{"GET", "POST"}
 	webhook.ResourceMethods = []string{"GET", "DELETE"}
 
-	f := webhook.ResourceFields["name"]
-	f.Create = true
-	webhook.ResourceFields["name"] = f
+	webhook.ResourceActions = map[string]v1client.Action{
+		"issueToken": {
+			Input:  "issueTokenInput",
+			Output: "issuedToken",
+		},
+	}
+	webhook.CollectionActions = map[string]v1client.Action{
+		"import": {
+			Input:  "receiverImport",
+			Output: "receiverImportResult",
+		},
+	}
+
+	for _, name := range []string{"name", "useToken", "tokenTtlSeconds", "tokenAudience", "allowedCIDRs",
+		"condition", "transform", "overrides"} {
+		f := webhook.ResourceFields[name]
+		f.Create = true
+		webhook.ResourceFields[name] = f
+	}
+	overrides := webhook.ResourceFields["overrides"]
+	overrides.Type = "map[overrideBounds]"
+	webhook.ResourceFields["overrides"] = overrides
 
 	driverOptions := []string{}
 	for key, value := range drivers.Drivers {
@@ -112,7 +194,7 @@ func driverSchemas() *v1client.Schemas {
 		}
 	}
 
-	f = webhook.ResourceFields["driver"]
+	f := webhook.ResourceFields["driver"]
 	f.Create = true
 	f.Type = "enum"
 	f.Options = driverOptions
@@ -121,6 +203,72 @@ func driverSchemas() *v1client.Schemas {
 	schemas.AddType("apiVersion", v1client.Resource{})
 	schemas.AddType("schema", v1client.Schema{})
 	schemas.AddType("error", model.ServerAPIError{})
+	schemas.AddType("issueTokenInput", model.IssueTokenInput{})
+	schemas.AddType("issuedToken", model.IssuedToken{})
+	template := schemas.AddType("receiverTemplate", model.ReceiverTemplate{})
+	template.CollectionMethods = []string{"GET", "POST"}
+	template.ResourceMethods = []string{"GET", "PUT", "DELETE"}
+	template.ResourceActions = map[string]v1client.Action{
+		"instantiate": {
+			Input:  "instantiateInput",
+			Output: "receiver",
+		},
+		"propagate": {
+			Input:  "propagateInput",
+			Output: "templatePropagation",
+		},
+	}
+	for _, name := range []string{"name", "description", "definition"} {
+		f := template.ResourceFields[name]
+		f.Create = true
+		f.Update = true
+		template.ResourceFields[name] = f
+	}
+	definition := template.ResourceFields["definition"]
+	definition.Type = "map[json]"
+	template.ResourceFields["definition"] = definition
+	instantiateInput := schemas.AddType("instantiateInput", model.InstantiateInput{})
+	instantiateInput.CollectionMethods = []string{}
+	propagateInput := schemas.AddType("propagateInput", model.PropagateInput{})
+	propagateInput.CollectionMethods = []string{}
+	propagation := schemas.AddType("templatePropagation", model.TemplatePropagation{})
+	propagation.CollectionMethods = []string{}
+	propagationChanges := propagation.ResourceFields["changes"]
+	propagationChanges.Type = "array[receiverChange]"
+	propagation.ResourceFields["changes"] = propagationChanges
+
+	receiverImport := schemas.AddType("receiverImport", model.ReceiverImport{})
+	receiverImport.CollectionMethods = []string{}
+	importReceivers := receiverImport.ResourceFields["receivers"]
+	importReceivers.Type = "array[receiver]"
+	importReceivers.Description = "Changes are applied one receiver at a time, the import isn't atomic. When one fails, " +
+		"the import stops and the changes applied before it are kept and reported with the failed one."
+	receiverImport.ResourceFields["receivers"] = importReceivers
+	importResult := schemas.AddType("receiverImportResult", model.ReceiverImportResult{})
+	importResult.CollectionMethods = []string{}
+	importChanges := importResult.ResourceFields["changes"]
+	importChanges.Type = "array[receiverChange]"
+	importResult.ResourceFields["changes"] = importChanges
+	receiverChange := schemas.AddType("receiverChange", model.ReceiverChange{})
+	receiverChange.CollectionMethods = []string{}
+	overrideBounds := schemas.AddType("overrideBounds", model.OverrideBounds{})
+	overrideBounds.CollectionMethods = []string{}
+	hostTemplateWeight := schemas.AddType("hostTemplateWeight", model.HostTemplateWeight{})
+	hostTemplateWeight.CollectionMethods = []string{}
+	scaleServiceTarget := schemas.AddType("scaleServiceTarget", model.ScaleServiceTarget{})
+	scaleServiceTarget.CollectionMethods = []string{}
+	execution := schemas.AddType("execution", model.Execution{})
+	execution.CollectionMethods = []string{"GET"}
+	hosts := execution.ResourceFields["hosts"]
+	hosts.Type = "array[hostProgress]"
+	execution.ResourceFields["hosts"] = hosts
+	hostProgress := schemas.AddType("hostProgress", model.HostProgress{})
+	hostProgress.CollectionMethods = []string{}
+	services := execution.ResourceFields["services"]
+	services.Type = "array[serviceResult]"
+	execution.ResourceFields["services"] = services
+	serviceResult := schemas.AddType("serviceResult", model.ServiceResult{})
+	serviceResult.CollectionMethods = []string{}
 
 	return schemas
 }
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/expr"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+)
+
+//validateReceiverRules checks that a receiver's condition and transform expressions parse
+func validateReceiverRules(condition string, transform map[string]string) error {
+	if condition != "" {
+		if _, err := expr.Parse(condition); err != nil {
+			return fmt.Errorf("Invalid condition: %v", err)
+		}
+	}
+	for field, source := range transform {
+		if field == "" {
+			return fmt.Errorf("Invalid transform, config field name is empty")
+		}
+		if _, err := expr.Parse(source); err != nil {
+			return fmt.Errorf("Invalid transform for %s: %v", field, err)
+		}
+	}
+	return nil
+}
+
+//applyReceiverRules evaluates the receiver's condition against the request body and returns the
+//driver config with the receiver's transform, then its bounded overrides, applied. skipped is true
+//when the condition is not met. A transform expression that finds nothing in the body leaves its
+//config field as configured.
+func applyReceiverRules(receiver *store.Receiver, config interface{}, requestBody interface{}) (interface{}, bool, error) {
+	if receiver.Condition != "" {
+		condition, err := expr.Parse(receiver.Condition)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid condition: %v", err)
+		}
+		matched, err := condition.Match(requestBody)
+		if err != nil {
+			return nil, false, fmt.Errorf("Error evaluating condition: %v", err)
+		}
+		if !matched {
+			return nil, true, nil
+		}
+	}
+
+	if len(receiver.Transform) == 0 && len(receiver.Overrides) == 0 {
+		return config, false, nil
+	}
+
+	overridden, err := configMap(config)
+	if err != nil {
+		return nil, false, err
+	}
+	for field, source := range receiver.Transform {
+		e, err := expr.Parse(source)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid transform for %s: %v", field, err)
+		}
+		value, err := e.Evaluate(requestBody)
+		if err != nil {
+			return nil, false, fmt.Errorf("Error evaluating transform for %s: %v", field, err)
+		}
+		if value != nil {
+			overridden[field] = value
+		}
+	}
+	if err := applyOverrides(receiver.Overrides, overridden, requestBody); err != nil {
+		return nil, false, err
+	}
+	return overridden, false, nil
+}
+
+//validateRewrittenConfig runs the driver's full validation again on a config that transforms or
+//overrides rewrote. They may point the receiver at another service or template, which has to pass
+//the same checks as the one it was created with.
+func validateRewrittenConfig(driverName string, driver drivers.WebhookDriver, config interface{},
+	apiClient *client.RancherClient) (int, error) {
+	wh := &model.Webhook{Driver: driverName}
+	if err := driver.ConvertToConfigAndSetOnWebhook(config, wh); err != nil {
+		return 400, fmt.Errorf("Bad driver config: %v", err)
+	}
+	return driver.ValidatePayload(getDriverConfig(wh), apiClient)
+}
+
+//configMap copies a driver config, which may be the driver's config struct or its decoded JSON,
+//into a map keyed by JSON field name
+func configMap(config interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("Bad driver config: %v", err)
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Bad driver config: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+)
+
+func TestConditionAndTransform(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	create := func(rules string) *httptest.ResponseRecorder {
+		jsonStr := []byte(`{"driver":"scaleService","name":"wh-rules",` + rules + `,
+			"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+		request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := create(`"condition": "status =="`); response.Code != 400 {
+		t.Fatalf("StatusCode %d, invalid condition must be rejected", response.Code)
+	}
+	if response := create(`"transform": {"amount": "labels."}`); response.Code != 400 {
+		t.Fatalf("StatusCode %d, invalid transform must be rejected", response.Code)
+	}
+
+	response := create(`"condition": "status == \"firing\" && labels.severity == \"critical\"",
+		"transform": {"amount": "labels.amount"}`)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d creating webhook with rules: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+	if wh.Condition == "" || wh.Transform["amount"] != "labels.amount" {
+		t.Fatalf("Rules missing from webhook: %#v", wh)
+	}
+
+	// The mock driver fails unless amount is 1, which shows whether the transform was applied
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"status": "firing", "labels": {"severity": "critical"}}`, 200},
+		{`{"status": "firing", "labels": {"severity": "critical", "amount": 1}}`, 200},
+		{`{"status": "firing", "labels": {"severity": "critical", "amount": 2}}`, 500},
+		{`{"status": "firing", "labels": {"severity": "warning"}}`, 202},
+		{`{"status": "resolved"}`, 202},
+		{``, 202},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest("POST", wh.URL, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != test.code {
+			t.Errorf("StatusCode %d executing with %s, expected %d", response.Code, test.body, test.code)
+		}
+	}
+
+	records := r.history.list("1a1", wh.Id)
+	if last := records[len(records)-1]; last.Code != 202 || last.Message == "" {
+		t.Fatalf("Skipped call not recorded: %#v", last)
+	}
+}
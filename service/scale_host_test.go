@@ -482,6 +482,59 @@ func TestWebhookCreateInvalidMinMaxActionScaleHost(t *testing.T) {
 	}
 }
 
+func TestHostProgressInHistory(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	jsonStr := []byte(`{"driver": "scaleHost", "name": "wh-progress",
+	"scaleHostConfig": {"action": "up", "amount": 1, "hostTemplateId": "1ht1", "min": 1, "max": 4, "deleteOption": "mostRecent"}}`)
+	request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d creating webhook: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+
+	request, err = http.NewRequest("POST", wh.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d executing webhook: %s", response.Code, response.Body.String())
+	}
+
+	historyURL := fmt.Sprintf("%s/v1-webhooks/receivers/%s/history?projectId=1a1", server.URL, wh.Id)
+	request, err = http.NewRequest("GET", historyURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	history := &model.ExecutionCollection{}
+	if err := json.Unmarshal(response.Body.Bytes(), history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Data) == 0 {
+		t.Fatalf("No executions recorded: %s", response.Body.String())
+	}
+	latest := history.Data[0]
+	if latest.Code != 200 || len(latest.Hosts) != 1 || latest.Hosts[0].HostID != "1h1" ||
+		latest.Hosts[0].State != drivers.HostDeleted {
+		t.Fatalf("Host progress missing from execution: %#v", latest)
+	}
+}
+
 type MockHostDriver struct {
 	expectedConfigLabel        model.ScaleHost
 	expectedConfigHostTemplate model.ScaleHost
@@ -527,6 +580,15 @@ func (s *MockHostDriver) Execute(conf interface{}, apiClient *client.RancherClie
 	return 0, nil
 }
 
+func (s *MockHostDriver) ExecuteWithProgress(conf interface{}, apiClient *client.RancherClient, reqbody interface{},
+	progress drivers.HostProgressFunc) (int, error) {
+	code, err := s.Execute(conf, apiClient, reqbody)
+	if err == nil {
+		progress(model.HostProgress{HostID: "1h1", Hostname: "scaledhost2", State: drivers.HostDeleted})
+	}
+	return code, err
+}
+
 func (s *MockHostDriver) ValidatePayload(conf interface{}, apiClient *client.RancherClient) (int, error) {
 	config, ok := conf.(model.ScaleHost)
 	if !ok {
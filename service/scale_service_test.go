@@ -16,6 +16,8 @@ import (
 	"github.com/rancher/go-rancher/v2"
 	"github.com/rancher/webhook-service/drivers"
 	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+	"github.com/rancher/webhook-service/testutils"
 )
 
 func TestWebhookCreateAndExecuteScaleService(t *testing.T) {
@@ -336,3 +338,61 @@ func (s *MockServiceDriver) ConvertToConfigAndSetOnWebhook(conf interface{}, web
 	ss := &drivers.ScaleServiceDriver{}
 	return ss.ConvertToConfigAndSetOnWebhook(conf, webhook)
 }
+
+func TestResolveScaleServiceTarget(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	stackID := cattle.Add("1a1", "stack", map[string]interface{}{"name": "web"})
+	serviceID := cattle.Add("1a1", "service", map[string]interface{}{"kind": "service", "name": "nginx", "stackId": stackID})
+	apiClient, err := cattle.GetClient("1a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := &RouteHandler{ClientFactory: cattle}
+	driver := &drivers.ScaleServiceDriver{}
+
+	config := map[string]interface{}{"stackName": "web", "serviceName": "nginx", "action": "up", "amount": 1, "min": 1, "max": 4}
+	wh := &model.Webhook{Driver: "scaleService"}
+	rh.resolveTarget(wh, driver, config, apiClient, "1a1")
+	if wh.ScaleServiceConfig.ResolvedServiceID != serviceID || wh.ScaleServiceConfig.StackName != "web" || len(wh.Warnings) != 0 {
+		t.Fatalf("Unexpected resolution %#v", wh)
+	}
+
+	config["serviceName"] = "redis"
+	wh = &model.Webhook{Driver: "scaleService"}
+	rh.resolveTarget(wh, driver, config, apiClient, "1a1")
+	if wh.ScaleServiceConfig.ResolvedServiceID != "" || len(wh.Warnings) != 1 || !strings.Contains(wh.Warnings[0], "web/redis") {
+		t.Fatalf("Expected a warning for a missing service, got %#v", wh)
+	}
+
+	cattle.Fail("stack", "list", http.StatusInternalServerError)
+	wh = &model.Webhook{Driver: "scaleService"}
+	rh.resolveTarget(wh, driver, config, apiClient, "1a1")
+	if len(wh.Warnings) != 1 || !strings.Contains(wh.Warnings[0], "Unable to resolve") {
+		t.Fatalf("Expected failing to resolve to be a warning, got %#v", wh)
+	}
+}
+
+func TestScaleServiceResultsRecorded(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	frontendID := cattle.Add("1a1", "service", map[string]interface{}{"kind": "service", "scale": 1})
+	workersID := cattle.Add("1a1", "service", map[string]interface{}{"kind": "service", "scale": 1})
+	apiClient, err := cattle.GetClient("1a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh := &RouteHandler{ClientFactory: cattle}
+	receiver := &store.Receiver{ProjectID: "1a1", ID: "1", Driver: "scaleService"}
+	config := map[string]interface{}{"action": "up", "amount": 1, "min": 1, "max": 4,
+		"targets": []interface{}{map[string]interface{}{"serviceId": frontendID}, map[string]interface{}{"serviceId": workersID}}}
+
+	if code, err := rh.executeReceiver(receiver, &drivers.ScaleServiceDriver{}, config, apiClient, nil, nil); err != nil {
+		t.Fatalf("Unexpected failure %d: %v", code, err)
+	}
+	executions := rh.history.list("1a1", "1")
+	if len(executions) != 1 || len(executions[0].Services) != 2 || executions[0].Services[1].ServiceID != workersID ||
+		executions[0].Services[1].State != "scaled" || executions[0].Services[1].Scale != 2 {
+		t.Fatalf("Unexpected executions %#v", executions)
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/webhook-service/drivers"
+)
+
+const certReloadInterval = 30 * time.Second
+
+type ServerOpts struct {
+	ListenAddress   string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+//ListenAndServe serves handler until SIGTERM or SIGINT is received. It then stops accepting
+//connections, drains in-flight requests and waits for background driver work, all bounded by
+//ShutdownTimeout.
+func ListenAndServe(handler http.Handler, opts ServerOpts) error {
+	server := &http.Server{
+		Addr:         opts.ListenAddress,
+		Handler:      handler,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	useTLS := opts.TLSCertFile != "" || opts.TLSKeyFile != ""
+	if useTLS {
+		tlsConfig, err := newTLSConfig(opts, stop)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	} else if opts.TLSClientCAFile != "" {
+		return fmt.Errorf("tls-client-ca-file requires tls-cert-file and tls-key-file")
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			logrus.Infof("Webhook service listening on %s (TLS)", opts.ListenAddress)
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			logrus.Infof("Webhook service listening on %s", opts.ListenAddress)
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-signals:
+		logrus.Infof("Received %v, shutting down", sig)
+	}
+
+	deadline := time.Now().Add(opts.ShutdownTimeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.Errorf("Error draining HTTP requests: %v", err)
+	}
+
+	if !drivers.WaitForBackgroundWork(time.Until(deadline)) {
+		return fmt.Errorf("Timed out waiting for background driver work to finish")
+	}
+	logrus.Infof("Shutdown complete")
+	return nil
+}
+
+func newTLSConfig(opts ServerOpts, stop <-chan struct{}) (*tls.Config, error) {
+	if opts.TLSCertFile == "" || opts.TLSKeyFile == "" {
+		return nil, fmt.Errorf("Both tls-cert-file and tls-key-file must be provided")
+	}
+
+	reloader, err := newCertReloader(opts.TLSCertFile, opts.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.watch(certReloadInterval, stop)
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if opts.TLSClientCAFile != "" {
+		caBytes, err := ioutil.ReadFile(opts.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading client CA file %s: %v", opts.TLSClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("No certificates found in client CA file %s", opts.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+//certReloader serves the current certificate and swaps it when the cert or key file changes on disk
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *certReloader) reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("Error loading TLS key pair: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			modTime, err := c.latestModTime()
+			if err != nil {
+				logrus.Errorf("Error checking TLS certificate files: %v", err)
+				continue
+			}
+
+			c.mu.RLock()
+			changed := modTime.After(c.modTime)
+			c.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := c.reload(); err != nil {
+				logrus.Errorf("Keeping previous TLS certificate, reload failed: %v", err)
+				continue
+			}
+			logrus.Infof("Reloaded TLS certificate from %s", c.certFile)
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
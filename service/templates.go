@@ -0,0 +1,443 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/api"
+	v1client "github.com/rancher/go-rancher/client"
+	"github.com/rancher/webhook-service/drivers"
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+)
+
+//templateOrigin is the template a receiver is instantiated from, and the values of its variables
+type templateOrigin struct {
+	template  *store.Template
+	variables map[string]string
+}
+
+//templateHandler wraps a receiver template handler. Templates belong to no project, so with an
+//Authorizer they're managed by whoever may perform op on the receivers of TemplateProjectID. An
+//empty op leaves authorization to the handler.
+func (rh *RouteHandler) templateHandler(op string, handler func(http.ResponseWriter, *http.Request) (int, error)) func(http.ResponseWriter, *http.Request) (int, error) {
+	return func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if rh.Templates == nil {
+			return 404, fmt.Errorf("Receiver templates are not enabled")
+		}
+		if op != "" {
+			if code, err := rh.authorizeTemplates(r, op); err != nil {
+				return code, err
+			}
+		}
+		return handler(w, r)
+	}
+}
+
+func (rh *RouteHandler) authorizeTemplates(r *http.Request, op string) (int, error) {
+	if rh.Authorizer == nil {
+		return 0, nil
+	}
+	if rh.TemplateProjectID == "" {
+		return 403, fmt.Errorf("Receiver templates can only be managed once a template project is configured")
+	}
+	return rh.Authorizer.Authorize(r, rh.TemplateProjectID, op)
+}
+
+func (rh *RouteHandler) ListTemplates(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	templates, err := rh.Templates.ListTemplates()
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+	data := []model.ReceiverTemplate{}
+	for _, template := range templates {
+		data = append(data, *newReceiverTemplate(apiContext, template))
+	}
+	apiContext.Write(&model.ReceiverTemplateCollection{
+		Collection: v1client.Collection{
+			ResourceType: "receiverTemplate",
+			Links:        map[string]string{"self": apiContext.UrlBuilder.Current()},
+		},
+		Data: data,
+	})
+	return 200, nil
+}
+
+func (rh *RouteHandler) GetTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	template, err := rh.Templates.GetTemplate(mux.Vars(r)["id"])
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+	apiContext.WriteResource(newReceiverTemplate(apiContext, template))
+	return 200, nil
+}
+
+func (rh *RouteHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	input := &model.ReceiverTemplate{}
+	if code, err := readJSON(r, input); err != nil {
+		return code, err
+	}
+	if err := validateTemplate(input); err != nil {
+		return 400, err
+	}
+
+	template, err := rh.Templates.CreateTemplate(&store.Template{
+		Name:        input.Name,
+		Description: input.Description,
+		Definition:  input.Definition,
+		Version:     1,
+	})
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+	apiContext.WriteResource(newReceiverTemplate(apiContext, template))
+	return 200, nil
+}
+
+//UpdateTemplate changes a template. A changed definition gets a new version, and reaches the
+//receivers instantiated from the template when it's propagated.
+func (rh *RouteHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	template, err := rh.Templates.GetTemplate(mux.Vars(r)["id"])
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+
+	input := &model.ReceiverTemplate{}
+	if code, err := readJSON(r, input); err != nil {
+		return code, err
+	}
+	if input.Name == "" {
+		input.Name = template.Name
+	}
+	if input.Description == "" {
+		input.Description = template.Description
+	}
+	if input.Definition == nil {
+		input.Definition = template.Definition
+	}
+	if err := validateTemplate(input); err != nil {
+		return 400, err
+	}
+
+	current, err := jsonValue(template.Definition)
+	if err != nil {
+		return 500, err
+	}
+	updated, err := jsonValue(input.Definition)
+	if err != nil {
+		return 400, err
+	}
+	if !reflect.DeepEqual(current, updated) {
+		template.Version++
+	}
+	template.Name = input.Name
+	template.Description = input.Description
+	template.Definition = input.Definition
+
+	template, err = rh.Templates.UpdateTemplate(template)
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+	apiContext.WriteResource(newReceiverTemplate(apiContext, template))
+	return 200, nil
+}
+
+//DeleteTemplate deletes a template. Its instances are kept as receivers of their own.
+func (rh *RouteHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	if err := rh.Templates.DeleteTemplate(mux.Vars(r)["id"]); err != nil {
+		return storeErrorCode(err), err
+	}
+	return 204, nil
+}
+
+//TemplateAction dispatches POST requests on a receiver template by their action query parameter
+func (rh *RouteHandler) TemplateAction(w http.ResponseWriter, r *http.Request) (int, error) {
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "instantiate":
+		return rh.InstantiateTemplate(w, r)
+	case "propagate":
+		if code, err := rh.authorizeTemplates(r, OpCreate); err != nil {
+			return code, err
+		}
+		return rh.PropagateTemplate(w, r)
+	}
+	return 404, fmt.Errorf("Invalid action %v", action)
+}
+
+//InstantiateTemplate creates a receiver from a template in a project. Any caller allowed to create
+//receivers in the project may instantiate templates there.
+func (rh *RouteHandler) InstantiateTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	input := &model.InstantiateInput{}
+	if code, err := readJSON(r, input); err != nil {
+		return code, err
+	}
+	if input.ProjectID == "" {
+		return 400, fmt.Errorf("projectId not provided")
+	}
+	projectID := input.ProjectID
+	if rh.Authorizer != nil {
+		if code, err := rh.Authorizer.Authorize(r, projectID, OpCreate); err != nil {
+			return code, err
+		}
+	}
+
+	template, err := rh.Templates.GetTemplate(mux.Vars(r)["id"])
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+	instance, err := rh.templateInstance(template, projectID)
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return 500, err
+	}
+	if instance != nil {
+		return 400, fmt.Errorf("Template %s is already instantiated in project %s as receiver %s", template.Name,
+			projectID, instance.ID)
+	}
+
+	apiClient, err := rh.ClientFactory.GetClient(projectID)
+	if err != nil {
+		return 500, err
+	}
+	wh, err := resolveTemplate(template, newPlaceholderResolver(apiClient, projectID, input.Variables))
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return 400, err
+	}
+	driver, driverConfig, err := checkReceiverDefinition(wh)
+	if err != nil {
+		return 400, err
+	}
+	if code, err := rh.isUniqueName(wh.Name, projectID); err != nil {
+		return code, err
+	}
+	if code, err := driver.ValidatePayload(driverConfig, apiClient); err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return code, err
+	}
+
+	//the project is recorded first, so a propagation finds the instance or reports it missing
+	if !contains(template.Projects, projectID) {
+		template.Projects = append(template.Projects, projectID)
+		if template, err = rh.Templates.UpdateTemplate(template); err != nil {
+			return storeErrorCode(err), err
+		}
+	}
+	receiver, code, err := rh.createReceiver(apiContext, wh, projectID, driverConfig,
+		&templateOrigin{template: template, variables: input.Variables})
+	if err != nil {
+		return code, err
+	}
+
+	apiContext.WriteResource(newWebhookFromReceiver(apiContext, receiver, withProjectID(r, projectID)))
+	return 200, nil
+}
+
+//PropagateTemplate brings the instances of a template up to date with its definition, resolving its
+//placeholders again in each project. Projects are updated independently, one failing doesn't stop
+//the others. Projects whose instance was deleted are forgotten. Managing templates doesn't give the
+//caller access to the projects they're instantiated in, so projects where the caller may not
+//create receivers are skipped and reported.
+func (rh *RouteHandler) PropagateTemplate(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	input := &model.PropagateInput{}
+	if code, err := readJSON(r, input); err != nil {
+		return code, err
+	}
+	template, err := rh.Templates.GetTemplate(mux.Vars(r)["id"])
+	if err != nil {
+		return storeErrorCode(err), err
+	}
+
+	result := &model.TemplatePropagation{
+		Resource: v1client.Resource{
+			Type: "templatePropagation",
+		},
+		Version: template.Version,
+		DryRun:  input.DryRun,
+		Changes: []model.ReceiverChange{},
+	}
+	projects := []string{}
+	for _, projectID := range template.Projects {
+		if rh.Authorizer != nil {
+			if _, err := rh.Authorizer.Authorize(r, projectID, OpCreate); err != nil {
+				projects = append(projects, projectID)
+				result.Changes = append(result.Changes, model.ReceiverChange{ProjectID: projectID, Action: "skipped",
+					Message: err.Error()})
+				continue
+			}
+		}
+		change := rh.propagateTemplate(template, projectID, input.DryRun)
+		if change.Action != "missing" {
+			projects = append(projects, projectID)
+		}
+		result.Changes = append(result.Changes, change)
+	}
+
+	if !input.DryRun && len(projects) != len(template.Projects) {
+		template.Projects = projects
+		if _, err := rh.Templates.UpdateTemplate(template); err != nil {
+			return storeErrorCode(err), err
+		}
+	}
+	apiContext.WriteResource(result)
+	return 200, nil
+}
+
+func (rh *RouteHandler) propagateTemplate(template *store.Template, projectID string, dryRun bool) model.ReceiverChange {
+	change := model.ReceiverChange{ProjectID: projectID, Action: "failed"}
+	instance, err := rh.templateInstance(template, projectID)
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		change.Message = err.Error()
+		return change
+	}
+	if instance == nil {
+		change.Action = "missing"
+		change.Message = "The receiver instantiated from the template was deleted"
+		return change
+	}
+	change.Name, change.ID = instance.Name, instance.ID
+
+	apiClient, err := rh.ClientFactory.GetClient(projectID)
+	if err != nil {
+		change.Message = err.Error()
+		return change
+	}
+	wh, err := resolveTemplate(template, newPlaceholderResolver(apiClient, projectID, instance.TemplateVariables))
+	if err == nil {
+		var driver drivers.WebhookDriver
+		var driverConfig interface{}
+		driver, driverConfig, err = checkReceiverDefinition(wh)
+		if err == nil {
+			_, err = driver.ValidatePayload(driverConfig, apiClient)
+		}
+		if err == nil {
+			change.Fields, err = changedFields(instance, wh)
+		}
+		if err == nil && (len(change.Fields) > 0 || instance.TemplateVersion != template.Version) {
+			change.Action = "update"
+			if !dryRun {
+				instance.TemplateVersion = template.Version
+				_, err = rh.updateReceiver(instance, wh, driverConfig)
+			}
+		} else if err == nil {
+			change.Action = "unchanged"
+		}
+	}
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		change.Action = "failed"
+		change.Message = err.Error()
+	}
+	return change
+}
+
+//templateInstance returns the receiver instantiated from a template in a project, or nil
+func (rh *RouteHandler) templateInstance(template *store.Template, projectID string) (*store.Receiver, error) {
+	receivers, err := store.ListAll(rh.Store, projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, receiver := range receivers {
+		if receiver.TemplateID == template.ID {
+			return receiver, nil
+		}
+	}
+	return nil, nil
+}
+
+//validateTemplate checks what can be checked of a template without a project to resolve it in
+func validateTemplate(template *model.ReceiverTemplate) error {
+	if template.Name == "" {
+		return fmt.Errorf("Name not provided")
+	}
+	if template.Definition == nil {
+		return fmt.Errorf("Definition not provided")
+	}
+	if name, _ := template.Definition["name"].(string); name == "" {
+		return fmt.Errorf("The definition has no receiver name")
+	}
+	driver, _ := template.Definition["driver"].(string)
+	if drivers.GetDriver(driver) == nil {
+		return fmt.Errorf("Invalid driver %v in the definition", template.Definition["driver"])
+	}
+	return checkPlaceholders(template.Definition)
+}
+
+//resolveTemplate turns a template into a receiver definition of one project
+func resolveTemplate(template *store.Template, resolver *placeholderResolver) (*model.Webhook, error) {
+	resolved, err := resolver.resolve(template.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("Can't resolve template %s in project %s: %v", template.Name, resolver.projectID, err)
+	}
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return nil, err
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(data, wh); err != nil {
+		return nil, fmt.Errorf("Template %s doesn't resolve to a receiver in project %s: %v", template.Name,
+			resolver.projectID, err)
+	}
+	return wh, nil
+}
+
+func newReceiverTemplate(context *api.ApiContext, template *store.Template) *model.ReceiverTemplate {
+	created := ""
+	if !template.Created.IsZero() {
+		created = template.Created.UTC().Format(time.RFC3339)
+	}
+	return &model.ReceiverTemplate{
+		Resource: v1client.Resource{
+			Id:    template.ID,
+			Type:  "receiverTemplate",
+			Links: map[string]string{"self": context.UrlBuilder.ReferenceByIdLink("receiverTemplate", template.ID)},
+		},
+		Name:        template.Name,
+		Description: template.Description,
+		Definition:  template.Definition,
+		Version:     template.Version,
+		Projects:    template.Projects,
+		Created:     created,
+	}
+}
+
+//readJSON decodes a JSON request body into v, an empty body leaves v as is
+func readJSON(r *http.Request, v interface{}) (int, error) {
+	requestBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 500, err
+	}
+	if len(requestBytes) == 0 {
+		return 0, nil
+	}
+	if err := json.Unmarshal(requestBytes, v); err != nil {
+		return 400, errors.Wrap(err, "Bad request body")
+	}
+	return 0, nil
+}
+
+//withProjectID returns a copy of r with the projectId query parameter set, for building the links of
+//receivers of a project the request didn't name in its URL
+func withProjectID(r *http.Request, projectID string) *http.Request {
+	u := *r.URL
+	query := u.Query()
+	query.Set("projectId", projectID)
+	u.RawQuery = query.Encode()
+	copied := *r
+	copied.URL = &u
+	return &copied
+}
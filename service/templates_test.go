@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rancher/webhook-service/model"
+	"github.com/rancher/webhook-service/store"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func TestReceiverTemplates(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	receivers := store.NewMemoryStore()
+	rh := &RouteHandler{
+		ClientFactory: cattle,
+		Store:         receivers,
+		Templates:     receivers,
+		Keys:          r.Keys,
+	}
+	router := NewRouter(rh)
+
+	call := func(method string, path string, body interface{}, result interface{}) (int, string) {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request, err := http.NewRequest(method, "http://localhost/v1-webhooks"+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if result != nil {
+			json.Unmarshal(response.Body.Bytes(), result)
+		}
+		return response.Code, response.Body.String()
+	}
+
+	definition := map[string]interface{}{
+		"name":   "autoscale-${projectId}",
+		"driver": "scaleService",
+		"scaleServiceConfig": map[string]interface{}{
+			"serviceId": "${var:service}", "action": "up", "amount": "${var:amount}", "min": 1, "max": 4,
+		},
+	}
+	template := &model.ReceiverTemplate{}
+	code, body := call("POST", "/receivertemplates", map[string]interface{}{"name": "autoscaler", "definition": definition}, template)
+	if code != 200 || template.Id == "" || template.Version != 1 {
+		t.Fatalf("Unexpected template %d %s", code, body)
+	}
+	if code, body := call("POST", "/receivertemplates", map[string]interface{}{"name": "bad",
+		"definition": map[string]interface{}{"name": "${bogus}", "driver": "scaleService"}}, nil); code != 400 ||
+		!strings.Contains(body, "Unknown placeholder") {
+		t.Fatalf("Expected an unknown placeholder to be rejected, got %d %s", code, body)
+	}
+
+	variables := map[string]string{"service": "id", "amount": "1"}
+	instantiate := "/receivertemplates/" + template.Id + "?action=instantiate"
+	for _, projectID := range []string{"1a1", "1a2"} {
+		wh := &model.Webhook{}
+		code, body := call("POST", instantiate, model.InstantiateInput{ProjectID: projectID, Variables: variables}, wh)
+		if code != 200 || wh.Name != "autoscale-"+projectID || wh.TemplateID != template.Id || wh.TemplateVersion != 1 ||
+			wh.ScaleServiceConfig.ScaleChange != 1 || !strings.HasSuffix(wh.Links["self"], "?projectId="+projectID) {
+			t.Fatalf("Unexpected instance %d %s", code, body)
+		}
+	}
+	if code, body := call("POST", instantiate, model.InstantiateInput{ProjectID: "1a1", Variables: variables}, nil); code != 400 ||
+		!strings.Contains(body, "already instantiated") {
+		t.Fatalf("Expected a second instance in a project to be rejected, got %d %s", code, body)
+	}
+	if code, body := call("POST", instantiate, model.InstantiateInput{ProjectID: "1a3",
+		Variables: map[string]string{"service": "id"}}, nil); code != 400 || !strings.Contains(body, "Variable amount is not given") {
+		t.Fatalf("Expected a missing variable to be rejected, got %d %s", code, body)
+	}
+
+	instance, err := receivers.GetByName("1a1", "autoscale-1a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := receivers.GetByName("1a2", "autoscale-1a2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receivers.Delete("1a2", removed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	definition["condition"] = "body.status == 'firing'"
+	code, body = call("PUT", "/receivertemplates/"+template.Id, map[string]interface{}{"definition": definition}, template)
+	if code != 200 || template.Version != 2 || template.Name != "autoscaler" {
+		t.Fatalf("Unexpected update %d %s", code, body)
+	}
+
+	propagation := &model.TemplatePropagation{}
+	code, body = call("POST", "/receivertemplates/"+template.Id+"?action=propagate", nil, propagation)
+	if code != 200 || len(propagation.Changes) != 2 || propagation.Changes[0].Action != "update" ||
+		strings.Join(propagation.Changes[0].Fields, ",") != "condition" || propagation.Changes[1].Action != "missing" {
+		t.Fatalf("Unexpected propagation %d %s", code, body)
+	}
+	updated, err := receivers.Get("1a1", instance.ID)
+	if err != nil || updated.Key != instance.Key || updated.TemplateVersion != 2 || updated.Condition == "" {
+		t.Fatalf("Instance not updated in place: %#v %v", updated, err)
+	}
+	if stored, err := receivers.GetTemplate(template.Id); err != nil || strings.Join(stored.Projects, ",") != "1a1" {
+		t.Fatalf("Expected the project of the deleted instance to be forgotten: %#v %v", stored, err)
+	}
+
+	code, body = call("POST", "/receivertemplates/"+template.Id+"?action=propagate", nil, propagation)
+	if code != 200 || len(propagation.Changes) != 1 || propagation.Changes[0].Action != "unchanged" {
+		t.Fatalf("Unexpected second propagation %d %s", code, body)
+	}
+
+	if code, _ := call("DELETE", "/receivertemplates/"+template.Id, nil, nil); code != 204 {
+		t.Fatalf("Unexpected delete %d", code)
+	}
+	if _, err := receivers.Get("1a1", instance.ID); err != nil {
+		t.Fatalf("Deleting a template must keep its instances: %v", err)
+	}
+}
+
+//projectAuthorizer lets callers do anything in the projects it holds and nothing elsewhere
+type projectAuthorizer map[string]bool
+
+func (a projectAuthorizer) Authorize(r *http.Request, projectID string, op string) (int, error) {
+	if !a[projectID] {
+		return 403, fmt.Errorf("Not allowed to %s receivers in project %s", op, projectID)
+	}
+	return 0, nil
+}
+
+func TestPropagateTemplateAuthorizesProjects(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	receivers := store.NewMemoryStore()
+	authorizer := projectAuthorizer{"1a5": true, "1a1": true, "1a2": true}
+	router := NewRouter(&RouteHandler{
+		ClientFactory:     cattle,
+		Store:             receivers,
+		Templates:         receivers,
+		Keys:              r.Keys,
+		Authorizer:        authorizer,
+		TemplateProjectID: "1a5",
+	})
+	call := func(path string, body interface{}, result interface{}) (int, string) {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request, err := http.NewRequest("POST", "http://localhost/v1-webhooks"+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if result != nil {
+			json.Unmarshal(response.Body.Bytes(), result)
+		}
+		return response.Code, response.Body.String()
+	}
+
+	definition := map[string]interface{}{
+		"name":   "autoscale",
+		"driver": "scaleService",
+		"scaleServiceConfig": map[string]interface{}{
+			"serviceId": "id", "action": "up", "amount": 1, "min": 1, "max": 4,
+		},
+	}
+	template := &model.ReceiverTemplate{}
+	if code, body := call("/receivertemplates", map[string]interface{}{"name": "autoscaler", "definition": definition}, template); code != 200 {
+		t.Fatalf("Unexpected template %d %s", code, body)
+	}
+	for _, projectID := range []string{"1a1", "1a2"} {
+		if code, body := call("/receivertemplates/"+template.Id+"?action=instantiate",
+			model.InstantiateInput{ProjectID: projectID}, nil); code != 200 {
+			t.Fatalf("Unexpected instance %d %s", code, body)
+		}
+	}
+	stored, err := receivers.GetTemplate(template.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Definition["condition"] = "body.status == 'firing'"
+	stored.Version++
+	if _, err := receivers.UpdateTemplate(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(authorizer, "1a2")
+	propagation := &model.TemplatePropagation{}
+	code, body := call("/receivertemplates/"+template.Id+"?action=propagate", nil, propagation)
+	if code != 200 || len(propagation.Changes) != 2 || propagation.Changes[0].Action != "update" ||
+		propagation.Changes[1].Action != "skipped" || propagation.Changes[1].ProjectID != "1a2" ||
+		!strings.Contains(propagation.Changes[1].Message, "Not allowed") {
+		t.Fatalf("Unexpected propagation %d %s", code, body)
+	}
+	if instance, err := receivers.GetByName("1a2", "autoscale"); err != nil || instance.Condition != "" || instance.TemplateVersion != 1 {
+		t.Fatalf("Expected the instance of a project the caller can't access to be left alone: %#v %v", instance, err)
+	}
+	if stored, err := receivers.GetTemplate(template.Id); err != nil || strings.Join(stored.Projects, ",") != "1a1,1a2" {
+		t.Fatalf("Expected skipped projects to be kept: %#v %v", stored, err)
+	}
+}
+
+func TestPlaceholderResolver(t *testing.T) {
+	cattle := testutils.NewCattleServer()
+	defer cattle.Close()
+	stackID := cattle.Add("1a1", "stack", map[string]interface{}{"name": "web"})
+	otherStackID := cattle.Add("1a1", "stack", map[string]interface{}{"name": "db"})
+	nginxID := cattle.Add("1a1", "service", map[string]interface{}{"name": "nginx", "stackId": stackID,
+		"launchConfig": map[string]interface{}{"labels": map[string]interface{}{"app": "web", "tier": "front"}}})
+	cattle.Add("1a1", "service", map[string]interface{}{"name": "nginx", "stackId": otherStackID,
+		"launchConfig": map[string]interface{}{"labels": map[string]interface{}{"app": "web"}}})
+	templateID := cattle.Add("1a1", "hostTemplate", map[string]interface{}{"name": "small"})
+
+	apiClient, err := cattle.GetClient("1a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := newPlaceholderResolver(apiClient, "1a1", map[string]string{"max": "4", "tag": "v1"})
+	resolved, err := resolver.resolve(map[string]interface{}{
+		"name":     "scale-${projectId}",
+		"service":  "${service:web/nginx}",
+		"selected": "${serviceSelector:app=web,tier=front}",
+		"template": []interface{}{"${hostTemplate:small}"},
+		"max":      "${var:max}",
+		"tag":      "release-${var:tag}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":     "scale-1a1",
+		"service":  nginxID,
+		"selected": nginxID,
+		"template": []interface{}{templateID},
+		"max":      int64(4),
+		"tag":      "release-v1",
+	}
+	if !jsonEqual(resolved, expected) {
+		t.Fatalf("Expected %v, got %v", expected, resolved)
+	}
+
+	for placeholder, message := range map[string]string{
+		"${serviceSelector:app=web}": "matches 2",
+		"${service:web/redis}":       "No service web/redis",
+		"${hostTemplate:large}":      "No host template large",
+		"${var:missing}":             "Variable missing is not given",
+		"${service:nginx}":           "stack/service",
+		"${projectId:x}":             "takes no argument",
+	} {
+		if _, err := resolver.resolve(placeholder); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %s to fail with %q, got %v", placeholder, message, err)
+		}
+	}
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return string(aJSON) == string(bJSON)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/api"
+	v1client "github.com/rancher/go-rancher/client"
+	"github.com/rancher/webhook-service/model"
+)
+
+const (
+	defaultReceiverTokenTTL = 365 * 24 * time.Hour
+	defaultIssuedTokenTTL   = time.Hour
+	maxIssuedTokenTTL       = 7 * 24 * time.Hour
+)
+
+//tokenClaims are the claims of a receiver URL token. ExecuteWithJwt reads driver, projectId, uuid
+//and config back from them.
+type tokenClaims struct {
+	Driver    string
+	ProjectID string
+	Key       string
+	Config    interface{}
+	NotBefore time.Time
+	Expires   time.Time
+	Audience  string
+}
+
+//signToken mints an RS256 token for a receiver, signed with the active key
+func (rh *RouteHandler) signToken(c tokenClaims) (string, error) {
+	//a token without aud would be accepted for any audience, so it defaults to the service's own
+	if c.Audience == "" && len(rh.TokenAudiences) != 0 {
+		c.Audience = rh.TokenAudiences[0]
+	}
+	if err := rh.checkAudience(c.Audience); err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"driver":    c.Driver,
+		"projectId": c.ProjectID,
+		"uuid":      c.Key,
+		"config":    c.Config,
+		"iat":       time.Now().Unix(),
+		"nbf":       c.NotBefore.Unix(),
+		"exp":       c.Expires.Unix(),
+	}
+	if c.Audience != "" {
+		claims["aud"] = c.Audience
+	}
+
+	return rh.Keys.Sign(claims)
+}
+
+//checkAudience makes sure a token audience is one the service accepts. Any audience, or none, is
+//accepted when no TokenAudiences are configured.
+func (rh *RouteHandler) checkAudience(audience string) error {
+	if len(rh.TokenAudiences) == 0 {
+		return nil
+	}
+	if audience == "" {
+		return fmt.Errorf("Token has no audience, this service accepts %v", rh.TokenAudiences)
+	}
+	if !contains(rh.TokenAudiences, audience) {
+		return fmt.Errorf("Audience %v is not accepted by this service", audience)
+	}
+	return nil
+}
+
+//verifyAudience rejects tokens minted for an audience this service doesn't accept. Tokens without
+//an aud claim are only accepted when no TokenAudiences are configured.
+func (rh *RouteHandler) verifyAudience(claims jwt.MapClaims) (int, error) {
+	audience := ""
+	if aud, ok := claims["aud"]; ok {
+		if audience, ok = aud.(string); !ok {
+			return 400, fmt.Errorf("Invalid audience claim")
+		}
+	}
+	if err := rh.checkAudience(audience); err != nil {
+		return 403, err
+	}
+	return 0, nil
+}
+
+//JWKS publishes the public keys tokens are verified with, so other services can verify them too
+func (rh *RouteHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rh.Keys.JWKS()); err != nil {
+		logrus.Errorf("Failed to write JWKS: %v", err)
+	}
+}
+
+func tokenURL(apiContext *api.ApiContext, token string) string {
+	return apiContext.UrlBuilder.Version("v1-webhooks") + "/endpoint?token=" + token
+}
+
+//ReceiverAction dispatches POST requests on a single receiver by their action query parameter
+func (rh *RouteHandler) ReceiverAction(w http.ResponseWriter, r *http.Request) (int, error) {
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "issueToken":
+		return rh.IssueToken(w, r)
+	}
+	return 404, fmt.Errorf("Invalid action %v", action)
+}
+
+//IssueToken mints an additional short-lived token URL for an existing receiver
+func (rh *RouteHandler) IssueToken(w http.ResponseWriter, r *http.Request) (int, error) {
+	apiContext := api.GetApiContext(r)
+	webhookID := mux.Vars(r)["id"]
+
+	projectID, errCode, err := getProjectID(r)
+	if err != nil {
+		return errCode, err
+	}
+
+	input := &model.IssueTokenInput{}
+	requestBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 500, err
+	}
+	if len(requestBytes) > 0 {
+		if err := json.Unmarshal(requestBytes, input); err != nil {
+			return 400, errors.Wrap(err, "Bad request body")
+		}
+	}
+
+	ttl := time.Duration(input.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultIssuedTokenTTL
+	}
+	if ttl < 0 || ttl > maxIssuedTokenTTL {
+		return 400, fmt.Errorf("ttlSeconds must be between 1 and %v", int64(maxIssuedTokenTTL.Seconds()))
+	}
+	if input.NotBeforeSeconds < 0 {
+		return 400, fmt.Errorf("notBeforeSeconds can't be negative")
+	}
+
+	receiver, err := rh.Store.Get(projectID, webhookID)
+	if err != nil {
+		rh.invalidateOnAuthError(projectID, err)
+		return storeErrorCode(err), err
+	}
+	if receiver.Error != "" {
+		return 400, fmt.Errorf("Can't issue token for webhook in error state: %v", receiver.Error)
+	}
+
+	notBefore := time.Now().Add(time.Duration(input.NotBeforeSeconds) * time.Second)
+	expires := notBefore.Add(ttl)
+	token, err := rh.signToken(tokenClaims{
+		Driver:    receiver.Driver,
+		ProjectID: projectID,
+		Key:       receiver.Key,
+		Config:    receiver.Config,
+		NotBefore: notBefore,
+		Expires:   expires,
+		Audience:  input.Audience,
+	})
+	if err != nil {
+		return 400, err
+	}
+
+	apiContext.WriteResource(&model.IssuedToken{
+		Resource: v1client.Resource{
+			Type: "issuedToken",
+		},
+		Token:     token,
+		URL:       tokenURL(apiContext, token),
+		Expires:   expires.UTC().Format(time.RFC3339),
+		NotBefore: notBefore.UTC().Format(time.RFC3339),
+	})
+	return 200, nil
+}
+
+//newReceiverToken mints the long-lived token embedded in the URL of a receiver created with useToken
+func (rh *RouteHandler) newReceiverToken(wh *model.Webhook, projectID string, key string, config interface{}) (string, error) {
+	ttl := time.Duration(wh.TokenTTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultReceiverTokenTTL
+	}
+	if ttl < 0 {
+		return "", fmt.Errorf("tokenTtlSeconds can't be negative")
+	}
+
+	now := time.Now()
+	return rh.signToken(tokenClaims{
+		Driver:    wh.Driver,
+		ProjectID: projectID,
+		Key:       key,
+		Config:    config,
+		NotBefore: now,
+		Expires:   now.Add(ttl),
+		Audience:  wh.TokenAudience,
+	})
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/webhook-service/model"
+)
+
+func executeURL(t *testing.T, url string) int {
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response.Code
+}
+
+func issueToken(t *testing.T, id string, body string) (int, *model.IssuedToken) {
+	url := fmt.Sprintf("%s/v1-webhooks/receivers/%s?projectId=1a1&action=issueToken", server.URL, id)
+	request, err := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	issued := &model.IssuedToken{}
+	if response.Code == 200 {
+		if err := json.Unmarshal(response.Body.Bytes(), issued); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response.Code, issued
+}
+
+func TestTokenReceiverURLs(t *testing.T) {
+	mw := r.ClientFactory.(*MockRancherClientFactory).mw
+	defer func() { r.TokenAudiences = nil }()
+
+	constructURL := fmt.Sprintf("%s/v1-webhooks/receivers?projectId=1a1", server.URL)
+	jsonStr := []byte(`{"driver":"scaleService","name":"wh-token","useToken":true,"tokenTtlSeconds":3600,
+		"scaleServiceConfig": {"serviceId": "id", "amount": 1, "action": "up", "min": 1, "max": 4}}`)
+	request, err := http.NewRequest("POST", constructURL, bytes.NewBuffer(jsonStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("StatusCode %d means create with useToken failed: %s", response.Code, response.Body.String())
+	}
+	wh := &model.Webhook{}
+	if err := json.Unmarshal(response.Body.Bytes(), wh); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(mw.created, wh.Id)
+
+	if !strings.Contains(wh.URL, "/endpoint?token=") || strings.Contains(wh.URL, "key=") {
+		t.Fatalf("Expected a token URL, got %v", wh.URL)
+	}
+	if code := executeURL(t, wh.URL); code != 200 {
+		t.Fatalf("StatusCode %d executing the receiver token", code)
+	}
+
+	code, issued := issueToken(t, wh.Id, `{"ttlSeconds": 60}`)
+	if code != 200 || issued.Token == "" || !strings.HasSuffix(issued.URL, "/endpoint?token="+issued.Token) {
+		t.Fatalf("StatusCode %d issuing token: %#v", code, issued)
+	}
+	if code := executeURL(t, issued.URL); code != 200 {
+		t.Fatalf("StatusCode %d executing an issued token", code)
+	}
+
+	if code, _ := issueToken(t, wh.Id, `{"ttlSeconds": 999999999}`); code != 400 {
+		t.Fatalf("StatusCode %d, ttl above the maximum must be rejected", code)
+	}
+	if code, _ := issueToken(t, "1go404", ``); code != 404 {
+		t.Fatalf("StatusCode %d issuing token for missing receiver", code)
+	}
+
+	// Tokens that aren't valid yet or have expired are rejected
+	code, issued = issueToken(t, wh.Id, `{"notBeforeSeconds": 3600}`)
+	if code != 200 {
+		t.Fatalf("StatusCode %d issuing delayed token", code)
+	}
+	if code := executeURL(t, issued.URL); code != 400 {
+		t.Fatalf("StatusCode %d, token used before nbf must be rejected", code)
+	}
+	receiver, err := r.Store.Get("1a1", wh.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := r.signToken(tokenClaims{
+		Driver:    receiver.Driver,
+		ProjectID: "1a1",
+		Key:       receiver.Key,
+		Config:    receiver.Config,
+		NotBefore: time.Now().Add(-2 * time.Hour),
+		Expires:   time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := executeURL(t, server.URL+"/v1-webhooks/endpoint?token="+expired); code != 400 {
+		t.Fatalf("StatusCode %d, expired token must be rejected", code)
+	}
+
+	// Audiences are checked when minting and when executing
+	code, other := issueToken(t, wh.Id, `{"audience": "other"}`)
+	if code != 200 {
+		t.Fatalf("StatusCode %d issuing token with audience", code)
+	}
+	code, anyAudience := issueToken(t, wh.Id, `{}`)
+	if code != 200 {
+		t.Fatalf("StatusCode %d issuing token without audience", code)
+	}
+	r.TokenAudiences = []string{"ci"}
+	if code := executeURL(t, anyAudience.URL); code != 403 {
+		t.Fatalf("StatusCode %d, token without audience must be rejected once audiences are configured", code)
+	}
+	code, defaulted := issueToken(t, wh.Id, `{}`)
+	if code != 200 {
+		t.Fatalf("StatusCode %d issuing token with the default audience", code)
+	}
+	if code := executeURL(t, defaulted.URL); code != 200 {
+		t.Fatalf("StatusCode %d executing token with the default audience", code)
+	}
+	if code, _ := issueToken(t, wh.Id, `{"audience": "other"}`); code != 400 {
+		t.Fatalf("StatusCode %d, unaccepted audience must not be minted", code)
+	}
+	if code := executeURL(t, other.URL); code != 403 {
+		t.Fatalf("StatusCode %d, token for unaccepted audience must be rejected", code)
+	}
+	code, ci := issueToken(t, wh.Id, `{"audience": "ci"}`)
+	if code != 200 {
+		t.Fatalf("StatusCode %d issuing token for accepted audience", code)
+	}
+	if code := executeURL(t, ci.URL); code != 200 {
+		t.Fatalf("StatusCode %d executing token for accepted audience", code)
+	}
+
+	// Deleting the receiver revokes its tokens
+	delete(mw.created, wh.Id)
+	if code := executeURL(t, ci.URL); code != 403 {
+		t.Fatalf("StatusCode %d, token of deleted receiver must be rejected", code)
+	}
+}
@@ -0,0 +1,444 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	projectsBucket  = []byte("projects")
+	receiversBucket = []byte("receivers")
+	namesBucket     = []byte("names")
+	keysBucket      = []byte("keys")
+	templatesBucket = []byte("templates")
+)
+
+//BoltStore is an embedded store that keeps receivers in a BoltDB file. Every project has its own
+//bucket of receivers, in creation order, with indexes by name and key, so lookups and lists only
+//read the project's receivers. Only one process may have the file open at a time.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Error opening receiver store %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{projectsBucket, templatesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error opening receiver store %s: %v", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+//Close releases the file so the store can be opened again
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Create(receiver *Receiver) (*Receiver, error) {
+	created, err := copyReceiver(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, created.ProjectID, true)
+		if err != nil {
+			return err
+		}
+		if project.names.Get([]byte(created.Name)) != nil {
+			return &ConflictError{Name: created.Name}
+		}
+		id, err := tx.Bucket(projectsBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		created.ID = strconv.FormatUint(id, 10)
+		created.State = "active"
+		if created.Created.IsZero() {
+			created.Created = time.Now().UTC()
+		}
+		return project.put(created, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *BoltStore) Update(receiver *Receiver) (*Receiver, error) {
+	updated, err := copyReceiver(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, updated.ProjectID, false)
+		if err != nil {
+			return err
+		}
+		existing, err := project.get(updated.ProjectID, updated.ID)
+		if err != nil {
+			return err
+		}
+		if other := project.names.Get([]byte(updated.Name)); other != nil && !bytes.Equal(other, idKey(existing.ID)) {
+			return &ConflictError{Name: updated.Name}
+		}
+		updated.Key = existing.Key
+		updated.State = existing.State
+		updated.Created = existing.Created
+		return project.put(updated, existing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *BoltStore) Get(projectID string, id string) (*Receiver, error) {
+	var receiver *Receiver
+	err := s.db.View(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, projectID, false)
+		if err != nil {
+			return err
+		}
+		receiver, err = project.get(projectID, id)
+		return err
+	})
+	return receiver, err
+}
+
+func (s *BoltStore) GetByKey(projectID string, key string) (*Receiver, error) {
+	return s.getByIndex(projectID, keysBucket, key, notFoundByKey(projectID))
+}
+
+func (s *BoltStore) GetByName(projectID string, name string) (*Receiver, error) {
+	return s.getByIndex(projectID, namesBucket, name, notFoundByName(projectID, name))
+}
+
+func (s *BoltStore) getByIndex(projectID string, index []byte, value string, notFound error) (*Receiver, error) {
+	var receiver *Receiver
+	err := s.db.View(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, projectID, false)
+		if err != nil {
+			return err
+		}
+		if project == nil || value == "" {
+			return notFound
+		}
+		id := project.project.Bucket(index).Get([]byte(value))
+		if id == nil {
+			return notFound
+		}
+		receiver, err = project.get(projectID, idString(id))
+		return err
+	})
+	return receiver, err
+}
+
+//List reads the project's receivers and applies opts to them. Receivers that can't be decoded are
+//listed in error state.
+func (s *BoltStore) List(projectID string, opts ListOptions) (*ListResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	receivers := []*Receiver{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, projectID, false)
+		if err != nil || project == nil {
+			return err
+		}
+		return project.receivers.ForEach(func(k []byte, data []byte) error {
+			receiver, err := decodeReceiver(idString(k), data)
+			if err != nil {
+				logrus.Warnf("Listing webhook %s in error state because: %v", idString(k), err)
+				receiver = &Receiver{ID: idString(k), ProjectID: projectID, State: "error", Error: err.Error()}
+			}
+			receivers = append(receivers, receiver)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applyListOptions(receivers, opts)
+}
+
+func (s *BoltStore) Delete(projectID string, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		project, err := openProject(tx, projectID, false)
+		if err != nil {
+			return err
+		}
+		if _, err := project.get(projectID, id); err != nil && !IsCorrupt(err) {
+			return err
+		}
+		for _, index := range []*bolt.Bucket{project.names, project.keys} {
+			if err := deleteIndexEntries(index, idKey(id)); err != nil {
+				return err
+			}
+		}
+		return project.receivers.Delete(idKey(id))
+	})
+}
+
+func (s *BoltStore) CreateTemplate(template *Template) (*Template, error) {
+	created, err := copyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		templates := tx.Bucket(templatesBucket)
+		if err := checkTemplateName(templates, "", created.Name); err != nil {
+			return err
+		}
+		id, err := templates.NextSequence()
+		if err != nil {
+			return err
+		}
+		created.ID = "t" + strconv.FormatUint(id, 10)
+		if created.Created.IsZero() {
+			created.Created = time.Now().UTC()
+		}
+		return putTemplate(templates, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *BoltStore) GetTemplate(id string) (*Template, error) {
+	var template *Template
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		template, err = getTemplate(tx.Bucket(templatesBucket), id)
+		return err
+	})
+	return template, err
+}
+
+func (s *BoltStore) ListTemplates() ([]*Template, error) {
+	templates := []*Template{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(templatesBucket).ForEach(func(k []byte, data []byte) error {
+			template := &Template{}
+			if err := json.Unmarshal(data, template); err != nil {
+				return &CorruptError{ID: "t" + idString(k), Reason: err.Error()}
+			}
+			templates = append(templates, template)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *BoltStore) UpdateTemplate(template *Template) (*Template, error) {
+	updated, err := copyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		templates := tx.Bucket(templatesBucket)
+		existing, err := getTemplate(templates, updated.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkTemplateName(templates, updated.ID, updated.Name); err != nil {
+			return err
+		}
+		updated.Created = existing.Created
+		return putTemplate(templates, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *BoltStore) DeleteTemplate(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		templates := tx.Bucket(templatesBucket)
+		if _, err := getTemplate(templates, id); err != nil {
+			return err
+		}
+		return templates.Delete(templateKey(id))
+	})
+}
+
+//projectBuckets are the receivers of a project and their indexes by name and key
+type projectBuckets struct {
+	project   *bolt.Bucket
+	receivers *bolt.Bucket
+	names     *bolt.Bucket
+	keys      *bolt.Bucket
+}
+
+//openProject returns the buckets of a project. A project without receivers has none, and nil is
+//returned unless create is set.
+func openProject(tx *bolt.Tx, projectID string, create bool) (*projectBuckets, error) {
+	projects := tx.Bucket(projectsBucket)
+	project := projects.Bucket([]byte(projectID))
+	if project == nil {
+		if !create {
+			return nil, nil
+		}
+		var err error
+		if project, err = projects.CreateBucket([]byte(projectID)); err != nil {
+			return nil, err
+		}
+		for _, name := range [][]byte{receiversBucket, namesBucket, keysBucket} {
+			if _, err := project.CreateBucket(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &projectBuckets{
+		project:   project,
+		receivers: project.Bucket(receiversBucket),
+		names:     project.Bucket(namesBucket),
+		keys:      project.Bucket(keysBucket),
+	}, nil
+}
+
+//get reads a receiver of the project. p may be nil for a project without receivers.
+func (p *projectBuckets) get(projectID string, id string) (*Receiver, error) {
+	if p == nil {
+		return nil, notFoundByID(projectID, id)
+	}
+	data := p.receivers.Get(idKey(id))
+	if data == nil {
+		return nil, notFoundByID(projectID, id)
+	}
+	return decodeReceiver(id, data)
+}
+
+//put writes a receiver and its index entries, replacing those of its previous version if any
+func (p *projectBuckets) put(receiver *Receiver, previous *Receiver) error {
+	data, err := json.Marshal(receiver)
+	if err != nil {
+		return err
+	}
+	id := idKey(receiver.ID)
+	if previous != nil && previous.Name != receiver.Name {
+		if err := p.names.Delete([]byte(previous.Name)); err != nil {
+			return err
+		}
+	}
+	if err := p.receivers.Put(id, data); err != nil {
+		return err
+	}
+	if err := p.names.Put([]byte(receiver.Name), id); err != nil {
+		return err
+	}
+	if receiver.Key != "" {
+		return p.keys.Put([]byte(receiver.Key), id)
+	}
+	return nil
+}
+
+//deleteIndexEntries removes the entries of index that point to id. The index is scanned rather
+//than looked up by the receiver's name and key, so a receiver that can't be decoded is removed too.
+func deleteIndexEntries(index *bolt.Bucket, id []byte) error {
+	values := [][]byte{}
+	err := index.ForEach(func(value []byte, entry []byte) error {
+		if bytes.Equal(entry, id) {
+			values = append(values, append([]byte{}, value...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := index.Delete(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeReceiver(id string, data []byte) (*Receiver, error) {
+	receiver := &Receiver{}
+	if err := json.Unmarshal(data, receiver); err != nil {
+		return nil, &CorruptError{ID: id, Reason: err.Error()}
+	}
+	return receiver, nil
+}
+
+//idKey encodes a numeric id big-endian, so a bucket iterates in creation order. Ids that aren't
+//numbers get a key no receiver has.
+func idKey(id string) []byte {
+	key := make([]byte, 8)
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		binary.BigEndian.PutUint64(key, n)
+	}
+	return key
+}
+
+func idString(key []byte) string {
+	return strconv.FormatUint(binary.BigEndian.Uint64(key), 10)
+}
+
+func templateKey(id string) []byte {
+	if !strings.HasPrefix(id, "t") {
+		return make([]byte, 8)
+	}
+	return idKey(strings.TrimPrefix(id, "t"))
+}
+
+func getTemplate(templates *bolt.Bucket, id string) (*Template, error) {
+	data := templates.Get(templateKey(id))
+	if data == nil {
+		return nil, &TemplateNotFoundError{ID: id}
+	}
+	template := &Template{}
+	if err := json.Unmarshal(data, template); err != nil {
+		return nil, &CorruptError{ID: id, Reason: err.Error()}
+	}
+	return template, nil
+}
+
+func putTemplate(templates *bolt.Bucket, template *Template) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	return templates.Put(templateKey(template.ID), data)
+}
+
+//checkTemplateName fails when a template other than id has the name. Templates are few, so they
+//aren't indexed by name.
+func checkTemplateName(templates *bolt.Bucket, id string, name string) error {
+	return templates.ForEach(func(k []byte, data []byte) error {
+		template := &Template{}
+		if json.Unmarshal(data, template) == nil && template.ID != id && template.Name == name {
+			return &TemplateConflictError{Name: name}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+//NotFoundError is returned when no receiver of the project matches a lookup
+type NotFoundError struct {
+	ProjectID string
+	Lookup    string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("Webhook %s not found in project %s", e.Lookup, e.ProjectID)
+}
+
+//ConflictError is returned when creating a receiver whose name is already taken in the project
+type ConflictError struct {
+	Name string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Cannot have duplicate webhook name, webhook %s already exists", e.Name)
+}
+
+//CorruptError is returned when a stored receiver cannot be decoded
+type CorruptError struct {
+	ID     string
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("Couldn't read webhook %s data. %s", e.ID, e.Reason)
+}
+
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*NotFoundError)
+	return ok
+}
+
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+func IsCorrupt(err error) bool {
+	_, ok := errors.Cause(err).(*CorruptError)
+	return ok
+}
+
+func notFoundByID(projectID string, id string) error {
+	return &NotFoundError{ProjectID: projectID, Lookup: "with id " + id}
+}
+
+func notFoundByKey(projectID string) error {
+	return &NotFoundError{ProjectID: projectID, Lookup: "with the given key"}
+}
+
+func notFoundByName(projectID string, name string) error {
+	return &NotFoundError{ProjectID: projectID, Lookup: "named " + name}
+}
+
+//TemplateNotFoundError is returned when there's no receiver template with the given id
+type TemplateNotFoundError struct {
+	ID string
+}
+
+func (e *TemplateNotFoundError) Error() string {
+	return fmt.Sprintf("Receiver template %s not found", e.ID)
+}
+
+//TemplateConflictError is returned when a receiver template's name is already taken
+type TemplateConflictError struct {
+	Name string
+}
+
+func (e *TemplateConflictError) Error() string {
+	return fmt.Sprintf("Cannot have duplicate receiver template name, template %s already exists", e.Name)
+}
+
+func IsTemplateNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*TemplateNotFoundError)
+	return ok
+}
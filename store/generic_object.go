@@ -0,0 +1,428 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+const cattlePageSize = 1000
+
+//GenericObjectStore keeps receivers as Cattle GenericObjects of kind webhookReceiver. Every lookup
+//is scoped to that kind and to the requested project, so unrelated GenericObjects sharing a name
+//or key are never treated as receivers.
+type GenericObjectStore struct {
+	clients ClientGetter
+}
+
+func NewGenericObjectStore(clients ClientGetter) *GenericObjectStore {
+	return &GenericObjectStore{clients: clients}
+}
+
+func (s *GenericObjectStore) Create(receiver *Receiver) (*Receiver, error) {
+	if _, err := s.GetByName(receiver.ProjectID, receiver.Name); err == nil || IsCorrupt(err) {
+		return nil, &ConflictError{Name: receiver.Name}
+	} else if !IsNotFound(err) {
+		return nil, err
+	}
+
+	apiClient, err := s.clients.GetClient(receiver.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := apiClient.GenericObject.Create(&client.GenericObject{
+		Name:         receiver.Name,
+		Key:          receiver.Key,
+		ResourceData: resourceData(receiver),
+		Kind:         receiverKind,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create webhook")
+	}
+
+	created := *receiver
+	created.ID = obj.Id
+	created.State = obj.State
+	created.Created = parseCreated(obj.Created)
+	return &created, nil
+}
+
+//Update rewrites the receiver's GenericObject in place, so its ID, and its key and with it the
+//receiver URL, stay the same
+func (s *GenericObjectStore) Update(receiver *Receiver) (*Receiver, error) {
+	existing, err := s.Get(receiver.ProjectID, receiver.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Name != receiver.Name {
+		if _, err := s.GetByName(receiver.ProjectID, receiver.Name); err == nil || IsCorrupt(err) {
+			return nil, &ConflictError{Name: receiver.Name}
+		} else if !IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	apiClient, err := s.clients.GetClient(receiver.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := apiClient.GenericObject.ById(receiver.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting genericObject")
+	}
+	if obj == nil {
+		return nil, notFoundByID(receiver.ProjectID, receiver.ID)
+	}
+	obj, err = apiClient.GenericObject.Update(obj, map[string]interface{}{
+		"name":         receiver.Name,
+		"resourceData": resourceData(receiver),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to update webhook")
+	}
+
+	updated := *receiver
+	updated.Key = existing.Key
+	updated.State = obj.State
+	updated.Created = existing.Created
+	return &updated, nil
+}
+
+func (s *GenericObjectStore) Get(projectID string, id string) (*Receiver, error) {
+	apiClient, err := s.clients.GetClient(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := apiClient.GenericObject.ById(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting genericObject")
+	}
+	if obj == nil || !isProjectReceiver(projectID, *obj) {
+		return nil, notFoundByID(projectID, id)
+	}
+	return receiverFromGenericObject(projectID, *obj)
+}
+
+func (s *GenericObjectStore) GetByKey(projectID string, key string) (*Receiver, error) {
+	if key == "" {
+		return nil, notFoundByKey(projectID)
+	}
+	objs, err := s.list(projectID, map[string]interface{}{"key": key})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.Key == key {
+			return receiverFromGenericObject(projectID, obj)
+		}
+	}
+	return nil, notFoundByKey(projectID)
+}
+
+func (s *GenericObjectStore) GetByName(projectID string, name string) (*Receiver, error) {
+	objs, err := s.list(projectID, map[string]interface{}{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.Name == name {
+			return receiverFromGenericObject(projectID, obj)
+		}
+	}
+	return nil, notFoundByName(projectID, name)
+}
+
+//List reads every receiver of the project, following Cattle's pagination, and applies opts to the
+//result. The name prefix is pushed down to Cattle so it only returns candidate objects. Limit and
+//marker are not: the driver and state filters and the total count need the whole set, which is
+//decoded from resourceData, so every page costs a full read of the project's receivers in Cattle.
+func (s *GenericObjectStore) List(projectID string, opts ListOptions) (*ListResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	filters := map[string]interface{}{}
+	if opts.NamePrefix != "" {
+		filters["name_prefix"] = opts.NamePrefix
+	}
+	objs, err := s.list(projectID, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	receivers := []*Receiver{}
+	for _, obj := range objs {
+		receiver, err := receiverFromGenericObject(projectID, obj)
+		if err != nil {
+			logrus.Warnf("Listing webhook %s in error state because: %v", obj.Id, err)
+			receiver = &Receiver{
+				ID:        obj.Id,
+				ProjectID: projectID,
+				Name:      obj.Name,
+				State:     "error",
+				Created:   parseCreated(obj.Created),
+				Error:     err.Error(),
+			}
+			if driver, ok := obj.ResourceData["driver"].(string); ok {
+				receiver.Driver = driver
+			}
+		}
+		receivers = append(receivers, receiver)
+	}
+	return applyListOptions(receivers, opts)
+}
+
+func (s *GenericObjectStore) Delete(projectID string, id string) error {
+	apiClient, err := s.clients.GetClient(projectID)
+	if err != nil {
+		return err
+	}
+
+	obj, err := apiClient.GenericObject.ById(id)
+	if err != nil {
+		return errors.Wrap(err, "Error getting genericObject")
+	}
+	if obj == nil || !isProjectReceiver(projectID, *obj) {
+		return notFoundByID(projectID, id)
+	}
+	return apiClient.GenericObject.Delete(obj)
+}
+
+//list returns the project's receiver GenericObjects matching filters. Results are checked again
+//after Cattle filtered them, so a filter Cattle ignores can't widen the match.
+func (s *GenericObjectStore) list(projectID string, filters map[string]interface{}) ([]client.GenericObject, error) {
+	apiClient, err := s.clients.GetClient(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	filters["kind"] = receiverKind
+	filters["limit"] = cattlePageSize
+	collection, err := apiClient.GenericObject.List(&client.ListOpts{
+		Filters: filters,
+	})
+
+	objs := []client.GenericObject{}
+	for collection != nil {
+		if err != nil {
+			return nil, errors.Wrap(err, "Error listing genericObjects")
+		}
+		for _, obj := range collection.Data {
+			if isProjectReceiver(projectID, obj) {
+				objs = append(objs, obj)
+			}
+		}
+		collection, err = nextPage(collection)
+	}
+	return objs, nil
+}
+
+//nextPage follows the collection's next link. Collections that weren't returned by a live client,
+//such as those of test doubles, have no next page.
+func nextPage(collection *client.GenericObjectCollection) (*client.GenericObjectCollection, error) {
+	if collection.Pagination == nil || collection.Pagination.Next == "" {
+		return nil, nil
+	}
+	return collection.Next()
+}
+
+//resourceData is what a receiver's GenericObject stores besides its name and key
+func resourceData(receiver *Receiver) map[string]interface{} {
+	data := map[string]interface{}{
+		"url":    receiver.URL,
+		"driver": receiver.Driver,
+		"config": receiver.Config,
+	}
+	if len(receiver.AllowedCIDRs) > 0 {
+		data["allowedCIDRs"] = receiver.AllowedCIDRs
+	}
+	if receiver.Condition != "" {
+		data["condition"] = receiver.Condition
+	}
+	if len(receiver.Transform) > 0 {
+		data["transform"] = receiver.Transform
+	}
+	if len(receiver.Overrides) > 0 {
+		data["overrides"] = receiver.Overrides
+	}
+	if receiver.TemplateID != "" {
+		data["templateId"] = receiver.TemplateID
+		data["templateVersion"] = receiver.TemplateVersion
+	}
+	if len(receiver.TemplateVariables) > 0 {
+		data["templateVariables"] = receiver.TemplateVariables
+	}
+	return data
+}
+
+func isProjectReceiver(projectID string, obj client.GenericObject) bool {
+	if obj.Kind != receiverKind || obj.Removed != "" {
+		return false
+	}
+	return obj.AccountId == "" || obj.AccountId == projectID
+}
+
+func receiverFromGenericObject(projectID string, genericObject client.GenericObject) (*Receiver, error) {
+	d, ok := genericObject.ResourceData["driver"].(string)
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad driver"}
+	}
+
+	url, ok := genericObject.ResourceData["url"].(string)
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad url"}
+	}
+
+	config, ok := genericObject.ResourceData["config"]
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad config on resource"}
+	}
+
+	allowedCIDRs, ok := stringSlice(genericObject.ResourceData["allowedCIDRs"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad allowedCIDRs"}
+	}
+
+	condition, ok := optionalString(genericObject.ResourceData["condition"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad condition"}
+	}
+
+	transform, ok := stringMap(genericObject.ResourceData["transform"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad transform"}
+	}
+
+	overrides, ok := overrideBounds(genericObject.ResourceData["overrides"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad overrides"}
+	}
+
+	templateID, ok := optionalString(genericObject.ResourceData["templateId"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad templateId"}
+	}
+	templateVersion, ok := optionalInt(genericObject.ResourceData["templateVersion"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad templateVersion"}
+	}
+	templateVariables, ok := stringMap(genericObject.ResourceData["templateVariables"])
+	if !ok {
+		return nil, &CorruptError{ID: genericObject.Id, Reason: "Bad templateVariables"}
+	}
+
+	return &Receiver{
+		ID:           genericObject.Id,
+		ProjectID:    projectID,
+		Name:         genericObject.Name,
+		Key:          genericObject.Key,
+		Driver:       d,
+		URL:          url,
+		State:        genericObject.State,
+		Created:      parseCreated(genericObject.Created),
+		Config:       config,
+		AllowedCIDRs: allowedCIDRs,
+		Condition:    condition,
+		Transform:    transform,
+		Overrides:    overrides,
+
+		TemplateID:        templateID,
+		TemplateVersion:   templateVersion,
+		TemplateVariables: templateVariables,
+	}, nil
+}
+
+func optionalString(value interface{}) (string, bool) {
+	if value == nil {
+		return "", true
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+//optionalInt reads an optional whole number out of decoded resource data
+func optionalInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case nil:
+		return 0, true
+	case float64:
+		return int64(v), v == float64(int64(v))
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+//stringMap reads an optional map of strings out of decoded resource data
+func stringMap(value interface{}) (map[string]string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case map[string]string:
+		return v, true
+	case map[string]interface{}:
+		result := map[string]string{}
+		for key, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			result[key] = s
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+//overrideBounds reads optional override bounds out of decoded resource data
+func overrideBounds(value interface{}) (map[string]model.OverrideBounds, bool) {
+	if value == nil {
+		return nil, true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	result := map[string]model.OverrideBounds{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+//stringSlice reads an optional list of strings out of decoded resource data
+func stringSlice(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case []string:
+		return v, true
+	case []interface{}:
+		result := []string{}
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, s)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func parseCreated(created string) time.Time {
+	t, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
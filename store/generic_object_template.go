@@ -0,0 +1,203 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v2"
+)
+
+//GenericObjectTemplateStore keeps receiver templates as Cattle GenericObjects of kind
+//webhookReceiverTemplate in a single project, since Cattle has nothing above projects to keep
+//them in
+type GenericObjectTemplateStore struct {
+	clients   ClientGetter
+	projectID string
+}
+
+func NewGenericObjectTemplateStore(clients ClientGetter, projectID string) *GenericObjectTemplateStore {
+	return &GenericObjectTemplateStore{clients: clients, projectID: projectID}
+}
+
+func (s *GenericObjectTemplateStore) CreateTemplate(template *Template) (*Template, error) {
+	if err := s.checkName("", template.Name); err != nil {
+		return nil, err
+	}
+	apiClient, err := s.clients.GetClient(s.projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := apiClient.GenericObject.Create(&client.GenericObject{
+		Name:         template.Name,
+		ResourceData: templateData(template),
+		Kind:         templateKind,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create receiver template")
+	}
+	return templateFromGenericObject(*obj)
+}
+
+func (s *GenericObjectTemplateStore) GetTemplate(id string) (*Template, error) {
+	obj, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return templateFromGenericObject(*obj)
+}
+
+func (s *GenericObjectTemplateStore) ListTemplates() ([]*Template, error) {
+	objs, err := s.list(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	templates := []*Template{}
+	for _, obj := range objs {
+		template, err := templateFromGenericObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+func (s *GenericObjectTemplateStore) UpdateTemplate(template *Template) (*Template, error) {
+	obj, err := s.get(template.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(template.ID, template.Name); err != nil {
+		return nil, err
+	}
+	apiClient, err := s.clients.GetClient(s.projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err = apiClient.GenericObject.Update(obj, map[string]interface{}{
+		"name":         template.Name,
+		"resourceData": templateData(template),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to update receiver template")
+	}
+	return templateFromGenericObject(*obj)
+}
+
+func (s *GenericObjectTemplateStore) DeleteTemplate(id string) error {
+	obj, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	apiClient, err := s.clients.GetClient(s.projectID)
+	if err != nil {
+		return err
+	}
+	return apiClient.GenericObject.Delete(obj)
+}
+
+func (s *GenericObjectTemplateStore) get(id string) (*client.GenericObject, error) {
+	apiClient, err := s.clients.GetClient(s.projectID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := apiClient.GenericObject.ById(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting genericObject")
+	}
+	if obj == nil || !isProjectTemplate(s.projectID, *obj) {
+		return nil, &TemplateNotFoundError{ID: id}
+	}
+	return obj, nil
+}
+
+//checkName makes sure no template other than id is named name
+func (s *GenericObjectTemplateStore) checkName(id string, name string) error {
+	objs, err := s.list(map[string]interface{}{"name": name})
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if obj.Name == name && obj.Id != id {
+			return &TemplateConflictError{Name: name}
+		}
+	}
+	return nil
+}
+
+func (s *GenericObjectTemplateStore) list(filters map[string]interface{}) ([]client.GenericObject, error) {
+	apiClient, err := s.clients.GetClient(s.projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	filters["kind"] = templateKind
+	filters["limit"] = cattlePageSize
+	collection, err := apiClient.GenericObject.List(&client.ListOpts{
+		Filters: filters,
+	})
+
+	objs := []client.GenericObject{}
+	for collection != nil {
+		if err != nil {
+			return nil, errors.Wrap(err, "Error listing genericObjects")
+		}
+		for _, obj := range collection.Data {
+			if isProjectTemplate(s.projectID, obj) {
+				objs = append(objs, obj)
+			}
+		}
+		collection, err = nextPage(collection)
+	}
+	return objs, nil
+}
+
+func isProjectTemplate(projectID string, obj client.GenericObject) bool {
+	if obj.Kind != templateKind || obj.Removed != "" {
+		return false
+	}
+	return obj.AccountId == "" || obj.AccountId == projectID
+}
+
+func templateData(template *Template) map[string]interface{} {
+	data := map[string]interface{}{
+		"definition": template.Definition,
+		"version":    template.Version,
+	}
+	if template.Description != "" {
+		data["description"] = template.Description
+	}
+	if len(template.Projects) > 0 {
+		data["projects"] = template.Projects
+	}
+	return data
+}
+
+func templateFromGenericObject(obj client.GenericObject) (*Template, error) {
+	definition, ok := obj.ResourceData["definition"].(map[string]interface{})
+	if !ok {
+		return nil, &CorruptError{ID: obj.Id, Reason: "Bad definition"}
+	}
+	version, ok := optionalInt(obj.ResourceData["version"])
+	if !ok {
+		return nil, &CorruptError{ID: obj.Id, Reason: "Bad version"}
+	}
+	description, ok := optionalString(obj.ResourceData["description"])
+	if !ok {
+		return nil, &CorruptError{ID: obj.Id, Reason: "Bad description"}
+	}
+	projects, ok := stringSlice(obj.ResourceData["projects"])
+	if !ok {
+		return nil, &CorruptError{ID: obj.Id, Reason: "Bad projects"}
+	}
+
+	return &Template{
+		ID:          obj.Id,
+		Name:        obj.Name,
+		Description: description,
+		Definition:  definition,
+		Version:     version,
+		Projects:    projects,
+		Created:     parseCreated(obj.Created),
+	}, nil
+}
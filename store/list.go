@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+//ListOptions selects, orders and pages the receivers returned by ReceiverStore.List
+type ListOptions struct {
+	Limit      int
+	Marker     string
+	Sort       string
+	Order      string
+	Driver     string
+	NamePrefix string
+	State      string
+}
+
+//ListResult is one page of receivers. NextMarker is empty on the last page.
+type ListResult struct {
+	Receivers  []*Receiver
+	NextMarker string
+	Total      int
+}
+
+//Validate checks the options and fills in defaults
+func (o *ListOptions) Validate() error {
+	switch o.Sort {
+	case "":
+		o.Sort = "created"
+	case "name", "created":
+	default:
+		return fmt.Errorf("Invalid sort %v, must be name or created", o.Sort)
+	}
+
+	switch o.Order {
+	case "":
+		o.Order = "asc"
+	case "asc", "desc":
+	default:
+		return fmt.Errorf("Invalid order %v, must be asc or desc", o.Order)
+	}
+
+	if o.Limit == 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit < 0 || o.Limit > MaxListLimit {
+		return fmt.Errorf("Invalid limit %v, must be between 1 and %v", o.Limit, MaxListLimit)
+	}
+
+	if _, err := parseMarker(o.Marker); err != nil {
+		return err
+	}
+	return nil
+}
+
+//applyListOptions filters, sorts and pages receivers. Stores that can't push these down to their
+//backend use it on the full set of a project's receivers.
+func applyListOptions(receivers []*Receiver, opts ListOptions) (*ListResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	matched := []*Receiver{}
+	for _, receiver := range receivers {
+		if opts.Driver != "" && receiver.Driver != opts.Driver {
+			continue
+		}
+		if opts.NamePrefix != "" && !strings.HasPrefix(receiver.Name, opts.NamePrefix) {
+			continue
+		}
+		if opts.State != "" && receiver.State != opts.State {
+			continue
+		}
+		matched = append(matched, receiver)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if opts.Order == "desc" {
+			a, b = b, a
+		}
+		if opts.Sort == "name" && a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return lessID(a.ID, b.ID)
+	})
+
+	offset, _ := parseMarker(opts.Marker)
+	result := &ListResult{
+		Receivers: []*Receiver{},
+		Total:     len(matched),
+	}
+	if offset >= len(matched) {
+		return result, nil
+	}
+
+	end := offset + opts.Limit
+	if end < len(matched) {
+		result.NextMarker = "m" + strconv.Itoa(end)
+	} else {
+		end = len(matched)
+	}
+	result.Receivers = matched[offset:end]
+	return result, nil
+}
+
+//parseMarker decodes the opaque marker handed out as NextMarker
+func parseMarker(marker string) (int, error) {
+	if marker == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(marker, "m"))
+	if err != nil || !strings.HasPrefix(marker, "m") || offset < 0 {
+		return 0, fmt.Errorf("Invalid marker %v", marker)
+	}
+	return offset, nil
+}
+
+//lessID orders ids such as 9 and 10, or Cattle's 1go9 and 1go10, by their numeric part
+func lessID(a string, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
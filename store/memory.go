@@ -0,0 +1,240 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//MemoryStore keeps receivers in process memory. It is meant for tests and single-instance trials,
+//everything is lost on restart.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	receivers map[string]*Receiver
+	lastID    int64
+
+	templates      map[string]*Template
+	lastTemplateID int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		receivers: map[string]*Receiver{},
+		templates: map[string]*Template{},
+	}
+}
+
+func (s *MemoryStore) Create(receiver *Receiver) (*Receiver, error) {
+	created, err := copyReceiver(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.receivers {
+		if existing.ProjectID == created.ProjectID && existing.Name == created.Name {
+			return nil, &ConflictError{Name: created.Name}
+		}
+	}
+	s.lastID++
+	created.ID = strconv.FormatInt(s.lastID, 10)
+	created.State = "active"
+	if created.Created.IsZero() {
+		created.Created = time.Now().UTC()
+	}
+	s.receivers[created.ID] = created
+	return copyReceiver(created)
+}
+
+func (s *MemoryStore) Update(receiver *Receiver) (*Receiver, error) {
+	updated, err := copyReceiver(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.receivers[updated.ID]
+	if !ok || existing.ProjectID != updated.ProjectID {
+		return nil, notFoundByID(updated.ProjectID, updated.ID)
+	}
+	for _, other := range s.receivers {
+		if other.ID != updated.ID && other.ProjectID == updated.ProjectID && other.Name == updated.Name {
+			return nil, &ConflictError{Name: updated.Name}
+		}
+	}
+	updated.Key = existing.Key
+	updated.State = existing.State
+	updated.Created = existing.Created
+	s.receivers[updated.ID] = updated
+	return copyReceiver(updated)
+}
+
+func (s *MemoryStore) Get(projectID string, id string) (*Receiver, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	receiver, ok := s.receivers[id]
+	if !ok || receiver.ProjectID != projectID {
+		return nil, notFoundByID(projectID, id)
+	}
+	return copyReceiver(receiver)
+}
+
+func (s *MemoryStore) GetByKey(projectID string, key string) (*Receiver, error) {
+	receiver := s.find(projectID, func(r *Receiver) bool { return key != "" && r.Key == key })
+	if receiver == nil {
+		return nil, notFoundByKey(projectID)
+	}
+	return copyReceiver(receiver)
+}
+
+func (s *MemoryStore) GetByName(projectID string, name string) (*Receiver, error) {
+	receiver := s.find(projectID, func(r *Receiver) bool { return r.Name == name })
+	if receiver == nil {
+		return nil, notFoundByName(projectID, name)
+	}
+	return copyReceiver(receiver)
+}
+
+func (s *MemoryStore) List(projectID string, opts ListOptions) (*ListResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	receivers := []*Receiver{}
+	for _, receiver := range s.sorted() {
+		if receiver.ProjectID != projectID {
+			continue
+		}
+		copied, err := copyReceiver(receiver)
+		if err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, copied)
+	}
+	return applyListOptions(receivers, opts)
+}
+
+func (s *MemoryStore) Delete(projectID string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	receiver, ok := s.receivers[id]
+	if !ok || receiver.ProjectID != projectID {
+		return notFoundByID(projectID, id)
+	}
+	delete(s.receivers, id)
+	return nil
+}
+
+func (s *MemoryStore) find(projectID string, match func(*Receiver) bool) *Receiver {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, receiver := range s.sorted() {
+		if receiver.ProjectID == projectID && match(receiver) {
+			return receiver
+		}
+	}
+	return nil
+}
+
+//sorted returns receivers in creation order. Callers must hold the lock.
+func (s *MemoryStore) sorted() []*Receiver {
+	receivers := make([]*Receiver, 0, len(s.receivers))
+	for _, receiver := range s.receivers {
+		receivers = append(receivers, receiver)
+	}
+	sort.Slice(receivers, func(i, j int) bool {
+		return lessID(receivers[i].ID, receivers[j].ID)
+	})
+	return receivers
+}
+
+func (s *MemoryStore) CreateTemplate(template *Template) (*Template, error) {
+	created, err := copyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.templates {
+		if existing.Name == created.Name {
+			return nil, &TemplateConflictError{Name: created.Name}
+		}
+	}
+	s.lastTemplateID++
+	created.ID = "t" + strconv.FormatInt(s.lastTemplateID, 10)
+	if created.Created.IsZero() {
+		created.Created = time.Now().UTC()
+	}
+	s.templates[created.ID] = created
+	return copyTemplate(created)
+}
+
+func (s *MemoryStore) GetTemplate(id string) (*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	template, ok := s.templates[id]
+	if !ok {
+		return nil, &TemplateNotFoundError{ID: id}
+	}
+	return copyTemplate(template)
+}
+
+func (s *MemoryStore) ListTemplates() ([]*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	templates := []*Template{}
+	for _, template := range s.sortedTemplates() {
+		copied, err := copyTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, copied)
+	}
+	return templates, nil
+}
+
+func (s *MemoryStore) UpdateTemplate(template *Template) (*Template, error) {
+	updated, err := copyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.templates[updated.ID]
+	if !ok {
+		return nil, &TemplateNotFoundError{ID: updated.ID}
+	}
+	for _, other := range s.templates {
+		if other.ID != updated.ID && other.Name == updated.Name {
+			return nil, &TemplateConflictError{Name: updated.Name}
+		}
+	}
+	updated.Created = existing.Created
+	s.templates[updated.ID] = updated
+	return copyTemplate(updated)
+}
+
+func (s *MemoryStore) DeleteTemplate(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[id]; !ok {
+		return &TemplateNotFoundError{ID: id}
+	}
+	delete(s.templates, id)
+	return nil
+}
+
+//sortedTemplates returns templates in creation order. Callers must hold the lock.
+func (s *MemoryStore) sortedTemplates() []*Template {
+	templates := make([]*Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return lessID(templates[i].ID, templates[j].ID)
+	})
+	return templates
+}
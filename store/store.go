@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v2"
+	"github.com/rancher/webhook-service/model"
+)
+
+const receiverKind = "webhookReceiver"
+
+//Receiver is a webhook receiver as persisted by a ReceiverStore
+type Receiver struct {
+	ID        string      `json:"id"`
+	ProjectID string      `json:"projectId"`
+	Name      string      `json:"name"`
+	Key       string      `json:"key"`
+	Driver    string      `json:"driver"`
+	URL       string      `json:"url"`
+	State     string      `json:"state"`
+	Created   time.Time   `json:"created"`
+	Config    interface{} `json:"config"`
+
+	//AllowedCIDRs restricts the addresses the receiver URL may be called from, any address is
+	//allowed when empty
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+	//Condition must be true for a call's body for the driver to run
+	Condition string `json:"condition,omitempty"`
+	//Transform maps driver config fields to expressions picking their value out of a call's body
+	Transform map[string]string `json:"transform,omitempty"`
+	//Overrides lists the driver config fields a call's body may set, and the values it may set them to
+	Overrides map[string]model.OverrideBounds `json:"overrides,omitempty"`
+
+	//TemplateID and TemplateVersion are set on receivers instantiated from a receiver template, and
+	//TemplateVariables are the variables it was instantiated with
+	TemplateID        string            `json:"templateId,omitempty"`
+	TemplateVersion   int64             `json:"templateVersion,omitempty"`
+	TemplateVariables map[string]string `json:"templateVariables,omitempty"`
+
+	//Error is set, and State is error, when the stored record could not be decoded
+	Error string `json:"error,omitempty"`
+}
+
+//ReceiverStore persists receivers. Every operation is scoped to a single project. Lookups return a
+//*NotFoundError when nothing matches, Create and Update return a *ConflictError for a duplicate name
+//and records that can't be decoded are reported with a *CorruptError.
+type ReceiverStore interface {
+	Create(receiver *Receiver) (*Receiver, error)
+	//Update replaces the receiver with the same ID. Its key and creation time are kept.
+	Update(receiver *Receiver) (*Receiver, error)
+	Get(projectID string, id string) (*Receiver, error)
+	GetByKey(projectID string, key string) (*Receiver, error)
+	GetByName(projectID string, name string) (*Receiver, error)
+	List(projectID string, opts ListOptions) (*ListResult, error)
+	Delete(projectID string, id string) error
+}
+
+//ClientGetter returns a Rancher API client scoped to a project
+type ClientGetter interface {
+	GetClient(projectID string) (*client.RancherClient, error)
+}
+
+//New builds the store selected by backend. path is only used by the bolt backend.
+func New(backend string, path string, clients ClientGetter) (ReceiverStore, error) {
+	switch backend {
+	case "", "cattle":
+		return NewGenericObjectStore(clients), nil
+	case "bolt":
+		if path == "" {
+			return nil, fmt.Errorf("A file path is required for the bolt receiver store")
+		}
+		return NewBoltStore(path)
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("Unknown receiver store %v", backend)
+}
+
+//Migrate copies the receivers of the given projects from one store to another. Receivers whose
+//key already exists in the destination are skipped, so a migration can be safely re-run.
+func Migrate(from ReceiverStore, to ReceiverStore, projectIDs []string) (int, error) {
+	copied := 0
+	for _, projectID := range projectIDs {
+		receivers, err := ListAll(from, projectID)
+		if err != nil {
+			return copied, fmt.Errorf("Error listing receivers of project %s: %v", projectID, err)
+		}
+
+		for _, receiver := range receivers {
+			if receiver.Error != "" {
+				logrus.Warnf("Not copying receiver %s because: %v", receiver.ID, receiver.Error)
+				continue
+			}
+
+			_, err := to.GetByKey(projectID, receiver.Key)
+			if err == nil {
+				continue
+			}
+			if !IsNotFound(err) {
+				return copied, fmt.Errorf("Error looking up receiver %s in destination: %v", receiver.Name, err)
+			}
+
+			if _, err := to.Create(receiver); err != nil {
+				return copied, fmt.Errorf("Error copying receiver %s: %v", receiver.Name, err)
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
+
+//ListAll returns every receiver of a project, reading the store page by page
+func ListAll(s ReceiverStore, projectID string) ([]*Receiver, error) {
+	receivers := []*Receiver{}
+	opts := ListOptions{Limit: MaxListLimit}
+	for {
+		page, err := s.List(projectID, opts)
+		if err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, page.Receivers...)
+		if page.NextMarker == "" {
+			return receivers, nil
+		}
+		opts.Marker = page.NextMarker
+	}
+}
+
+//copyReceiver round-trips a receiver through JSON so stores never share config maps with callers,
+//and configs come back in the same map form they have after being read from Cattle
+func copyReceiver(receiver *Receiver) (*Receiver, error) {
+	bytes, err := json.Marshal(receiver)
+	if err != nil {
+		return nil, err
+	}
+	copied := &Receiver{}
+	if err := json.Unmarshal(bytes, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
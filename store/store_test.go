@@ -0,0 +1,352 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/rancher/webhook-service/testutils"
+)
+
+func testReceiverStore(t *testing.T, s ReceiverStore) {
+	created, err := s.Create(&Receiver{
+		ProjectID: "1a1",
+		Name:      "wh-name",
+		Key:       "key1",
+		Driver:    "scaleService",
+		URL:       "http://localhost/v1-webhooks/endpoint?key=key1&projectId=1a1",
+		Config:    map[string]interface{}{"serviceId": "1s1", "amount": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.State != "active" || created.Created.IsZero() {
+		t.Fatalf("Unexpected created receiver: %#v", created)
+	}
+
+	if _, err := s.Create(&Receiver{ProjectID: "1a2", Name: "other", Key: "key2", Driver: "scaleService"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get("1a1", created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Name != "wh-name" || got.Config.(map[string]interface{})["serviceId"] != "1s1" {
+		t.Fatalf("Unexpected receiver: %#v", got)
+	}
+
+	if got, err := s.Get("1a2", created.ID); !IsNotFound(err) {
+		t.Fatalf("Receiver must not be visible from another project: %#v %v", got, err)
+	}
+
+	if _, err := s.Create(&Receiver{ProjectID: "1a1", Name: "wh-name", Key: "key4"}); !IsConflict(err) {
+		t.Fatalf("Expected conflict for duplicate name, got %v", err)
+	}
+
+	if got, err := s.GetByKey("1a1", ""); !IsNotFound(err) {
+		t.Fatalf("Empty key must not match: %#v %v", got, err)
+	}
+
+	if got, err := s.GetByKey("1a1", "key1"); err != nil || got == nil || got.ID != created.ID {
+		t.Fatalf("Lookup by key failed: %#v %v", got, err)
+	}
+
+	if got, err := s.GetByName("1a1", "wh-name"); err != nil || got == nil || got.ID != created.ID {
+		t.Fatalf("Lookup by name failed: %#v %v", got, err)
+	}
+
+	update := *got
+	update.Name = "wh-renamed"
+	update.Key = "changed"
+	update.Config = map[string]interface{}{"serviceId": "1s1", "amount": 2}
+	update.Condition = "body.status == 'firing'"
+	update.TemplateID, update.TemplateVersion = "t1", 3
+	update.TemplateVariables = map[string]string{"stack": "web"}
+	updated, err := s.Update(&update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || updated.Key != "key1" || updated.Name != "wh-renamed" {
+		t.Fatalf("Unexpected updated receiver: %#v", updated)
+	}
+	if got, err := s.GetByKey("1a1", "key1"); err != nil || got.Name != "wh-renamed" ||
+		got.Condition != update.Condition || got.TemplateVersion != 3 ||
+		got.TemplateVariables["stack"] != "web" || got.Config.(map[string]interface{})["amount"] != float64(2) {
+		t.Fatalf("Update not stored: %#v %v", got, err)
+	}
+
+	other, err := s.Create(&Receiver{ProjectID: "1a1", Name: "wh-other", Key: "key5", Driver: "scaleService"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update.Name = "wh-other"
+	if _, err := s.Update(&update); !IsConflict(err) {
+		t.Fatalf("Expected conflict for renaming to a taken name, got %v", err)
+	}
+	if err := s.Delete("1a1", other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update(&Receiver{ID: created.ID, ProjectID: "1a2", Name: "x"}); !IsNotFound(err) {
+		t.Fatalf("Receiver must not be updated from another project: %v", err)
+	}
+
+	list, err := s.List("1a1", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Receivers) != 1 || list.Receivers[0].ID != created.ID {
+		t.Fatalf("Unexpected list: %#v", list)
+	}
+
+	if err := s.Delete("1a1", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("1a1", created.ID); !IsNotFound(err) {
+		t.Fatalf("Receiver not deleted: %#v %v", got, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testReceiverStore(t, NewMemoryStore())
+}
+
+func TestGenericObjectStore(t *testing.T) {
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	testReceiverStore(t, NewGenericObjectStore(server))
+
+	//Objects of other kinds stored as genericObjects aren't receivers
+	server.Add("1a1", "genericObject", map[string]interface{}{"kind": "other", "name": "not-a-receiver"})
+	list, err := NewGenericObjectStore(server).List("1a1", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Receivers) != 0 {
+		t.Fatalf("Unexpected receivers %#v", list.Receivers)
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "receiver-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "receivers.db")
+
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testReceiverStore(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	list, err := reopened.List("1a2", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Receivers) != 1 || list.Receivers[0].Name != "other" {
+		t.Fatalf("Receivers not persisted: %#v", list)
+	}
+
+	created, err := reopened.Create(&Receiver{ProjectID: "1a2", Name: "third", Key: "key3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "4" {
+		t.Fatalf("IDs must not be reused after reopening, got %v", created.ID)
+	}
+
+	err = reopened.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(projectsBucket).Bucket([]byte("1a2")).Bucket(receiversBucket).Put(idKey(created.ID), []byte("{"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err = reopened.List("1a2", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Receivers) != 2 || list.Receivers[0].ID != created.ID || list.Receivers[0].State != "error" {
+		t.Fatalf("Corrupt receiver not listed in error state: %#v", list.Receivers)
+	}
+	if err := reopened.Delete("1a2", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Create(&Receiver{ProjectID: "1a2", Name: "third", Key: "key3"}); err != nil {
+		t.Fatalf("Name of a deleted corrupt receiver not released: %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	from := NewMemoryStore()
+	to := NewMemoryStore()
+	for _, key := range []string{"key1", "key2"} {
+		if _, err := from.Create(&Receiver{ProjectID: "1a1", Name: key, Key: key, Driver: "scaleService"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copied, err := Migrate(from, to, []string{"1a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 2 {
+		t.Fatalf("Expected 2 receivers copied, got %d", copied)
+	}
+
+	copied, err = Migrate(from, to, []string{"1a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 0 {
+		t.Fatalf("Expected re-run to skip existing receivers, copied %d", copied)
+	}
+
+	migrated, err := to.GetByKey("1a1", "key2")
+	if err != nil || migrated == nil || migrated.Name != "key2" {
+		t.Fatalf("Receiver key not preserved: %#v %v", migrated, err)
+	}
+}
+
+func TestListOptions(t *testing.T) {
+	s := NewMemoryStore()
+	for _, name := range []string{"web-c", "web-a", "db-b", "web-b"} {
+		driver := "scaleService"
+		if name == "web-b" {
+			driver = "scaleHost"
+		}
+		if _, err := s.Create(&Receiver{ProjectID: "1a1", Name: name, Key: name, Driver: driver}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(result *ListResult) []string {
+		n := []string{}
+		for _, r := range result.Receivers {
+			n = append(n, r.Name)
+		}
+		return n
+	}
+
+	tests := []struct {
+		opts  ListOptions
+		names []string
+		next  string
+	}{
+		{ListOptions{}, []string{"web-c", "web-a", "db-b", "web-b"}, ""},
+		{ListOptions{Sort: "name"}, []string{"db-b", "web-a", "web-b", "web-c"}, ""},
+		{ListOptions{Sort: "name", Order: "desc"}, []string{"web-c", "web-b", "web-a", "db-b"}, ""},
+		{ListOptions{Sort: "name", Limit: 3}, []string{"db-b", "web-a", "web-b"}, "m3"},
+		{ListOptions{Sort: "name", Limit: 3, Marker: "m3"}, []string{"web-c"}, ""},
+		{ListOptions{NamePrefix: "web-", Driver: "scaleService"}, []string{"web-c", "web-a"}, ""},
+		{ListOptions{State: "error"}, []string{}, ""},
+	}
+	for _, test := range tests {
+		result, err := s.List("1a1", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(names(result)) != fmt.Sprint(test.names) || result.NextMarker != test.next {
+			t.Errorf("List(%#v) = %v next %q, expected %v next %q", test.opts, names(result), result.NextMarker, test.names, test.next)
+		}
+	}
+
+	for _, opts := range []ListOptions{{Sort: "random"}, {Order: "up"}, {Limit: -1}, {Limit: MaxListLimit + 1}, {Marker: "bad"}} {
+		if _, err := s.List("1a1", opts); err == nil {
+			t.Errorf("Expected error for %#v", opts)
+		}
+	}
+}
+
+func testTemplateStore(t *testing.T, s TemplateStore) {
+	created, err := s.CreateTemplate(&Template{
+		Name:       "autoscaler",
+		Definition: map[string]interface{}{"driver": "scaleService"},
+		Version:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Created.IsZero() {
+		t.Fatalf("Unexpected created template: %#v", created)
+	}
+	if _, err := s.CreateTemplate(&Template{Name: "autoscaler", Definition: map[string]interface{}{}}); err == nil {
+		t.Fatal("Expected conflict for duplicate template name")
+	}
+
+	update := *created
+	update.Version = 2
+	update.Projects = []string{"1a1", "1a2"}
+	if _, err := s.UpdateTemplate(&update); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTemplate(created.ID)
+	if err != nil || got.Version != 2 || len(got.Projects) != 2 || got.Definition["driver"] != "scaleService" {
+		t.Fatalf("Update not stored: %#v %v", got, err)
+	}
+
+	templates, err := s.ListTemplates()
+	if err != nil || len(templates) != 1 || templates[0].ID != created.ID {
+		t.Fatalf("Unexpected templates: %#v %v", templates, err)
+	}
+
+	if err := s.DeleteTemplate(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetTemplate(created.ID); !IsTemplateNotFound(err) {
+		t.Fatalf("Template not deleted: %v", err)
+	}
+}
+
+func TestTemplateStores(t *testing.T) {
+	testTemplateStore(t, NewMemoryStore())
+
+	server := testutils.NewCattleServer()
+	defer server.Close()
+	testTemplateStore(t, NewGenericObjectTemplateStore(server, "1a9"))
+	//Templates aren't receivers of the project they're kept in
+	if _, err := NewGenericObjectTemplateStore(server, "1a9").CreateTemplate(&Template{Name: "t", Definition: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := NewGenericObjectStore(server).List("1a9", ListOptions{}); err != nil || len(list.Receivers) != 0 {
+		t.Fatalf("Unexpected receivers %#v %v", list, err)
+	}
+
+	dir, err := ioutil.TempDir("", "template-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "receivers.db")
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTemplateStore(t, s)
+	if _, err := s.CreateTemplate(&Template{Name: "kept", Definition: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if templates, err := reopened.ListTemplates(); err != nil || len(templates) != 1 || templates[0].Name != "kept" {
+		t.Fatalf("Templates not persisted: %#v %v", templates, err)
+	}
+}
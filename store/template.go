@@ -0,0 +1,66 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const templateKind = "webhookReceiverTemplate"
+
+//Template is a receiver definition shared by projects. Its Definition is a receiver as the import
+//action takes it, whose strings may hold placeholders that are resolved in each project the
+//template is instantiated in.
+type Template struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Definition  map[string]interface{} `json:"definition"`
+	//Version goes up on every change of the definition. Receivers record the version they were
+	//instantiated from, so the ones behind can be found.
+	Version int64 `json:"version"`
+	//Projects are the projects the template was instantiated in
+	Projects []string  `json:"projects,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+//TemplateStore persists receiver templates. Templates aren't scoped to a project. Lookups return a
+//*TemplateNotFoundError when nothing matches, and a duplicate name is a *TemplateConflictError.
+type TemplateStore interface {
+	CreateTemplate(template *Template) (*Template, error)
+	GetTemplate(id string) (*Template, error)
+	ListTemplates() ([]*Template, error)
+	//UpdateTemplate replaces the template with the same ID. Its creation time is kept.
+	UpdateTemplate(template *Template) (*Template, error)
+	DeleteTemplate(id string) error
+}
+
+//NewTemplateStore builds the template store of a receiver store backend. The bolt and memory
+//backends keep templates next to receivers. Cattle has no scope above projects, so the cattle
+//backend keeps them as GenericObjects of projectID, and templates are disabled when it's empty.
+func NewTemplateStore(backend string, receivers ReceiverStore, clients ClientGetter, projectID string) (TemplateStore, error) {
+	if templates, ok := receivers.(TemplateStore); ok {
+		return templates, nil
+	}
+	switch backend {
+	case "", "cattle":
+		if projectID == "" {
+			return nil, nil
+		}
+		return NewGenericObjectTemplateStore(clients, projectID), nil
+	}
+	return nil, fmt.Errorf("Receiver store %v can't keep receiver templates", backend)
+}
+
+//copyTemplate round-trips a template through JSON so stores never share definitions with callers
+func copyTemplate(template *Template) (*Template, error) {
+	bytes, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	copied := &Template{}
+	if err := json.Unmarshal(bytes, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
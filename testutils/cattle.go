@@ -0,0 +1,700 @@
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/go-rancher/v2"
+)
+
+//cattleType describes a resource type served by CattleServer
+type cattleType struct {
+	plural   string
+	idPrefix string
+	//resource is the go-rancher struct whose fields make up the schema
+	resource interface{}
+	//extraFields are creatable fields that go-rancher's struct doesn't have, like machine driver configs
+	extraFields []string
+}
+
+var cattleTypes = map[string]cattleType{
+	"service":           {plural: "services", idPrefix: "1s", resource: client.Service{}},
+	"host":              {plural: "hosts", idPrefix: "1h", resource: client.Host{}, extraFields: []string{"amazonec2Config", "digitaloceanConfig", "packetConfig"}},
+	"hostTemplate":      {plural: "hostTemplates", idPrefix: "1ht", resource: client.HostTemplate{}},
+	"genericObject":     {plural: "genericObjects", idPrefix: "1go", resource: client.GenericObject{}},
+	"container":         {plural: "containers", idPrefix: "1i", resource: client.Container{}},
+	"externalHostEvent": {plural: "externalHostEvents", idPrefix: "1ev", resource: client.ExternalHostEvent{}},
+	"stack":             {plural: "stacks", idPrefix: "1st", resource: client.Stack{}},
+}
+
+//readOnlyFields are set by Cattle and can't be given on create
+var readOnlyFields = map[string]bool{
+	"id": true, "uuid": true, "state": true, "created": true, "createdTS": true, "removed": true,
+	"removeTime": true, "transitioning": true, "transitioningMessage": true, "transitioningProgress": true,
+	"accountId": true, "agentState": true, "agentId": true, "agentIpAddress": true, "computeTotal": true,
+	"info": true, "instanceIds": true, "physicalHostId": true, "publicEndpoints": true, "currentScale": true,
+	"upgrade": true, "healthState": true,
+}
+
+//transition is a state change a resource is in the middle of
+type transition struct {
+	//reads is how many more times the resource is read before it settles
+	reads int
+	state string
+	//err makes the transition end in error with this message instead of reaching state
+	err string
+	//done runs when the transition settles, with the server locked
+	done func()
+}
+
+type failure struct {
+	status  int
+	message string
+}
+
+//CattleServer is an in-process fake of the parts of the Cattle v2-beta API that the drivers and the
+//receiver store use. It serves schemas, stacks, services, hosts, hostTemplates, genericObjects,
+//containers and externalHostEvents, with the upgrade, finishupgrade, deactivate, activate and evacuate actions.
+//Changes go through transitioning states the way Cattle's do, and any operation can be made to fail.
+//Resources are scoped to the project in the request path, /v2-beta/projects/<projectId>.
+type CattleServer struct {
+	*httptest.Server
+
+	//TransitionReads is how many times a resource is read after a change before it settles in its
+	//new state. With 1, the response to the change shows it transitioning and the next read settled.
+	TransitionReads int
+
+	mu                 sync.Mutex
+	resources          map[string]map[string]map[string]interface{}
+	transitions        map[string]*transition
+	failures           map[string]failure
+	transitionFailures map[string]string
+	requests           []string
+	lastID             int
+	//started is when the server started, resources are created a millisecond apart from then
+	started time.Time
+}
+
+//NewCattleServer starts a fake Cattle. Close it when done.
+func NewCattleServer() *CattleServer {
+	s := &CattleServer{
+		TransitionReads:    1,
+		started:            time.Now().UTC(),
+		resources:          map[string]map[string]map[string]interface{}{},
+		transitions:        map[string]*transition{},
+		failures:           map[string]failure{},
+		transitionFailures: map[string]string{},
+	}
+	for resourceType := range cattleTypes {
+		s.resources[resourceType] = map[string]map[string]interface{}{}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+//ProjectURL is the base URL of a project's API
+func (s *CattleServer) ProjectURL(projectID string) string {
+	return s.URL + "/v2-beta/projects/" + projectID
+}
+
+//GetClient returns a client of a project, the same way the service's ClientFactory builds them
+func (s *CattleServer) GetClient(projectID string) (*client.RancherClient, error) {
+	return client.NewRancherClient(&client.ClientOpts{
+		Url:     s.ProjectURL(projectID) + "/schemas",
+		Timeout: 5 * time.Second,
+	})
+}
+
+//Invalidate does nothing, the fake's clients aren't cached. With GetClient and Ping it lets the
+//server stand in for the service's client factory.
+func (s *CattleServer) Invalidate(projectID string) {}
+
+//Ping checks that the server answers
+func (s *CattleServer) Ping() error {
+	response, err := http.Get(s.URL + "/v2-beta")
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Cattle returned %d", response.StatusCode)
+	}
+	return nil
+}
+
+//Add stores a resource of a project as if it had been created and settled. Missing id, state,
+//created and transitioning fields are filled in. It returns the resource's id.
+func (s *CattleServer) Add(projectID string, resourceType string, resource map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resource = copyResource(resource)
+	resource["accountId"] = projectID
+	if _, ok := resource["state"]; !ok {
+		resource["state"] = "active"
+	}
+	return s.store(resourceType, resource)
+}
+
+//Get returns a copy of a resource, or nil if it doesn't exist
+func (s *CattleServer) Get(resourceType string, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resource, ok := s.resources[resourceType][id]
+	if !ok {
+		return nil
+	}
+	return copyResource(resource)
+}
+
+//List returns copies of all resources of a type, in the order they were created
+func (s *CattleServer) List(resourceType string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := []map[string]interface{}{}
+	for _, resource := range s.sorted(resourceType, "", false) {
+		result = append(result, copyResource(resource))
+	}
+	return result
+}
+
+//Fail makes every following request for operation on resourceType fail with status. Operations are
+//list, get, create, update, delete and action names such as upgrade.
+func (s *CattleServer) Fail(resourceType string, operation string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[resourceType+"."+operation] = failure{
+		status:  status,
+		message: fmt.Sprintf("Injected failure of %s %s", operation, resourceType),
+	}
+}
+
+//FailResource makes every following update of one resource fail with status, so a test can fail
+//one step of a driver working on several resources
+func (s *CattleServer) FailResource(resourceType string, id string, status int) {
+	s.Fail(resourceType+"/"+id, "update", status)
+}
+
+//FailResourceAction makes every following action of one resource fail with status
+func (s *CattleServer) FailResourceAction(resourceType string, id string, action string, status int) {
+	s.Fail(resourceType+"/"+id, action, status)
+}
+
+//FailTransition makes the transitions started by operation on resourceType end in error with
+//message, the way a failed upgrade or host provisioning does
+func (s *CattleServer) FailTransition(resourceType string, operation string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transitionFailures[resourceType+"."+operation] = message
+}
+
+//Recover clears all failures set with Fail and FailTransition
+func (s *CattleServer) Recover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = map[string]failure{}
+	s.transitionFailures = map[string]string{}
+}
+
+//Requests returns the operations served so far, such as "update service 1s1" or
+//"upgrade service 1s1". Reads aren't included.
+func (s *CattleServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *CattleServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if !strings.HasPrefix(path, "/v2-beta") {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	base := s.URL + "/v2-beta"
+	parts := strings.Split(strings.TrimPrefix(path, "/v2-beta"), "/")[1:]
+	projectID := ""
+	if len(parts) >= 2 && parts[0] == "projects" {
+		projectID = parts[1]
+		base += "/projects/" + projectID
+		parts = parts[2:]
+	}
+
+	if len(parts) == 0 {
+		w.Header().Set("X-API-Schemas", base+"/schemas")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"type": "apiVersion", "links": map[string]string{"schemas": base + "/schemas"}})
+		return
+	}
+	if len(parts) == 1 && parts[0] == "schemas" {
+		w.Header().Set("X-API-Schemas", base+"/schemas")
+		writeJSON(w, http.StatusOK, s.schemas(base))
+		return
+	}
+
+	resourceType := ""
+	for name, t := range cattleTypes {
+		if strings.EqualFold(t.plural, parts[0]) {
+			resourceType = name
+		}
+	}
+	if resourceType == "" || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			s.list(w, r, base, projectID, resourceType)
+		case "POST":
+			s.create(w, r, base, projectID, resourceType)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	resource, ok := s.resources[resourceType][parts[1]]
+	if !ok || (projectID != "" && resource["accountId"] != projectID) {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	action := r.URL.Query().Get("action")
+	switch {
+	case r.Method == "GET":
+		if s.failed(w, resourceType, "get") {
+			return
+		}
+		s.read(resourceType, resource)
+		writeJSON(w, http.StatusOK, s.view(base, resourceType, resource))
+	case r.Method == "PUT":
+		s.update(w, r, base, resourceType, resource)
+	case r.Method == "DELETE":
+		s.delete(w, base, resourceType, resource)
+	case r.Method == "POST" && action != "":
+		s.action(w, r, base, resourceType, resource, action)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *CattleServer) list(w http.ResponseWriter, r *http.Request, base string, projectID string, resourceType string) {
+	if s.failed(w, resourceType, "list") {
+		return
+	}
+	query := r.URL.Query()
+	data := []interface{}{}
+	for _, resource := range s.sorted(resourceType, query.Get("sort"), query.Get("order") == "desc") {
+		if projectID != "" && resource["accountId"] != projectID {
+			continue
+		}
+		s.read(resourceType, resource)
+		if matchesFilters(resource, query) {
+			data = append(data, s.view(base, resourceType, resource))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"type":         "collection",
+		"resourceType": resourceType,
+		"links":        map[string]string{"self": base + "/" + cattleTypes[resourceType].plural},
+		"data":         data,
+	})
+}
+
+func (s *CattleServer) create(w http.ResponseWriter, r *http.Request, base string, projectID string, resourceType string) {
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid body: %v", err))
+		return
+	}
+	if s.failed(w, resourceType, "create") {
+		return
+	}
+	resource := map[string]interface{}{}
+	for k, v := range body {
+		if !readOnlyFields[k] {
+			resource[k] = v
+		}
+	}
+	resource["accountId"] = projectID
+	id := s.store(resourceType, resource)
+	s.requests = append(s.requests, fmt.Sprintf("create %s %s", resourceType, id))
+
+	switch resourceType {
+	case "host":
+		s.transition(resourceType, resource, "create", "provisioning", "active", nil)
+	case "externalHostEvent":
+		resource["state"] = "created"
+		s.hostEvent(resource)
+	default:
+		resource["state"] = "active"
+	}
+	writeJSON(w, http.StatusCreated, s.view(base, resourceType, resource))
+}
+
+func (s *CattleServer) update(w http.ResponseWriter, r *http.Request, base string, resourceType string, resource map[string]interface{}) {
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid body: %v", err))
+		return
+	}
+	id, _ := resource["id"].(string)
+	if s.failed(w, resourceType, "update") || s.failed(w, resourceType+"/"+id, "update") {
+		return
+	}
+	s.requests = append(s.requests, fmt.Sprintf("update %s %s", resourceType, id))
+	for k, v := range body {
+		if !readOnlyFields[k] {
+			resource[k] = v
+		}
+	}
+	if resourceType == "service" {
+		if scale, ok := body["scale"]; ok {
+			resource["currentScale"] = scale
+		}
+		s.transition(resourceType, resource, "update", "updating-active", "active", nil)
+	}
+	writeJSON(w, http.StatusOK, s.view(base, resourceType, resource))
+}
+
+func (s *CattleServer) delete(w http.ResponseWriter, base string, resourceType string, resource map[string]interface{}) {
+	if s.failed(w, resourceType, "delete") {
+		return
+	}
+	id, _ := resource["id"].(string)
+	s.requests = append(s.requests, fmt.Sprintf("delete %s %s", resourceType, id))
+	if resourceType == "genericObject" {
+		delete(s.resources[resourceType], id)
+		resource["state"] = "removed"
+		writeJSON(w, http.StatusOK, s.view(base, resourceType, resource))
+		return
+	}
+	s.transition(resourceType, resource, "delete", "removing", "removed", func() {
+		resource["removed"] = time.Now().UTC().Format(time.RFC3339)
+	})
+	writeJSON(w, http.StatusOK, s.view(base, resourceType, resource))
+}
+
+func (s *CattleServer) action(w http.ResponseWriter, r *http.Request, base string, resourceType string,
+	resource map[string]interface{}, action string) {
+	if _, ok := s.actions(resourceType, resource)[action]; !ok {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Action %s not available in state %v", action, resource["state"]))
+		return
+	}
+	input := map[string]interface{}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid body: %v", err))
+			return
+		}
+	}
+	if s.failed(w, resourceType, action) || s.failed(w, fmt.Sprintf("%s/%v", resourceType, resource["id"]), action) {
+		return
+	}
+	s.requests = append(s.requests, fmt.Sprintf("%s %s %s", action, resourceType, resource["id"]))
+
+	switch action {
+	case "upgrade":
+		if strategy, ok := input["inServiceStrategy"].(map[string]interface{}); ok {
+			resource["upgrade"] = input
+			if launchConfig, ok := strategy["launchConfig"]; ok && launchConfig != nil {
+				resource["launchConfig"] = launchConfig
+			}
+			if secondary, ok := strategy["secondaryLaunchConfigs"]; ok && secondary != nil {
+				resource["secondaryLaunchConfigs"] = secondary
+			}
+		}
+		s.transition(resourceType, resource, action, "upgrading", "upgraded", nil)
+	case "finishupgrade":
+		s.transition(resourceType, resource, action, "finishing-upgrade", "active", nil)
+	case "deactivate":
+		s.transition(resourceType, resource, action, "deactivating", "inactive", nil)
+	case "activate":
+		s.transition(resourceType, resource, action, "activating", "active", nil)
+	case "evacuate":
+		id, _ := resource["id"].(string)
+		s.evacuate(id)
+	}
+	writeJSON(w, http.StatusAccepted, s.view(base, resourceType, resource))
+}
+
+//hostEvent applies an externalHostEvent. host.evacuate events evacuate the host's containers and
+//with deleteHost remove the host.
+func (s *CattleServer) hostEvent(event map[string]interface{}) {
+	hostID, _ := event["hostId"].(string)
+	if event["eventType"] != "host.evacuate" || hostID == "" {
+		return
+	}
+	s.evacuate(hostID)
+	host, ok := s.resources["host"][hostID]
+	if !ok || event["deleteHost"] != true {
+		return
+	}
+	s.transition("host", host, "delete", "removing", "removed", func() {
+		host["removed"] = time.Now().UTC().Format(time.RFC3339)
+	})
+}
+
+//evacuate removes the containers of a host
+func (s *CattleServer) evacuate(hostID string) {
+	for _, container := range s.resources["container"] {
+		if container["hostId"] != hostID || container["removed"] != nil {
+			continue
+		}
+		container := container
+		s.transition("container", container, "delete", "removing", "removed", func() {
+			container["removed"] = time.Now().UTC().Format(time.RFC3339)
+		})
+	}
+}
+
+//transition starts a change of a resource from state to final. With TransitionReads of 0 it settles
+//at once.
+func (s *CattleServer) transition(resourceType string, resource map[string]interface{}, operation string,
+	state string, final string, done func()) {
+	id, _ := resource["id"].(string)
+	t := &transition{reads: s.TransitionReads, state: final, err: s.transitionFailures[resourceType+"."+operation], done: done}
+	resource["state"] = state
+	resource["transitioning"] = "yes"
+	resource["transitioningMessage"] = "In Progress"
+	s.transitions[resourceType+"/"+id] = t
+	if t.reads <= 0 {
+		s.settle(resourceType, resource)
+	}
+}
+
+//read counts a read of a resource towards settling its transition
+func (s *CattleServer) read(resourceType string, resource map[string]interface{}) {
+	id, _ := resource["id"].(string)
+	t, ok := s.transitions[resourceType+"/"+id]
+	if !ok {
+		return
+	}
+	t.reads--
+	if t.reads <= 0 {
+		s.settle(resourceType, resource)
+	}
+}
+
+func (s *CattleServer) settle(resourceType string, resource map[string]interface{}) {
+	id, _ := resource["id"].(string)
+	t := s.transitions[resourceType+"/"+id]
+	delete(s.transitions, resourceType+"/"+id)
+	if t.err != "" {
+		resource["transitioning"] = "error"
+		resource["transitioningMessage"] = t.err
+		return
+	}
+	resource["state"] = t.state
+	resource["transitioning"] = "no"
+	resource["transitioningMessage"] = ""
+	if t.done != nil {
+		t.done()
+	}
+}
+
+func (s *CattleServer) failed(w http.ResponseWriter, resourceType string, operation string) bool {
+	f, ok := s.failures[resourceType+"."+operation]
+	if !ok {
+		return false
+	}
+	s.requests = append(s.requests, fmt.Sprintf("failed %s %s", operation, resourceType))
+	writeError(w, f.status, f.message)
+	return true
+}
+
+//store assigns a new resource its id and creation time
+func (s *CattleServer) store(resourceType string, resource map[string]interface{}) string {
+	s.lastID++
+	if id, _ := resource["id"].(string); id == "" {
+		resource["id"] = fmt.Sprintf("%s%d", cattleTypes[resourceType].idPrefix, s.lastID)
+	}
+	created := s.started.Add(time.Duration(s.lastID) * time.Millisecond)
+	if value, ok := resource["created"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			created = t
+		}
+	} else {
+		resource["created"] = created.Format(time.RFC3339Nano)
+	}
+	resource["createdTS"] = float64(created.UnixNano() / int64(time.Millisecond))
+	if _, ok := resource["kind"]; !ok {
+		resource["kind"] = resourceType
+	}
+	if _, ok := resource["transitioning"]; !ok {
+		resource["transitioning"] = "no"
+	}
+	resource["type"] = resourceType
+	id := resource["id"].(string)
+	s.resources[resourceType][id] = resource
+	return id
+}
+
+//sorted returns the resources of a type by field, in creation order otherwise
+func (s *CattleServer) sorted(resourceType string, field string, desc bool) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, resource := range s.resources[resourceType] {
+		result = append(result, resource)
+	}
+	if field == "" || field == "created" {
+		field = "createdTS"
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i][field], result[j][field]
+		if desc {
+			a, b = b, a
+		}
+		if fmt.Sprint(a) == fmt.Sprint(b) {
+			return fmt.Sprint(result[i]["id"]) < fmt.Sprint(result[j]["id"])
+		}
+		if x, ok := a.(float64); ok {
+			if y, ok := b.(float64); ok {
+				return x < y
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return result
+}
+
+//view is a copy of a resource with its links and the actions available in its state
+func (s *CattleServer) view(base string, resourceType string, resource map[string]interface{}) map[string]interface{} {
+	result := copyResource(resource)
+	self := fmt.Sprintf("%s/%s/%v", base, cattleTypes[resourceType].plural, resource["id"])
+	result["links"] = map[string]string{"self": self}
+	actions := map[string]string{}
+	for action := range s.actions(resourceType, resource) {
+		actions[action] = self + "?action=" + action
+	}
+	result["actions"] = actions
+	return result
+}
+
+func (s *CattleServer) actions(resourceType string, resource map[string]interface{}) map[string]bool {
+	//Actions requested while a change is in progress are queued behind it, like Cattle does
+	actions := map[string]bool{}
+	state, _ := resource["state"].(string)
+	if t, ok := s.transitions[resourceType+"/"+fmt.Sprint(resource["id"])]; ok {
+		if t.err != "" {
+			return actions
+		}
+		state = t.state
+	}
+	switch resourceType {
+	case "service":
+		switch state {
+		case "active":
+			actions["upgrade"] = true
+		case "upgraded":
+			actions["finishupgrade"] = true
+		}
+	case "host":
+		switch state {
+		case "active":
+			actions["deactivate"] = true
+			actions["evacuate"] = true
+		case "inactive":
+			actions["activate"] = true
+			actions["evacuate"] = true
+		}
+	}
+	return actions
+}
+
+func (s *CattleServer) schemas(base string) map[string]interface{} {
+	data := []interface{}{}
+	for name, t := range cattleTypes {
+		fields := map[string]interface{}{}
+		resourceType := reflect.TypeOf(t.resource)
+		for i := 0; i < resourceType.NumField(); i++ {
+			field := strings.Split(resourceType.Field(i).Tag.Get("json"), ",")[0]
+			if field == "" || field == "-" {
+				continue
+			}
+			fields[field] = map[string]interface{}{"type": "string", "create": !readOnlyFields[field], "update": !readOnlyFields[field]}
+		}
+		for _, field := range t.extraFields {
+			fields[field] = map[string]interface{}{"type": "json", "create": true}
+		}
+		data = append(data, map[string]interface{}{
+			"id":                name,
+			"type":              "schema",
+			"pluralName":        t.plural,
+			"links":             map[string]string{"self": base + "/schemas/" + name, "collection": base + "/" + t.plural},
+			"collectionMethods": []string{"GET", "POST"},
+			"resourceMethods":   []string{"GET", "PUT", "DELETE"},
+			"resourceFields":    fields,
+		})
+	}
+	return map[string]interface{}{"type": "collection", "resourceType": "schema", "data": data}
+}
+
+//matchesFilters applies Cattle's list filters: field=value, field_null, field_ne=value and
+//field_prefix=value. Paging and sorting parameters are ignored.
+func matchesFilters(resource map[string]interface{}, query map[string][]string) bool {
+	for key, values := range query {
+		switch key {
+		case "sort", "order", "limit", "marker":
+			continue
+		}
+		for _, value := range values {
+			switch {
+			case strings.HasSuffix(key, "_null"):
+				if v := resource[strings.TrimSuffix(key, "_null")]; v != nil && v != "" {
+					return false
+				}
+			case strings.HasSuffix(key, "_ne"):
+				if fmt.Sprint(resource[strings.TrimSuffix(key, "_ne")]) == value {
+					return false
+				}
+			case strings.HasSuffix(key, "_prefix"):
+				v, _ := resource[strings.TrimSuffix(key, "_prefix")].(string)
+				if !strings.HasPrefix(v, value) {
+					return false
+				}
+			default:
+				if v, ok := resource[key]; !ok || fmt.Sprint(v) != value {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+//copyResource copies a resource deeply enough that callers can't change the server's state
+func copyResource(resource map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		panic(err)
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type":    "error",
+		"status":  status,
+		"code":    http.StatusText(status),
+		"message": message,
+	})
+}
@@ -0,0 +1,84 @@
+//Package yaml reads and writes receiver definitions as YAML with gopkg.in/yaml.v2. Values go
+//through encoding/json, so struct fields are named by their json tags.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+//Unmarshal parses YAML and stores the result in v the way json.Unmarshal would
+func Unmarshal(data []byte, v interface{}) error {
+	value, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+//Marshal writes v as YAML, mapping keys sorted. v is first encoded as JSON, so it can be anything
+//json.Marshal accepts.
+func Marshal(v interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return yamlv2.Marshal(value)
+}
+
+//Parse reads a single YAML document into maps with string keys, slices, strings, int64, float64,
+//bools and nil. Duplicate keys and further documents are reported as errors.
+func Parse(data []byte) (interface{}, error) {
+	decoder := yamlv2.NewDecoder(bytes.NewReader(data))
+	decoder.SetStrict(true)
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var next interface{}
+	if err := decoder.Decode(&next); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("yaml: only one document is supported")
+	}
+	return normalize(value), nil
+}
+
+//normalize turns the values yaml.v2 decodes into the ones encoding/json works with
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalize(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalize(item)
+		}
+		return result
+	case int:
+		return int64(v)
+	}
+	return value
+}
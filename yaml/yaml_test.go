@@ -0,0 +1,127 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		document string
+		expected interface{}
+	}{
+		{"", nil},
+		{"name: wh1", map[string]interface{}{"name": "wh1"}},
+		{
+			"---\n# a receiver\nname: wh1 # trailing\ndriver: scaleService\nscaleServiceConfig:\n  serviceId: 1s1\n  amount: 2\n  min: 1.5\n  action: 'up'\nuseToken: true\ncondition: \"body.a == '#1'\"\n",
+			map[string]interface{}{
+				"name":   "wh1",
+				"driver": "scaleService",
+				"scaleServiceConfig": map[string]interface{}{
+					"serviceId": "1s1", "amount": int64(2), "min": 1.5, "action": "up",
+				},
+				"useToken":  true,
+				"condition": "body.a == '#1'",
+			},
+		},
+		{
+			"allowedCIDRs:\n- 10.0.0.0/8\n- 192.168.0.0/16\nempty:\nnone: ~\n",
+			map[string]interface{}{"allowedCIDRs": []interface{}{"10.0.0.0/8", "192.168.0.0/16"}, "empty": nil, "none": nil},
+		},
+		{
+			"- name: a\n  labels:\n    x: \"1\"\n- name: b\n-\n  - 1\n  - - 2\n    - 3\n",
+			[]interface{}{
+				map[string]interface{}{"name": "a", "labels": map[string]interface{}{"x": "1"}},
+				map[string]interface{}{"name": "b"},
+				[]interface{}{int64(1), []interface{}{int64(2), int64(3)}},
+			},
+		},
+		{
+			"selector: {app: web, 'tier': \"front, end\"}\nids: [1s1, 2, [a], {}]\n",
+			map[string]interface{}{
+				"selector": map[string]interface{}{"app": "web", "tier": "front, end"},
+				"ids":      []interface{}{"1s1", int64(2), []interface{}{"a"}, map[string]interface{}{}},
+			},
+		},
+		{
+			"script: |\n  line one\n    indented\n  line two\nfolded: >-\n  a\n  b\nnext: x\n",
+			map[string]interface{}{"script": "line one\n  indented\nline two\n", "folded": "a b", "next": "x"},
+		},
+		{"\"quoted: key\": it's\nurl: http://host:8080/a#b\n", map[string]interface{}{"quoted: key": "it's", "url": "http://host:8080/a#b"}},
+		{
+			"a: |\n  line1\n\n  # not a comment\n  line3\nb: >\n  one\n  two\n\n  # kept\n",
+			map[string]interface{}{"a": "line1\n\n# not a comment\nline3\n", "b": "one two\n# kept\n"},
+		},
+		{"defaults: &d {a: 1}\nlocal:\n  <<: *d\n  b: 2\n", map[string]interface{}{
+			"defaults": map[string]interface{}{"a": int64(1)},
+			"local":    map[string]interface{}{"a": int64(1), "b": int64(2)},
+		}},
+	}
+
+	for _, test := range tests {
+		value, err := Parse([]byte(test.document))
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", test.document, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("Parsing %q\ngot      %#v\nexpected %#v", test.document, value, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, document := range []string{
+		"a: 1\n  b: 2",
+		"a: 1\na: 2",
+		"a:\n\tb: 1",
+		"a: [1, 2",
+		"a: 'open",
+		"a: 1\n---\nb: 2",
+		"- a\nb: 1",
+		"a: *x",
+	} {
+		if _, err := Parse([]byte(document)); err == nil || !strings.HasPrefix(err.Error(), "yaml: ") {
+			t.Errorf("Expected an error parsing %q, got %v", document, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type config struct {
+		ServiceID string            `json:"serviceId"`
+		Amount    int64             `json:"amount"`
+		Labels    map[string]string `json:"labels,omitempty"`
+	}
+	type receiver struct {
+		Name     string              `json:"name"`
+		Config   config              `json:"config"`
+		CIDRs    []string            `json:"cidrs"`
+		Rules    []map[string]string `json:"rules"`
+		Note     string              `json:"note"`
+		Disabled bool                `json:"disabled"`
+	}
+	original := receiver{
+		Name:   "wh-1",
+		Config: config{ServiceID: "1s1", Amount: 3, Labels: map[string]string{"io.rancher/a": "true", "b": ""}},
+		CIDRs:  []string{"10.0.0.0/8"},
+		Rules:  []map[string]string{{"when": "body.a: 1", "then": "- up"}, {}},
+		Note:   "two\nlines # not a comment",
+	}
+
+	data, err := Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := receiver{}
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to read back\n%s\n%v", data, err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Fatalf("Round trip through\n%s\ngot %#v", data, decoded)
+	}
+	if !strings.Contains(string(data), "name: wh-1\n") || !strings.Contains(string(data), "  amount: 3\n") {
+		t.Fatalf("Unexpected YAML\n%s", data)
+	}
+}